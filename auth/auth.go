@@ -0,0 +1,76 @@
+// Package auth works out who is making a request.  Each way of telling is an Authenticator,
+// the server tries the ones configured in turn, and the identity found travels to the
+// handlers in the request's context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCredentials is returned when a request carries credentials that do not check
+// out, as opposed to carrying none at all.
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Name   string // the user name, an email address, as store.GetUser takes it
+	Method string // the Authenticator that vouched for it, e.g. header or jwt
+
+	// What the identity provider says of them, when it says anything: whether they are an
+	// admin and the teams they are in.
+	Admin bool
+	Teams []string
+
+	// Scopes limits what the credentials may be used for, when they are limited at all.
+	Scopes []string
+}
+
+// Authenticator finds the identity behind a request.  It returns nil and no error when the
+// request carries nothing it knows how to check, so that the next one can try, and an error
+// wrapping ErrInvalidCredentials when it does but they are wrong.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain tries each Authenticator in turn, returning the first identity found.  A bearer
+// token that none of them accepts is an error rather than an anonymous request.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(r)
+		if err != nil || id != nil {
+			return id, err
+		}
+	}
+	if BearerToken(r) != "" {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, nil
+}
+
+// BearerToken returns the token in the request's Authorization header, if any.
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx, or nil for an anonymous request.
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,148 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tcotav/golinks/auth"
+)
+
+var secret = []byte("s3cret")
+
+func sign(t *testing.T, claims map[string]interface{}, key []byte) string {
+	token, err := auth.SignHS256(claims, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestHeaderAuthenticator(t *testing.T) {
+	a, err := auth.NewHeaderAuthenticator("UserNameAuth", []string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remote string
+		header string
+		want   string
+		err    bool
+	}{
+		{"10.1.2.3:5000", "alice@example.com", "alice@example.com", false},
+		{"[::1]:5000", "alice@example.com", "alice@example.com", false},
+		{"192.168.1.1:5000", "alice@example.com", "", true},
+		{"192.168.1.1:5000", "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("UserNameAuth", tt.header)
+		id, err := a.Authenticate(r)
+		if (err != nil) != tt.err {
+			t.Errorf("%s %q: unexpected error %v", tt.remote, tt.header, err)
+		}
+		if got := name(id); got != tt.want {
+			t.Errorf("%s %q: expected %q, got %q", tt.remote, tt.header, tt.want, got)
+		}
+	}
+	if _, err := auth.NewHeaderAuthenticator("UserNameAuth", []string{"not-a-cidr"}); err == nil {
+		t.Error("Expected an error for a bad CIDR")
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	a := &auth.JWTAuthenticator{Secret: secret, Issuer: "https://issuer.example.com", Audience: "golinks"}
+	now := time.Now().Unix()
+	valid := map[string]interface{}{"email": "bob@example.com", "iss": "https://issuer.example.com", "aud": []string{"golinks"}, "exp": now + 60}
+	with := func(k string, v interface{}) map[string]interface{} {
+		claims := map[string]interface{}{}
+		for ck, cv := range valid {
+			claims[ck] = cv
+		}
+		claims[k] = v
+		return claims
+	}
+	tests := map[string]struct {
+		token string
+		want  string
+		err   bool
+	}{
+		"valid":          {sign(t, valid, secret), "bob@example.com", false},
+		"wrong secret":   {sign(t, valid, []byte("other")), "", true},
+		"expired":        {sign(t, with("exp", now-3600), secret), "", true},
+		"not yet valid":  {sign(t, with("nbf", now+3600), secret), "", true},
+		"wrong issuer":   {sign(t, with("iss", "https://evil.example.com"), secret), "", true},
+		"wrong audience": {sign(t, with("aud", "other"), secret), "", true},
+		"no email":       {sign(t, with("email", ""), secret), "", true},
+		"alg none":       {"eyJhbGciOiJub25lIn0.eyJlbWFpbCI6ImJvYkBleGFtcGxlLmNvbSJ9.", "", true},
+		"not a jwt":      {"plain-token", "", false},
+	}
+	for desc, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		id, err := a.Authenticate(r)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", desc, err)
+		}
+		if err != nil && !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", desc, err)
+		}
+		if got := name(id); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", desc, tt.want, got)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	header, _ := auth.NewHeaderAuthenticator("UserNameAuth", nil)
+	chain := auth.Chain{
+		header,
+		&auth.JWTAuthenticator{Secret: secret},
+		auth.NewStaticTokenAuthenticator(map[string]string{"ci-token": "ci@example.com"}),
+	}
+	tests := map[string]struct {
+		header map[string]string
+		want   string
+		err    bool
+	}{
+		"anonymous":     {nil, "", false},
+		"header":        {map[string]string{"UserNameAuth": "alice@example.com"}, "alice@example.com", false},
+		"jwt":           {map[string]string{"Authorization": "Bearer " + sign(t, map[string]interface{}{"email": "bob@example.com"}, secret)}, "bob@example.com", false},
+		"static token":  {map[string]string{"Authorization": "bearer ci-token"}, "ci@example.com", false},
+		"unknown token": {map[string]string{"Authorization": "Bearer nope"}, "", true},
+		"basic auth":    {map[string]string{"Authorization": "Basic Ym9iOnB3"}, "", false},
+	}
+	for desc, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		id, err := chain.Authenticate(r)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", desc, err)
+		}
+		if got := name(id); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", desc, tt.want, got)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if auth.FromContext(context.Background()) != nil {
+		t.Error("Expected no identity in an empty context")
+	}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Name: "alice@example.com", Method: "header"})
+	if got := name(auth.FromContext(ctx)); got != "alice@example.com" {
+		t.Errorf("Expected alice@example.com, got %q", got)
+	}
+}
+
+func name(id *auth.Identity) string {
+	if id == nil {
+		return ""
+	}
+	return id.Name
+}
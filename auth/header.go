@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HeaderAuthenticator trusts a header set by a proxy in front of the service, such as the
+// UserNameAuth header an istio sidecar injects, but only from the proxy's own addresses.
+type HeaderAuthenticator struct {
+	Header  string
+	Trusted []*net.IPNet // the proxies' networks, any address when empty
+}
+
+// NewHeaderAuthenticator trusts header from the networks in cidrs.  With no cidrs any
+// client can set the header, which is only safe when nothing but the proxy can reach the
+// service.
+func NewHeaderAuthenticator(header string, cidrs []string) (*HeaderAuthenticator, error) {
+	a := &HeaderAuthenticator{Header: header}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			// a lone address
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		a.Trusted = append(a.Trusted, network)
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator.
+func (a *HeaderAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	name := strings.TrimSpace(r.Header.Get(a.Header))
+	if name == "" {
+		return nil, nil
+	}
+	if !a.trusts(r.RemoteAddr) {
+		return nil, fmt.Errorf("%w, %s header from untrusted address %s", ErrInvalidCredentials, a.Header, r.RemoteAddr)
+	}
+	return &Identity{Name: name, Method: "header"}, nil
+}
+
+// trusts is whether remoteAddr, a host and port, is one of the proxies.
+func (a *HeaderAuthenticator) trusts(remoteAddr string) bool {
+	if len(a.Trusted) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far exp and nbf may be off before a token is turned away.
+const clockSkew = time.Minute
+
+// JWTAuthenticator accepts bearer tokens that are JWTs signed with HS256 and a shared
+// secret, as issued by another internal service.
+type JWTAuthenticator struct {
+	Secret   []byte
+	Issuer   string // checked against iss when set
+	Audience string // checked against aud when set
+	Claim    string // the claim holding the user name, email by default
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := BearerToken(r)
+	if strings.Count(token, ".") != 2 {
+		// not a JWT, maybe an API token
+		return nil, nil
+	}
+	claims, err := VerifyHS256(token, a.Secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClaims(claims, a.Issuer, a.Audience, time.Now()); err != nil {
+		return nil, err
+	}
+	claim := a.Claim
+	if claim == "" {
+		claim = "email"
+	}
+	name, _ := claims[claim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w, token has no %s claim", ErrInvalidCredentials, claim)
+	}
+	return &Identity{Name: name, Method: "jwt"}, nil
+}
+
+// SignHS256 issues a JWT carrying claims signed with secret, for tools and tests that need
+// a token JWTAuthenticator accepts.
+func SignHS256(claims map[string]interface{}, secret []byte) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := b64(header) + "." + b64(payload)
+	return signed + "." + b64(hs256(signed, secret)), nil
+}
+
+// VerifyHS256 checks the signature of token against secret and returns its claims.  Only
+// HS256 is accepted, whatever the token's header says.
+func VerifyHS256(token string, secret []byte) (map[string]interface{}, error) {
+	j, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if j.Alg != "HS256" {
+		return nil, fmt.Errorf("%w, token signed with %s, expected HS256", ErrInvalidCredentials, j.Alg)
+	}
+	if !hmac.Equal(j.sig, hs256(j.signed, secret)) {
+		return nil, fmt.Errorf("%w, bad token signature", ErrInvalidCredentials)
+	}
+	return j.claims, nil
+}
+
+// jwt is a token split into its parts, its signature not yet checked.
+type jwt struct {
+	Alg    string `json:"alg"`
+	Kid    string `json:"kid"`
+	claims map[string]interface{}
+	signed string // the header and payload, as the signature covers them
+	sig    []byte
+}
+
+func parseJWT(token string) (*jwt, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w, malformed token", ErrInvalidCredentials)
+	}
+	var j jwt
+	if err := decodeSegment(parts[0], &j); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &j.claims); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w, malformed token", ErrInvalidCredentials)
+	}
+	j.signed, j.sig = parts[0]+"."+parts[1], sig
+	return &j, nil
+}
+
+// checkClaims checks the standard claims: the token has to be current, and from issuer
+// and for audience when they are set.
+func checkClaims(claims map[string]interface{}, issuer string, audience string, now time.Time) error {
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return fmt.Errorf("%w, token expired", ErrInvalidCredentials)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w, token not valid yet", ErrInvalidCredentials)
+	}
+	if issuer != "" && claims["iss"] != issuer {
+		return fmt.Errorf("%w, token issued by %v, expected %s", ErrInvalidCredentials, claims["iss"], issuer)
+	}
+	if audience != "" && !hasAudience(claims["aud"], audience) {
+		return fmt.Errorf("%w, token not meant for %s", ErrInvalidCredentials, audience)
+	}
+	return nil
+}
+
+// hasAudience is whether aud, a string or a list of them, names audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w, malformed token", ErrInvalidCredentials)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w, malformed token", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+func hs256(signed string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,462 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionCookie holds a signed-in user's session.
+	SessionCookie = "golinks_session"
+	// flowCookie holds the state of a sign-in between the redirect to the provider and the
+	// callback.
+	flowCookie = "golinks_oidc"
+	flowTTL    = 10 * time.Minute
+	// keysRefetch is how often an unknown key id may send us back to the provider's JWKS.
+	keysRefetch = time.Minute
+)
+
+// OIDCConfig describes an OpenID Connect provider and how its claims map onto users.
+type OIDCConfig struct {
+	Issuer       string // discovery document is read from Issuer/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // where the provider sends people back to, our /auth/callback
+	Scopes       []string // asked for besides openid, e.g. email and groups
+
+	Claim       string            // the claim holding the user name, email by default
+	AdminClaim  string            // a claim saying who is an admin, not consulted when empty
+	AdminValues []string          // values of AdminClaim that make an admin, any true value when empty
+	TeamClaim   string            // a claim listing the user's teams, not consulted when empty
+	TeamMap     map[string]string // claim values to team names, values passed as-is when empty
+
+	SessionSecret []byte // signs the session and sign-in cookies
+	SessionTTL    time.Duration
+}
+
+// OIDC signs people in with the authorization code flow, using PKCE, and then keeps them
+// signed in with a session cookie, which as an Authenticator it accepts.
+type OIDC struct {
+	OIDCConfig
+	// OnLogin, when set, is called with each identity as it signs in.  An error turns the
+	// sign-in away.
+	OnLogin func(*Identity) error
+	Client  *http.Client
+
+	mu          sync.Mutex
+	endpoints   *oidcEndpoints
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// oidcEndpoints is the part of the provider's discovery document we use.
+type oidcEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC checks cfg.  The provider itself is not contacted until the first sign-in, so
+// that the service starts whether or not it is up.
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	switch {
+	case cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "":
+		return nil, fmt.Errorf("an OIDC provider needs an issuer, client id and redirect url")
+	case len(cfg.SessionSecret) < 16:
+		return nil, fmt.Errorf("an OIDC provider needs a session secret of at least 16 bytes")
+	}
+	if cfg.Claim == "" {
+		cfg.Claim = "email"
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 12 * time.Hour
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &OIDC{OIDCConfig: cfg, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Authenticate implements Authenticator, accepting the session cookie.  A session that has
+// expired, or was not signed by us, is no session at all: the request is anonymous and
+// may sign in again.
+func (o *OIDC) Authenticate(r *http.Request) (*Identity, error) {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	claims, err := o.readCookie(c.Value, SessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	name, _ := claims["sub"].(string)
+	if name == "" {
+		return nil, nil
+	}
+	admin, _ := claims["admin"].(bool)
+	return &Identity{Name: name, Method: "oidc", Admin: admin, Teams: stringList(claims["teams"])}, nil
+}
+
+// Login sends the browser to the provider to sign in, coming back to next, a path on this
+// service, afterwards.
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	ep, err := o.discover()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		// only ever back to ourselves
+		next = "/"
+	}
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	flow, err := SignHS256(map[string]interface{}{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"next":     next,
+		"exp":      time.Now().Add(flowTTL).Unix(),
+		"use":      flowCookie,
+	}, o.SessionSecret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o.setCookie(w, flowCookie, flow, flowTTL)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, o.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {b64(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(ep.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, ep.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// Callback finishes a sign-in: it trades the code the provider sent back for an ID token,
+// checks it, and starts a session.
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, fmt.Sprintf("Sign in failed, %s %s", e, q.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	c, err := r.Cookie(flowCookie)
+	if err != nil {
+		http.Error(w, "Sign in failed, no sign in is in progress", http.StatusBadRequest)
+		return
+	}
+	flow, err := o.readCookie(c.Value, flowCookie)
+	if err != nil {
+		http.Error(w, "Sign in failed, the sign in has expired", http.StatusBadRequest)
+		return
+	}
+	state, _ := flow["state"].(string)
+	if q.Get("state") == "" || !hmac.Equal([]byte(q.Get("state")), []byte(state)) {
+		http.Error(w, "Sign in failed, state does not match", http.StatusBadRequest)
+		return
+	}
+	o.setCookie(w, flowCookie, "", -1)
+
+	verifier, _ := flow["verifier"].(string)
+	nonce, _ := flow["nonce"].(string)
+	id, err := o.exchange(q.Get("code"), verifier, nonce)
+	if err != nil {
+		http.Error(w, "Sign in failed, "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if o.OnLogin != nil {
+		if err := o.OnLogin(id); err != nil {
+			http.Error(w, "Sign in failed, "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	session, err := SignHS256(map[string]interface{}{
+		"sub":   id.Name,
+		"admin": id.Admin,
+		"teams": id.Teams,
+		"exp":   time.Now().Add(o.SessionTTL).Unix(),
+		"use":   SessionCookie,
+	}, o.SessionSecret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o.setCookie(w, SessionCookie, session, o.SessionTTL)
+	next, _ := flow["next"].(string)
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// Logout ends the session.
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) {
+	o.setCookie(w, SessionCookie, "", -1)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// exchange trades code for the provider's ID token and returns who it says signed in.
+func (o *OIDC) exchange(code string, verifier string, nonce string) (*Identity, error) {
+	ep, err := o.discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", ep.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("unreadable token response, %v", err)
+	}
+	if tokens.Error != "" || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	claims, err := o.verifyIDToken(tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return o.identity(claims)
+}
+
+// verifyIDToken checks the ID token's signature and that it was issued to us, just now,
+// for this sign-in.
+func (o *OIDC) verifyIDToken(token string, nonce string) (map[string]interface{}, error) {
+	j, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	switch j.Alg {
+	case "RS256":
+		key, err := o.key(j.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256([]byte(j.signed))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], j.sig) != nil {
+			return nil, fmt.Errorf("%w, bad ID token signature", ErrInvalidCredentials)
+		}
+	case "HS256":
+		// signed with our client secret
+		if !hmac.Equal(j.sig, hs256(j.signed, []byte(o.ClientSecret))) {
+			return nil, fmt.Errorf("%w, bad ID token signature", ErrInvalidCredentials)
+		}
+	default:
+		return nil, fmt.Errorf("%w, ID token signed with %s", ErrInvalidCredentials, j.Alg)
+	}
+	if _, ok := j.claims["exp"].(float64); !ok {
+		return nil, fmt.Errorf("%w, ID token has no expiry", ErrInvalidCredentials)
+	}
+	if err := checkClaims(j.claims, o.endpoints.Issuer, o.ClientID, time.Now()); err != nil {
+		return nil, err
+	}
+	if got, _ := j.claims["nonce"].(string); !hmac.Equal([]byte(got), []byte(nonce)) {
+		return nil, fmt.Errorf("%w, ID token nonce does not match", ErrInvalidCredentials)
+	}
+	return j.claims, nil
+}
+
+// identity maps an ID token's claims onto who the user is.
+func (o *OIDC) identity(claims map[string]interface{}) (*Identity, error) {
+	name, _ := claims[o.Claim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w, ID token has no %s claim", ErrInvalidCredentials, o.Claim)
+	}
+	if verified, ok := claims["email_verified"].(bool); o.Claim == "email" && ok && !verified {
+		return nil, fmt.Errorf("%w, email %s is not verified", ErrInvalidCredentials, name)
+	}
+	id := &Identity{Name: name, Method: "oidc"}
+	if o.AdminClaim != "" {
+		if len(o.AdminValues) == 0 {
+			id.Admin, _ = claims[o.AdminClaim].(bool)
+		}
+		for _, v := range stringList(claims[o.AdminClaim]) {
+			for _, admin := range o.AdminValues {
+				if v == admin {
+					id.Admin = true
+				}
+			}
+		}
+	}
+	if o.TeamClaim != "" {
+		for _, v := range stringList(claims[o.TeamClaim]) {
+			if len(o.TeamMap) == 0 {
+				id.Teams = append(id.Teams, v)
+			} else if team, ok := o.TeamMap[strings.ToLower(v)]; ok {
+				// viper hands us lowercased keys, so claim values are matched in any case
+				id.Teams = append(id.Teams, team)
+			}
+		}
+	}
+	return id, nil
+}
+
+// discover reads the provider's discovery document, once it has been read successfully.
+func (o *OIDC) discover() (*oidcEndpoints, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.endpoints != nil {
+		return o.endpoints, nil
+	}
+	var ep oidcEndpoints
+	if err := o.getJSON(o.Issuer+"/.well-known/openid-configuration", &ep); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed, %v", err)
+	}
+	if ep.Issuer != o.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed, issuer is %s not %s", ep.Issuer, o.Issuer)
+	}
+	if ep.AuthorizationEndpoint == "" || ep.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC discovery failed, no authorization or token endpoint")
+	}
+	o.endpoints = &ep
+	return o.endpoints, nil
+}
+
+// key returns the provider's signing key kid, going back to its JWKS for keys it has
+// rotated in since we last looked.
+func (o *OIDC) key(kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(o.keysFetched) < keysRefetch {
+		return nil, fmt.Errorf("%w, unknown signing key %s", ErrInvalidCredentials, kid)
+	}
+	o.keysFetched = time.Now()
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(o.endpoints.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed, %v", err)
+	}
+	o.keys = make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		o.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w, unknown signing key %s", ErrInvalidCredentials, kid)
+}
+
+func (o *OIDC) getJSON(url string, v interface{}) error {
+	resp, err := o.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// readCookie returns the claims of a cookie we signed for use, provided it has not
+// expired.
+func (o *OIDC) readCookie(value string, use string) (map[string]interface{}, error) {
+	claims, err := VerifyHS256(value, o.SessionSecret)
+	if err != nil {
+		return nil, err
+	}
+	if claims["use"] != use {
+		return nil, errors.New("not a " + use + " cookie")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("expired")
+	}
+	return claims, nil
+}
+
+// setCookie sets, or with a negative ttl clears, one of our cookies.
+func (o *OIDC) setCookie(w http.ResponseWriter, name string, value string, ttl time.Duration) {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(o.RedirectURL, "https://"),
+		// Lax, not Strict, so the cookies come back on the provider's redirect to us
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// stringList reads a claim that is a string or a list of them.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b64(b)
+}
@@ -0,0 +1,163 @@
+package auth_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tcotav/golinks/auth"
+	"github.com/tcotav/golinks/auth/oidctest"
+)
+
+// oidcApp is a service signing people in with o, answering /whoami with who they are.
+func oidcApp(t *testing.T, cfg auth.OIDCConfig) (*auth.OIDC, *httptest.Server, *http.Client) {
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+	cfg.RedirectURL = app.URL + "/auth/callback"
+	cfg.SessionSecret = []byte("0123456789abcdef")
+	o, err := auth.NewOIDC(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/auth/login", o.Login)
+	mux.HandleFunc("/auth/callback", o.Callback)
+	mux.HandleFunc("/auth/logout", o.Logout)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		id, err := o.Authenticate(r)
+		if err != nil || id == nil {
+			http.Error(w, "anonymous", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "%s admin=%v teams=%s", id.Name, id.Admin, strings.Join(id.Teams, ","))
+	})
+	jar, _ := cookiejar.New(nil)
+	return o, app, &http.Client{Jar: jar}
+}
+
+func get(t *testing.T, c *http.Client, url string) (int, string) {
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	idp := oidctest.NewProvider("golinks", "client-secret")
+	defer idp.Close()
+	var logins []string
+	o, app, c := oidcApp(t, auth.OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "golinks",
+		ClientSecret: "client-secret",
+		Scopes:       []string{"email", "groups"},
+		AdminClaim:   "groups",
+		AdminValues:  []string{"golinks-admins"},
+		TeamClaim:    "groups",
+		TeamMap:      map[string]string{"eng-platform": "platform@example.com"},
+	})
+	o.OnLogin = func(id *auth.Identity) error {
+		logins = append(logins, id.Name)
+		if id.Name == "mallory@example.com" {
+			return errors.New("not welcome")
+		}
+		return nil
+	}
+
+	if code, _ := get(t, c, app.URL+"/links"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 before signing in, got %d", code)
+	}
+
+	idp.SignIn(map[string]interface{}{"email": "alice@example.com", "groups": []string{"Eng-Platform", "golinks-admins", "other"}})
+	code, body := get(t, c, app.URL+"/auth/login?next=/links")
+	if code != http.StatusOK || body != "alice@example.com admin=true teams=platform@example.com" {
+		t.Fatalf("Unexpected response after signing in %d %q", code, body)
+	}
+	if !reflect.DeepEqual(logins, []string{"alice@example.com"}) {
+		t.Errorf("Expected OnLogin called for alice, got %v", logins)
+	}
+
+	get(t, c, app.URL+"/auth/logout")
+	if code, _ := get(t, c, app.URL+"/links"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after signing out, got %d", code)
+	}
+
+	idp.SignIn(map[string]interface{}{"email": "bob@example.com", "groups": "users"})
+	if _, body := get(t, c, app.URL+"/auth/login?next=//evil.example.com"); body != "bob@example.com admin=false teams=" {
+		t.Errorf("Unexpected response signing in as bob %q", body)
+	}
+
+	idp.SignIn(map[string]interface{}{"email": "mallory@example.com"})
+	if code, _ := get(t, c, app.URL+"/auth/login"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 when OnLogin refuses, got %d", code)
+	}
+
+	idp.SignIn(map[string]interface{}{"email": "eve@example.com", "email_verified": false})
+	if code, _ := get(t, c, app.URL+"/auth/login"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unverified email, got %d", code)
+	}
+}
+
+func TestOIDCCallbackChecks(t *testing.T) {
+	idp := oidctest.NewProvider("golinks", "client-secret")
+	defer idp.Close()
+	idp.SignIn(map[string]interface{}{"email": "alice@example.com"})
+
+	// a client that stops at each redirect, so the flow can be tampered with
+	_, app, c := oidcApp(t, auth.OIDCConfig{Issuer: idp.URL, ClientID: "golinks", ClientSecret: "client-secret"})
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	follow := func(url string) string {
+		resp, err := c.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Location")
+	}
+
+	authorize := follow(app.URL + "/auth/login")
+	if !strings.Contains(authorize, "code_challenge_method=S256") || !strings.Contains(authorize, "nonce=") {
+		t.Errorf("Expected a PKCE challenge and nonce, got %s", authorize)
+	}
+	callback := follow(authorize)
+	if !strings.HasPrefix(callback, app.URL+"/auth/callback?") {
+		t.Fatalf("Expected to be sent back to the callback, got %s", callback)
+	}
+	if code, _ := get(t, c, strings.Replace(callback, "state=", "state=x", 1)); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a mismatched state, got %d", code)
+	}
+
+	// without the browser's sign-in cookie, there is no verifier to redeem the code with
+	jar, _ := cookiejar.New(nil)
+	if code, _ := get(t, &http.Client{Jar: jar}, callback); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a callback from another browser, got %d", code)
+	}
+
+	// a code is good once
+	if code, _ := get(t, c, callback); code != http.StatusFound {
+		t.Errorf("Expected the sign-in to finish, got %d", code)
+	}
+	if code, _ := get(t, c, callback); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 replaying the callback, got %d", code)
+	}
+}
+
+func TestOIDCConfig(t *testing.T) {
+	for _, cfg := range []auth.OIDCConfig{
+		{ClientID: "golinks", RedirectURL: "https://go/auth/callback", SessionSecret: []byte("0123456789abcdef")},
+		{Issuer: "https://sso.example.com", ClientID: "golinks", RedirectURL: "https://go/auth/callback", SessionSecret: []byte("short")},
+	} {
+		if _, err := auth.NewOIDC(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
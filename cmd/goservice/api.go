@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+// The versioned links API lives under /api/v1.  Every response, errors included, is a
+// MsgReturn whose ReturnCode matches the HTTP status, and every change is made as the user
+// the configured authenticators identify.  Links carry an ETag of their revision, which PUT and PATCH must
+// send back in If-Match, or as revision in the body, so that edits cannot clobber each other.
+
+// writeJSON sends msg with the status code.
+func writeJSON(w http.ResponseWriter, code int, msg MsgReturn) {
+	msg.ReturnCode = code
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	resp, _ := json.Marshal(msg)
+	w.Write(resp)
+}
+
+// writeError sends message as a MsgReturn with the status code.
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, MsgReturn{Message: message})
+}
+
+// apiError sends err with the status code that fits it.
+func apiError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, store.ErrLocked), errors.Is(err, store.ErrForbidden):
+		code = http.StatusForbidden
+	case errors.Is(err, store.ErrConflict):
+		code = http.StatusPreconditionFailed
+	case s.IsSQLErrDuplicateContraint(err):
+		code = http.StatusConflict
+	}
+	writeError(w, code, err.Error())
+}
+
+// apiUser returns who is making the request, sending a 401 if nobody is.
+func apiUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := currentUser(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "You must be authenticated")
+		return "", false
+	}
+	return user, true
+}
+
+// writeLink sends route along with its ETag.
+func writeLink(w http.ResponseWriter, code int, route routes.Route) {
+	w.Header().Set("ETag", etag(route))
+	writeJSON(w, code, MsgReturn{Routes: []routes.Route{route}})
+}
+
+// etag is the entity tag for the revision of route.
+func etag(route routes.Route) string {
+	return fmt.Sprintf(`"%d"`, route.Revision)
+}
+
+// ifMatch returns the revision named by the request's If-Match header, 0 for *, and
+// whether there was one.
+func ifMatch(r *http.Request) (int, bool, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch v {
+	case "":
+		return 0, false, nil
+	case "*":
+		return 0, true, nil
+	}
+	revision, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(v, "W/"), `"`))
+	if err != nil || revision < 1 {
+		return 0, false, fmt.Errorf("Invalid If-Match %s, expected the ETag of the link", v)
+	}
+	return revision, true, nil
+}
+
+// decodeRoute builds a route from the request body laid over base, as a JSON merge patch
+// where null clears a field, and then over that the fields in set.  The result goes
+// through the same validation as any other route input.
+func decodeRoute(r *http.Request, base map[string]interface{}, set map[string]interface{}) (routes.Route, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return routes.Route{}, err
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return routes.Route{}, err
+	}
+
+	fields := make(map[string]interface{})
+	for _, m := range []map[string]interface{}{base, patch, set} {
+		for k, v := range m {
+			fields[k] = v
+		}
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return routes.Route{}, err
+	}
+	var route routes.Route
+	err = json.Unmarshal(merged, &route)
+	return route, err
+}
+
+// checkBodyKey makes sure a shortkey in the body of a PUT or PATCH, if there is one, is the
+// key in the url.  Keys cannot be renamed.
+func checkBodyKey(route routes.Route, k string) error {
+	if route.ShortKey != routes.NormalizeKey(k) {
+		return fmt.Errorf("Key %s in the body does not match %s, keys cannot be renamed", route.ShortKey, k)
+	}
+	return nil
+}
+
+// apiListLinks handles GET /api/v1/links.  The creator, team, namespace, locked and q
+// (a substring of the key or url) query parameters narrow the list down.
+func apiListLinks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var locked *bool
+	if v := query.Get("locked"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid locked %s", v))
+			return
+		}
+		locked = &b
+	}
+	namespace := routes.NormalizeKey(query.Get("namespace"))
+	q := strings.ToLower(query.Get("q"))
+
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	links := make([]routes.Route, 0, len(all))
+	for _, route := range all {
+		switch {
+		case query.Get("creator") != "" && route.Creator != query.Get("creator"):
+		case query.Get("team") != "" && route.Team != query.Get("team"):
+		case namespace != "" && !strings.HasPrefix(route.ShortKey, namespace+"/"):
+		case locked != nil && (route.Locked == 1) != *locked:
+		case q != "" && !strings.Contains(route.ShortKey, q) && !strings.Contains(strings.ToLower(route.URL), q):
+		default:
+			links = append(links, route)
+		}
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Routes: links})
+}
+
+// apiGetLink handles GET /api/v1/links/{key}.
+func apiGetLink(w http.ResponseWriter, r *http.Request) {
+	route, err := s.Get(mux.Vars(r)["key"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeLink(w, http.StatusOK, route)
+}
+
+// apiCreateLink handles POST /api/v1/links with a route in the body.
+func apiCreateLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	route, err := decodeRoute(r, nil, map[string]interface{}{"creator": user, "lastmodifiedby": user})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := s.Add(route); err != nil {
+		apiError(w, err)
+		return
+	}
+	created, err := s.Get(route.ShortKey)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, created.ShortKey, http.StatusCreated)
+	w.Header().Set("Location", "/api/v1/links/"+created.ShortKey)
+	writeLink(w, http.StatusCreated, created)
+}
+
+// apiPutLink handles PUT /api/v1/links/{key}, replacing the link's urls and settings with
+// the body.  Fields left out of the body are cleared.
+func apiPutLink(w http.ResponseWriter, r *http.Request) {
+	apiUpdateLink(w, r, false)
+}
+
+// apiPatchLink handles PATCH /api/v1/links/{key}, changing only the fields in the body.
+func apiPatchLink(w http.ResponseWriter, r *http.Request) {
+	apiUpdateLink(w, r, true)
+}
+
+// apiUpdateLink is PUT, or PATCH when patch is set.
+func apiUpdateLink(w http.ResponseWriter, r *http.Request, patch bool) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	k := mux.Vars(r)["key"]
+	existing, err := s.Get(k)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+
+	revision, matched, err := ifMatch(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	base := map[string]interface{}{"shortkey": existing.ShortKey}
+	if patch {
+		b, _ := json.Marshal(existing)
+		json.Unmarshal(b, &base)
+		// the revision has to come from the client, not from what we just read
+		base["revision"] = nil
+	}
+	set := map[string]interface{}{"creator": existing.Creator, "team": existing.Team, "lastmodifiedby": user}
+	if matched {
+		set["revision"] = revision
+	}
+	route, err := decodeRoute(r, base, set)
+	if err == nil {
+		err = checkBodyKey(route, k)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !matched && route.Revision == 0 {
+		writeError(w, http.StatusPreconditionRequired, fmt.Sprintf("Send the link's ETag %s in If-Match, or its revision in the body", etag(existing)))
+		return
+	}
+
+	if _, err := s.Modify(route); err != nil {
+		apiError(w, err)
+		return
+	}
+	updated, err := s.Get(route.ShortKey)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, updated.ShortKey, http.StatusOK)
+	writeLink(w, http.StatusOK, updated)
+}
+
+// apiDeleteLink handles DELETE /api/v1/links/{key}, moving the link to the trash.
+func apiDeleteLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	k := mux.Vars(r)["key"]
+	if err := s.Delete(k, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, k, http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{})
+}
+
+// apiLockLink handles POST /api/v1/links/{key}/lock with an optional {"reason": ...} shown
+// to whoever tries to change the link next.  Only admins may lock links, after which only
+// admins may change them.
+func apiLockLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	k := mux.Vars(r)["key"]
+	if _, err := s.Lock(routes.Route{ShortKey: k, LastModifiedBy: user, LockReason: body.Reason}); err != nil {
+		apiError(w, err)
+		return
+	}
+	locked, err := s.Get(k)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, locked.ShortKey, http.StatusOK)
+	writeLink(w, http.StatusOK, locked)
+}
+
+// apiUnlockLink handles DELETE /api/v1/links/{key}/lock, where an admin lets the owners of
+// the link change it again.
+func apiUnlockLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	k := mux.Vars(r)["key"]
+	if _, err := s.Unlock(routes.Route{ShortKey: k, LastModifiedBy: user}); err != nil {
+		apiError(w, err)
+		return
+	}
+	locked, err := s.Get(k)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, locked.ShortKey, http.StatusOK)
+	writeLink(w, http.StatusOK, locked)
+}
+
+// apiCurrentUser handles GET /api/v1/users/me with the user making the request.
+func apiCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	u, err := s.GetUser(user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Users: []store.User{*u}})
+}
+
+// apiMakeAdmin handles POST /api/v1/users/{name}/admin, which only admins may do.
+func apiMakeAdmin(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if _, err := s.MakeAdmin(name, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	u, err := s.GetUser(name)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, name, http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{Users: []store.User{*u}})
+}
+
+// apiSetDeactivated handles POST /api/v1/users/{name}/deactivate, where an admin marks
+// someone who has left, and DELETE to bring them back.
+func apiSetDeactivated(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	u, err := s.SetDeactivated(name, r.Method == "POST", user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, name, http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{Users: []store.User{*u}})
+}
+
+// apiTransferLinks handles POST /api/v1/users/{name}/transfer, where an admin hands every
+// link the user created to {"user": ...}, {"team": ...} or both.
+func apiTransferLinks(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		User string
+		Team string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := mux.Vars(r)["name"]
+	keys, err := s.TransferLinks(name, body.User, body.Team, user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	links := make([]routes.Route, 0, len(keys))
+	for _, k := range keys {
+		route, err := s.Get(k)
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		links = append(links, route)
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, name, http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{Routes: links, Message: fmt.Sprintf("Transferred %d links", len(links))})
+}
+
+// apiOrphanedLinks handles GET /api/v1/orphaned-links, the links whose owners have all been
+// deactivated, for admins.
+func apiOrphanedLinks(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.OrphanedLinks(user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if links == nil {
+		links = make([]routes.Route, 0)
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Routes: links})
+}
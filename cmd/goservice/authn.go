@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/tcotav/golinks/auth"
+	"github.com/tcotav/golinks/store"
+)
+
+// authenticator works out who each request is from.  Until main reads the config it trusts
+// the proxy's header from anywhere, as the service always has.
+var authenticator auth.Authenticator = &auth.HeaderAuthenticator{Header: userAuthHeader}
+
+// oidc signs people in with the identity provider, when the oidc provider is configured.
+var oidc *auth.OIDC
+
+// newAuthenticator chains the providers listed in auth.providers, in order.
+func newAuthenticator() (auth.Authenticator, error) {
+	var chain auth.Chain
+	for _, name := range viper.GetStringSlice("auth.providers") {
+		switch name {
+		case "header":
+			a, err := auth.NewHeaderAuthenticator(viper.GetString("auth.header.name"), viper.GetStringSlice("auth.header.trustedproxies"))
+			if err != nil {
+				return nil, fmt.Errorf("auth.header.trustedproxies: %w", err)
+			}
+			chain = append(chain, a)
+		case "jwt":
+			secret := viper.GetString("auth.jwt.secret")
+			if secret == "" {
+				return nil, fmt.Errorf("auth.jwt.secret must be set to use jwt")
+			}
+			chain = append(chain, &auth.JWTAuthenticator{
+				Secret:   []byte(secret),
+				Issuer:   viper.GetString("auth.jwt.issuer"),
+				Audience: viper.GetString("auth.jwt.audience"),
+				Claim:    viper.GetString("auth.jwt.claim"),
+			})
+		case "tokens":
+			// a list rather than a map, as viper lowercases map keys
+			var entries []struct{ Token, User string }
+			if err := viper.UnmarshalKey("auth.tokens", &entries); err != nil {
+				return nil, fmt.Errorf("auth.tokens: %w", err)
+			}
+			tokens := make(map[string]string, len(entries))
+			for _, e := range entries {
+				if e.Token == "" || e.User == "" {
+					return nil, fmt.Errorf("auth.tokens: every entry needs a token and a user")
+				}
+				tokens[e.Token] = e.User
+			}
+			chain = append(chain, auth.NewStaticTokenAuthenticator(tokens))
+		case "apitokens":
+			chain = append(chain, apiTokenAuthenticator{})
+		case "oidc":
+			o, err := auth.NewOIDC(auth.OIDCConfig{
+				Issuer:        viper.GetString("auth.oidc.issuer"),
+				ClientID:      viper.GetString("auth.oidc.clientid"),
+				ClientSecret:  viper.GetString("auth.oidc.clientsecret"),
+				RedirectURL:   viper.GetString("auth.oidc.redirecturl"),
+				Scopes:        viper.GetStringSlice("auth.oidc.scopes"),
+				Claim:         viper.GetString("auth.oidc.claim"),
+				AdminClaim:    viper.GetString("auth.oidc.admin.claim"),
+				AdminValues:   viper.GetStringSlice("auth.oidc.admin.values"),
+				TeamClaim:     viper.GetString("auth.oidc.teams.claim"),
+				TeamMap:       viper.GetStringMapString("auth.oidc.teams.map"),
+				SessionSecret: []byte(viper.GetString("auth.oidc.sessionsecret")),
+				SessionTTL:    viper.GetDuration("auth.oidc.sessionttl"),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("auth.oidc: %w", err)
+			}
+			o.OnLogin = signedIn
+			oidc = o
+			chain = append(chain, o)
+		default:
+			return nil, fmt.Errorf("Unknown auth provider %s", name)
+		}
+	}
+	return chain, nil
+}
+
+// apiTokenAuthenticator accepts the personal API tokens users mint for themselves.
+type apiTokenAuthenticator struct{}
+
+// Authenticate implements auth.Authenticator.  Bearer tokens that are not API tokens are
+// left to the rest of the chain.
+func (apiTokenAuthenticator) Authenticate(r *http.Request) (*auth.Identity, error) {
+	token := auth.BearerToken(r)
+	if !strings.HasPrefix(token, store.TokenPrefix) {
+		return nil, nil
+	}
+	t, err := s.CheckToken(token)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w, unknown, revoked or expired API token", auth.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Identity{Name: t.User, Method: "apitoken", Scopes: t.Scopes}, nil
+}
+
+// hasScope is whether the request's credentials allow scope.  Only API tokens are limited.
+func hasScope(r *http.Request, scope string) bool {
+	id := auth.FromContext(r.Context())
+	if id == nil || id.Scopes == nil {
+		return true
+	}
+	return store.APIToken{Scopes: id.Scopes}.HasScope(scope)
+}
+
+// requireScope serves h only to requests whose credentials allow scope.
+func requireScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasScope(r, scope) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("This token does not have the %s scope", scope))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// signedIn resolves someone who has just signed in with the identity provider to their user,
+// creating it the first time, and when the provider is configured to say who is an admin
+// takes its word for it.
+func signedIn(id *auth.Identity) error {
+	u, err := s.GetUser(id.Name)
+	if err != nil {
+		return err
+	}
+	if u.Deactivated == 1 {
+		return fmt.Errorf("%w, %s has been deactivated", auth.ErrInvalidCredentials, id.Name)
+	}
+	if oidc.AdminClaim != "" && (u.IsAdmin == 1) != id.Admin {
+		if _, err := s.SetAdmin(id.Name, id.Admin); err != nil {
+			return err
+		}
+		log.Printf("%s is an admin: %v, as the identity provider has it", id.Name, id.Admin)
+	}
+	// the teams a user is in decide which links they own
+	if oidc.TeamClaim != "" {
+		return s.SetTeams(id.Name, id.Teams)
+	}
+	return nil
+}
+
+// oidcHandler serves h from the OIDC provider, or a 404 when there is none configured.
+func oidcHandler(h func(*auth.OIDC, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if oidc == nil {
+			writeError(w, http.StatusNotFound, "Signing in with OIDC is not configured")
+			return
+		}
+		h(oidc, w, r)
+	}
+}
+
+// identify is middleware putting the requester's identity in the request's context.
+// Credentials that do not check out get a 401 rather than being treated as anonymous.
+func identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := authenticator.Authenticate(r)
+		if err != nil {
+			logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, err.Error(), http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if id != nil && !isRedirect(r) {
+			if err := checkActive(id.Name); err != nil {
+				logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, err.Error(), http.StatusUnauthorized)
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			r = r.WithContext(auth.WithIdentity(r.Context(), id))
+		}
+		// reading takes links:read and anything else links:write, on top of whatever
+		// the handler itself asks for
+		scope := store.ScopeLinksWrite
+		if r.Method == "GET" || r.Method == "HEAD" {
+			scope = store.ScopeLinksRead
+		}
+		requireScope(scope, next.ServeHTTP)(w, r)
+	})
+}
+
+// isRedirect is whether r only follows a link, which is left alone on the hot path: anyone
+// may follow links, so looking the user up would cost a query for nothing.
+func isRedirect(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	for _, prefix := range []string{"/api/", "/scim/", "/auth/"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkActive refuses users who have been deactivated, whatever credentials they still hold.
+// Users not seen yet are let through without being created.
+func checkActive(name string) error {
+	u, err := s.FindUser(name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Deactivated == 1 {
+		return fmt.Errorf("%w, %s has been deactivated", auth.ErrInvalidCredentials, name)
+	}
+	return nil
+}
+
+// currentUser is who the request is from, empty when anonymous.
+func currentUser(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); id != nil {
+		return id.Name
+	}
+	return ""
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/tcotav/golinks/auth"
+	"github.com/tcotav/golinks/auth/oidctest"
+	"github.com/tcotav/golinks/store"
+)
+
+// useTestStore points the server at an empty SQLite store for the rest of the test.
+func useTestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "testdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := store.MigrateUp(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = store.NewStore("sqlite", db, nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCSignInMakesUser(t *testing.T) {
+	useTestStore(t)
+	idp := oidctest.NewProvider("golinks", "client-secret")
+	defer idp.Close()
+
+	var handler http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler.ServeHTTP(w, r) }))
+	defer app.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("auth.providers", []string{"oidc"})
+	viper.Set("auth.oidc.issuer", idp.URL)
+	viper.Set("auth.oidc.clientid", "golinks")
+	viper.Set("auth.oidc.clientsecret", "client-secret")
+	viper.Set("auth.oidc.redirecturl", app.URL+"/auth/callback")
+	viper.Set("auth.oidc.sessionsecret", "0123456789abcdef")
+	viper.Set("auth.oidc.admin.claim", "groups")
+	viper.Set("auth.oidc.admin.values", []string{"golinks-admins"})
+	a, err := newAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := authenticator
+	defer func() { authenticator, oidc = saved, nil }()
+	authenticator = a
+	handler = newRouter()
+
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar}
+	signIn := func(url string) {
+		resp, err := c.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	me := func() store.User {
+		resp, err := c.Get(app.URL + "/api/v1/users/me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var msg MsgReturn
+		json.NewDecoder(resp.Body).Decode(&msg)
+		if len(msg.Users) != 1 {
+			t.Fatalf("Expected the signed in user, got %d %+v", resp.StatusCode, msg)
+		}
+		return msg.Users[0]
+	}
+
+	idp.SignIn(map[string]interface{}{"email": "alice@example.com", "groups": []string{"golinks-admins"}})
+	signIn(app.URL + "/auth/login?next=/api/v1/users/me")
+	if u := me(); u.Name != "alice@example.com" || u.IsAdmin != 1 {
+		t.Errorf("Expected alice made an admin, got %+v", u)
+	}
+
+	// dropped from the group, alice is no longer an admin on signing in again
+	idp.SignIn(map[string]interface{}{"email": "alice@example.com", "groups": []string{"users"}})
+	signIn(app.URL + "/auth/login")
+	if u := me(); u.IsAdmin != 0 {
+		t.Errorf("Expected alice no longer an admin, got %+v", u)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	useTestStore(t)
+	saved := authenticator
+	defer func() { authenticator = saved }()
+	authenticator = auth.Chain{&auth.HeaderAuthenticator{Header: userAuthHeader}, apiTokenAuthenticator{}}
+	router := newRouter()
+
+	do := func(method string, url string, body string, header string, value string) (int, MsgReturn) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var msg MsgReturn
+		json.NewDecoder(w.Body).Decode(&msg)
+		return w.Code, msg
+	}
+	mint := func(name string, scopes string) string {
+		code, msg := do("POST", "/api/v1/tokens", `{"name": "`+name+`", "scopes": [`+scopes+`]}`, userAuthHeader, "ci@example.com")
+		if code != http.StatusCreated || len(msg.Tokens) != 1 {
+			t.Fatalf("Expected a token minted, got %d %+v", code, msg)
+		}
+		return "Bearer " + msg.Tokens[0].Token
+	}
+	reader, writer := mint("reader", `"links:read"`), mint("writer", `"links:read", "links:write"`)
+
+	if code, msg := do("GET", "/api/v1/users/me", "", "Authorization", reader); code != http.StatusOK || msg.Users[0].Name != "ci@example.com" {
+		t.Errorf("Expected the token to act as ci, got %d %+v", code, msg)
+	}
+	link := `{"shortkey": "wiki", "url": "https://wiki.example.com"}`
+	if code, _ := do("POST", "/api/v1/links", link, "Authorization", reader); code != http.StatusForbidden {
+		t.Errorf("Expected 403 creating a link with a read-only token, got %d", code)
+	}
+	if code, _ := do("POST", "/api/v1/links", link, "Authorization", writer); code != http.StatusCreated {
+		t.Errorf("Expected a link created with a links:write token, got %d", code)
+	}
+	if code, _ := do("POST", "/api/v1/links/wiki/lock", "", "Authorization", writer); code != http.StatusForbidden {
+		t.Errorf("Expected 403 locking without the admin scope, got %d", code)
+	}
+	if code, _ := do("POST", "/api/v1/tokens", `{"name": "more", "scopes": ["links:read"]}`, "Authorization", writer); code != http.StatusForbidden {
+		t.Errorf("Expected 403 minting a token with a token, got %d", code)
+	}
+	if code, _ := do("GET", "/api/v1/users/me", "", "Authorization", "Bearer glk_nope"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown token, got %d", code)
+	}
+
+	_, msg := do("GET", "/api/v1/tokens", "", "Authorization", reader)
+	if len(msg.Tokens) != 2 || msg.Tokens[0].Token != "" {
+		t.Fatalf("Expected both tokens listed without their secrets, got %+v", msg.Tokens)
+	}
+	if code, _ := do("DELETE", "/api/v1/tokens/"+strconv.Itoa(msg.Tokens[0].ID), "", "Authorization", writer); code != http.StatusOK {
+		t.Errorf("Expected the read-only token revoked, got %d", code)
+	}
+	if code, _ := do("GET", "/api/v1/users/me", "", "Authorization", reader); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a revoked token, got %d", code)
+	}
+}
+
+func TestLinkPermissions(t *testing.T) {
+	useTestStore(t)
+	saved := authenticator
+	defer func() { authenticator = saved }()
+	authenticator = &auth.HeaderAuthenticator{Header: userAuthHeader}
+	router := newRouter()
+
+	do := func(method string, url string, body string, user string) (int, MsgReturn) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set(userAuthHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var msg MsgReturn
+		json.NewDecoder(w.Body).Decode(&msg)
+		return w.Code, msg
+	}
+	if code, _ := do("POST", "/api/v1/links", `{"shortkey": "wiki", "url": "https://wiki.example.com"}`, "alice@example.com"); code != http.StatusCreated {
+		t.Fatalf("Expected a link created, got %d", code)
+	}
+	change := `{"url": "https://evil.example.com", "revision": 1}`
+	if code, msg := do("PATCH", "/api/v1/links/wiki", change, "bob@example.com"); code != http.StatusForbidden || !strings.Contains(msg.Message, "alice@example.com") {
+		t.Errorf("Expected 403 naming the owner, got %d %q", code, msg.Message)
+	}
+	if code, _ := do("DELETE", "/delete/wiki", "", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 deleting someone else's link, got %d", code)
+	}
+
+	// the legacy endpoints take the owner from who signed in, not the body
+	if code, _ := do("POST", "/add/bar", `{"shortkey": "bar", "url": "https://bar.example.com", "creator": "alice@example.com"}`, "mallory@example.com"); code != http.StatusOK {
+		t.Fatalf("Expected a link created through /add, got %d", code)
+	}
+	if bar, err := s.Get("bar"); err != nil || bar.Creator != "mallory@example.com" {
+		t.Errorf("Expected bar owned by mallory, got %+v (err %v)", bar, err)
+	}
+	// and without authrequired, nobody signed in may not own a link either
+	if code, _ := do("POST", "/add/anon", `{"shortkey": "anon", "url": "https://anon.example.com", "creator": "alice@example.com"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 adding through /add without signing in, got %d", code)
+	}
+	if _, err := s.FindUser(""); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected no user without a name, got %v", err)
+	}
+	if code, _ := do("POST", "/edit/wiki", `{"shortkey": "wiki", "url": "https://wiki.example.com/new", "creator": "alice@example.com"}`, "alice@example.com"); code != http.StatusPreconditionRequired {
+		t.Errorf("Expected 428 editing through /edit without a revision, got %d", code)
+	}
+	if code, msg := do("POST", "/edit/wiki", `{"shortkey": "wiki", "url": "https://evil.example.com", "creator": "alice@example.com", "lastmodifiedby": "alice@example.com", "revision": 1}`, "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 editing as someone else through /edit, got %d %+v", code, msg)
+	}
+
+	if code, _ := do("POST", "/api/v1/links/wiki/editors", `{"user": "bob@example.com"}`, "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a stranger choosing editors, got %d", code)
+	}
+	if code, msg := do("POST", "/api/v1/links/wiki/editors", `{"user": "bob@example.com"}`, "alice@example.com"); code != http.StatusOK || len(msg.Editors) != 1 {
+		t.Fatalf("Expected bob made an editor, got %d %+v", code, msg)
+	}
+	if code, _ := do("PATCH", "/api/v1/links/wiki", change, "bob@example.com"); code != http.StatusOK {
+		t.Errorf("Expected an editor to change the link, got %d", code)
+	}
+	if code, msg := do("DELETE", "/api/v1/links/wiki/editors/bob@example.com", "", "alice@example.com"); code != http.StatusOK || len(msg.Editors) != 0 {
+		t.Errorf("Expected bob no longer an editor, got %d %+v", code, msg)
+	}
+}
+
+func TestDeactivatedUser(t *testing.T) {
+	useTestStore(t)
+	saved := authenticator
+	defer func() { authenticator = saved }()
+	authenticator = &auth.HeaderAuthenticator{Header: userAuthHeader}
+	router := newRouter()
+	if _, err := s.SetAdmin("admin@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method string, url string, body string, user string) (int, MsgReturn) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set(userAuthHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var msg MsgReturn
+		json.NewDecoder(w.Body).Decode(&msg)
+		return w.Code, msg
+	}
+	if code, _ := do("POST", "/api/v1/links", `{"shortkey": "wiki", "url": "https://wiki.example.com"}`, "alice@example.com"); code != http.StatusCreated {
+		t.Fatalf("Expected a link created, got %d", code)
+	}
+	if code, _ := do("POST", "/api/v1/users/alice@example.com/deactivate", "", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin deactivating someone, got %d", code)
+	}
+	if code, msg := do("POST", "/api/v1/users/alice@example.com/deactivate", "", "admin@example.com"); code != http.StatusOK || msg.Users[0].Deactivated != 1 {
+		t.Fatalf("Expected alice deactivated, got %d %+v", code, msg)
+	}
+	if code, _ := do("GET", "/api/v1/users/me", "", "alice@example.com"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a deactivated user, got %d", code)
+	}
+	// following links looks nobody up, let alone creates them
+	if code, _ := do("GET", "/wiki", "", "stranger@example.com"); code != http.StatusFound {
+		t.Errorf("Expected a redirect, got %d", code)
+	}
+	if _, err := s.FindUser("stranger@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected no user made by following a link, got %v", err)
+	}
+	if code, _ := do("GET", "/api/v1/orphaned-links", "", "bob@example.com"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 listing orphaned links as a non-admin, got %d", code)
+	}
+	if code, msg := do("GET", "/api/v1/orphaned-links", "", "admin@example.com"); code != http.StatusOK || len(msg.Routes) != 1 {
+		t.Errorf("Expected wiki orphaned, got %d %+v", code, msg)
+	}
+	if code, msg := do("POST", "/api/v1/users/alice@example.com/transfer", `{"user": "bob@example.com"}`, "admin@example.com"); code != http.StatusOK || len(msg.Routes) != 1 || msg.Routes[0].Creator != "bob@example.com" {
+		t.Fatalf("Expected wiki transferred to bob, got %d %+v", code, msg)
+	}
+	if code, msg := do("GET", "/api/v1/orphaned-links", "", "admin@example.com"); code != http.StatusOK || len(msg.Routes) != 0 {
+		t.Errorf("Expected nothing orphaned, got %d %+v", code, msg)
+	}
+	if code, _ := do("DELETE", "/api/v1/users/alice@example.com/deactivate", "", "admin@example.com"); code != http.StatusOK {
+		t.Errorf("Expected alice reactivated, got %d", code)
+	}
+	if code, _ := do("GET", "/api/v1/users/me", "", "alice@example.com"); code != http.StatusOK {
+		t.Errorf("Expected a reactivated user back in, got %d", code)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// apiListEditors handles GET /api/v1/links/{key}/editors, the users who may change the link
+// besides its owners.
+func apiListEditors(w http.ResponseWriter, r *http.Request) {
+	editors, err := s.Editors(mux.Vars(r)["key"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Editors: editors})
+}
+
+// apiAddEditor handles POST /api/v1/links/{key}/editors, where an owner of the link makes
+// {"user": ...} one of its editors.
+func apiAddEditor(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		User string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.User == "" {
+		writeError(w, http.StatusBadRequest, "Missing the user to make an editor")
+		return
+	}
+	k := mux.Vars(r)["key"]
+	if err := s.AddEditor(k, body.User, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, body.User, http.StatusOK)
+	apiListEditors(w, r)
+}
+
+// apiRemoveEditor handles DELETE /api/v1/links/{key}/editors/{user}, where an owner of the
+// link takes away user's right to change it.
+func apiRemoveEditor(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	if err := s.RemoveEditor(vars["key"], vars["user"], user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, vars["user"], http.StatusOK)
+	apiListEditors(w, r)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/tcotav/golinks/store"
+)
+
+const migrateUsage = "usage: goservice migrate up|down [steps]|status|normalize [apply]"
+
+// runMigrate handles `goservice migrate up|down [steps]|status|normalize [apply]` against the
+// configured datastore.
+func runMigrate(database *sql.DB, useDB string, args []string) {
+	if len(args) < 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp(database, useDB)
+		for _, v := range applied {
+			fmt.Printf("applied %04d\n", v)
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatal(migrateUsage)
+			}
+			steps = n
+		}
+		reverted, err := store.MigrateDown(database, useDB, steps)
+		for _, v := range reverted {
+			fmt.Printf("reverted %04d\n", v)
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	case "status":
+		states, err := store.MigrationStatus(database, useDB)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.Applied {
+				applied = "applied " + st.AppliedAt
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, applied)
+		}
+	case "normalize":
+		// a report unless told to apply it
+		apply := len(args) > 1 && args[1] == "apply"
+		renames, collisions, err := store.NormalizeKeys(database, useDB, apply)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		verb := "would rename"
+		if apply {
+			verb = "renamed"
+		}
+		for _, r := range renames {
+			fmt.Printf("%s %s to %s\n", verb, r.From, r.To)
+		}
+		for _, c := range collisions {
+			fmt.Printf("collision %s: %s\n", c.Key, strings.Join(c.Keys, " "))
+		}
+		if len(renames) == 0 && len(collisions) == 0 {
+			fmt.Println("keys are normalized")
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
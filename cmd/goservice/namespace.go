@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+// namespaces responds to GET /api/namespaces with every namespace and its owning team.
+func namespaces(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Namespaces()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK, Namespaces: list})
+	w.Write(resp)
+}
+
+// addNamespace handles POST /api/namespaces with a body of {"name": ..., "team": ...}.  Only
+// admins may create namespaces.
+func addNamespace(w http.ResponseWriter, r *http.Request) {
+	if !doAuthCheck(r) {
+		http.Error(w, "You must be authenticated", http.StatusInternalServerError)
+		return
+	}
+	var body routes.Namespace
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ns, err := routes.NewNamespace(body.Name, body.Team, currentUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.AddNamespace(ns)
+	if s.IsSQLErrDuplicateContraint(err) {
+		http.Error(w, fmt.Sprintf("Namespace %s already exists", ns.Name), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, ns.Name, http.StatusOK)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK})
+	w.Write(resp)
+}
+
+// deleteNamespace handles DELETE /api/namespaces/{name} for a namespace with no keys left.
+func deleteNamespace(w http.ResponseWriter, r *http.Request) {
+	if !doAuthCheck(r) {
+		http.Error(w, "You must be authenticated", http.StatusInternalServerError)
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	err := s.DeleteNamespace(name, currentUser(r))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, name, http.StatusOK)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK})
+	w.Write(resp)
+}
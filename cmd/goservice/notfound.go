@@ -0,0 +1,83 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var notFoundTemplate = template.Must(template.ParseFS(templateFS, "templates/notfound.html"))
+
+// maxSuggestions caps the "did you mean" list on the not found page.
+const maxSuggestions = 5
+
+// notFound answers a request for the missing key k with a page suggesting the closest
+// existing keys and a form to create k.
+func notFound(w http.ResponseWriter, r *http.Request, k string) {
+	keys, err := s.Keys()
+	if err != nil {
+		// still worth offering the form
+		log.Printf("Could not load suggestions for %s: %s", k, err.Error())
+	}
+	var suggestions []routes.Route
+	for _, key := range routes.Suggest(k, keys, maxSuggestions) {
+		// one may have gone since the keys were listed
+		if route, err := s.Get(key); err == nil {
+			suggestions = append(suggestions, route)
+		}
+	}
+
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	err = notFoundTemplate.Execute(w, struct {
+		Key         string
+		User        string
+		Suggestions []routes.Route
+	}{k, currentUser(r), suggestions})
+	if err != nil {
+		log.Printf("Could not render not found page for %s: %s", k, err.Error())
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, "", http.StatusNotFound)
+}
+
+// addForm handles POST /add from the create form on the not found page, then sends the
+// browser on to the new link.
+func addForm(w http.ResponseWriter, r *http.Request) {
+	if !doAuthCheck(r) {
+		http.Error(w, "You must be authenticated", http.StatusInternalServerError)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	creator := currentUser(r)
+	if creator == "" {
+		creator = strings.TrimSpace(r.PostForm.Get("creator"))
+	}
+	route, err := routes.NewRoute(strings.TrimSpace(r.PostForm.Get("shortkey")), strings.TrimSpace(r.PostForm.Get("url")), creator, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.Add(route)
+	if s.IsSQLErrDuplicateContraint(err) {
+		http.Error(w, fmt.Sprintf("go/%s already exists", route.ShortKey), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, route.ShortKey, http.StatusSeeOther)
+	http.Redirect(w, r, "/"+route.ShortKey, http.StatusSeeOther)
+}
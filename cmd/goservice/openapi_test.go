@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// pathVarRegexp matches the pattern part of a mux path variable, {key:.+} being {key} in
+// the spec.
+var pathVarRegexp = regexp.MustCompile(`\{([^:}]+):[^}]*\}`)
+
+func TestOpenAPICoversRouter(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON, %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %s", spec.OpenAPI)
+	}
+
+	registered := make(map[string]bool)
+	err := newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			// a subrouter, its own routes are walked next
+			return nil
+		}
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("Route %s has no methods", tmpl)
+			return nil
+		}
+		path := pathVarRegexp.ReplaceAllString(tmpl, "{$1}")
+		registered[path] = true
+		for _, m := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(m)]; !ok {
+				t.Errorf("%s %s is registered but missing from openapi.json", m, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stale []string
+	for path := range spec.Paths {
+		if !registered[path] {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+	if len(stale) > 0 {
+		t.Errorf("openapi.json describes paths that are not registered %v", stale)
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("content-type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %s", ct)
+	}
+}
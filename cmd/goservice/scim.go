@@ -0,0 +1,824 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+// SCIM 2.0 (RFC 7643 and 7644) lets the identity provider create, update and deactivate
+// users ahead of their first visit, and keep teams in step with its groups.  Every group is
+// a team: its displayName goes through scimTeams to the team's name, and members of the
+// teams in scimAdminTeams are admins.  Users are never deleted, since links point at them,
+// so deleting one deactivates it.  Only admins, usually through an API token with the admin
+// scope, may call these endpoints, and errors come back in SCIM's own format rather than
+// as a MsgReturn.
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// scimTeams maps group displayNames, lowercased, to team names.  Groups missing from it
+// keep their displayName as the team's name.
+var scimTeams map[string]string
+
+// scimAdminTeams are the teams whose members are admins.
+var scimAdminTeams []string
+
+// scimFilterRegexp matches the one kind of filter identity providers send, attr eq "value".
+var scimFilterRegexp = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+"([^"]*)"\s*$`)
+
+// scimMemberPathRegexp matches a path picking out one member, members[value eq "id"].
+var scimMemberPathRegexp = regexp.MustCompile(`(?i)^\s*members\s*\[\s*value\s+eq\s+"([^"]*)"\s*\]\s*$`)
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Active   *bool       `json:"active,omitempty"`
+	Emails   []scimEmail `json:"emails,omitempty"`
+	Meta     *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+type scimList struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// scimPatch is a PatchOp request.  Values are left raw as their shape depends on the path.
+type scimPatch struct {
+	Operations []struct {
+		Op    string
+		Path  string
+		Value json.RawMessage
+	}
+}
+
+// writeSCIM sends v as SCIM JSON with the status code.
+func writeSCIM(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("content-type", "application/scim+json")
+	w.WriteHeader(code)
+	resp, _ := json.Marshal(v)
+	w.Write(resp)
+}
+
+// scimError sends a SCIM error, with scimType when the RFC has one for the problem.
+func scimError(w http.ResponseWriter, code int, scimType string, detail string) {
+	writeSCIM(w, code, map[string]interface{}{
+		"schemas":  []string{scimErrorSchema},
+		"status":   strconv.Itoa(code),
+		"scimType": scimType,
+		"detail":   detail,
+	})
+}
+
+// scimStoreError sends err from the store as a SCIM error.
+func scimStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		scimError(w, http.StatusNotFound, "", err.Error())
+	case errors.Is(err, store.ErrForbidden):
+		scimError(w, http.StatusForbidden, "", err.Error())
+	default:
+		scimError(w, http.StatusBadRequest, "", err.Error())
+	}
+}
+
+// scimAdmin returns the admin making the request, sending a SCIM error for anyone else.
+func scimAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := currentUser(r)
+	if user == "" {
+		scimError(w, http.StatusUnauthorized, "", "You must be authenticated")
+		return "", false
+	}
+	u, err := s.GetUser(user)
+	if err != nil {
+		scimStoreError(w, err)
+		return "", false
+	}
+	if u.IsAdmin != 1 {
+		scimError(w, http.StatusForbidden, "", fmt.Sprintf("%s is not an admin", user))
+		return "", false
+	}
+	return user, true
+}
+
+// scimLocation is the URL of the resource id of kind, Users or Groups.
+func scimLocation(r *http.Request, kind string, id int) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%d", scheme, r.Host, kind, id)
+}
+
+// scimID reads the {id} of the request, sending a 404 when it cannot be one.
+func scimID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", fmt.Sprintf("No resource %s", mux.Vars(r)["id"]))
+		return 0, false
+	}
+	return id, true
+}
+
+// scimFilter reads ?filter=, which may only be attr eq "value" for attr, returning the
+// value and whether there was a filter.
+func scimFilter(w http.ResponseWriter, r *http.Request, attr string) (string, bool, bool) {
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		return "", false, true
+	}
+	m := scimFilterRegexp.FindStringSubmatch(filter)
+	if m == nil || !strings.EqualFold(m[1], attr) {
+		scimError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("Only %s eq \"...\" filters are supported", attr))
+		return "", false, false
+	}
+	return m[2], true, true
+}
+
+// writeSCIMList sends the page of resources ?startIndex= and ?count= ask for.
+func writeSCIMList(w http.ResponseWriter, r *http.Request, resources []interface{}) {
+	start, count := 1, len(resources)
+	if v, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && v > 1 {
+		start = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && v >= 0 {
+		count = v
+	}
+	page := make([]interface{}, 0)
+	for i := start - 1; i < len(resources) && len(page) < count; i++ {
+		page = append(page, resources[i])
+	}
+	writeSCIM(w, http.StatusOK, scimList{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// scimBool reads a boolean value, which some providers send as the string "True".
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, fmt.Errorf("Expected a boolean, got %s", raw)
+	}
+	return strconv.ParseBool(s)
+}
+
+// scimServiceProviderConfig handles GET /scim/v2/ServiceProviderConfig, what of SCIM we do.
+func scimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	unsupported := map[string]bool{"supported": false}
+	writeSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": 1000},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "API token",
+			"description": "An API token with the admin scope, minted by an admin",
+			"primary":     true,
+		}},
+	})
+}
+
+// toSCIMUser has u as a SCIM user.
+func toSCIMUser(r *http.Request, u *store.User) scimUser {
+	active := u.Deactivated != 1
+	return scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       strconv.Itoa(u.ID),
+		UserName: u.Name,
+		Active:   &active,
+		Emails:   []scimEmail{{Value: u.Name, Type: "work", Primary: true}},
+		Meta:     &scimMeta{ResourceType: "User", Location: scimLocation(r, "Users", u.ID)},
+	}
+}
+
+// scimListUsers handles GET /scim/v2/Users, every user or with ?filter=userName eq "..."
+// the one with that name.
+func scimListUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := scimAdmin(w, r); !ok {
+		return
+	}
+	name, filtered, ok := scimFilter(w, r, "userName")
+	if !ok {
+		return
+	}
+	resources := make([]interface{}, 0)
+	if filtered {
+		u, err := s.FindUser(name)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			scimStoreError(w, err)
+			return
+		}
+		if err == nil {
+			resources = append(resources, toSCIMUser(r, u))
+		}
+	} else {
+		users, err := s.AllUsers()
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		for i := range users {
+			resources = append(resources, toSCIMUser(r, &users[i]))
+		}
+	}
+	writeSCIMList(w, r, resources)
+}
+
+// scimCreateUser handles POST /scim/v2/Users, creating the user ahead of their first visit.
+func scimCreateUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	var body scimUser
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if err := routes.IsValidUser(body.UserName); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if _, err := s.FindUser(body.UserName); err == nil {
+		scimError(w, http.StatusConflict, "uniqueness", fmt.Sprintf("User %s already exists", body.UserName))
+		return
+	}
+	u, err := s.GetUser(body.UserName)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	if body.Active != nil && !*body.Active {
+		if u, err = s.SetDeactivated(u.Name, true, admin); err != nil {
+			scimStoreError(w, err)
+			return
+		}
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, u.Name, http.StatusCreated)
+	resp := toSCIMUser(r, u)
+	w.Header().Set("Location", resp.Meta.Location)
+	writeSCIM(w, http.StatusCreated, resp)
+}
+
+// scimUserByID returns the user of the request's {id}, sending a SCIM error when there is
+// none.
+func scimUserByID(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return nil, false
+	}
+	u, err := s.UserByID(id)
+	if err != nil {
+		scimStoreError(w, err)
+		return nil, false
+	}
+	return u, true
+}
+
+// scimGetUser handles GET /scim/v2/Users/{id}.
+func scimGetUser(w http.ResponseWriter, r *http.Request) {
+	if _, ok := scimAdmin(w, r); !ok {
+		return
+	}
+	u, ok := scimUserByID(w, r)
+	if !ok {
+		return
+	}
+	writeSCIM(w, http.StatusOK, toSCIMUser(r, u))
+}
+
+// scimUpdateUser deactivates or reactivates u as active says, and sends the result.  Users
+// cannot be renamed, as their name is who they are everywhere else.
+func scimUpdateUser(w http.ResponseWriter, r *http.Request, admin string, u *store.User, userName string, active *bool) {
+	if userName != "" && userName != u.Name {
+		scimError(w, http.StatusBadRequest, "mutability", fmt.Sprintf("User %s cannot be renamed to %s", u.Name, userName))
+		return
+	}
+	if active != nil && *active != (u.Deactivated != 1) {
+		var err error
+		if u, err = s.SetDeactivated(u.Name, !*active, admin); err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, u.Name, http.StatusOK)
+	}
+	writeSCIM(w, http.StatusOK, toSCIMUser(r, u))
+}
+
+// scimPutUser handles PUT /scim/v2/Users/{id}, replacing what there is to replace of a
+// user, whether they are active.
+func scimPutUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	u, ok := scimUserByID(w, r)
+	if !ok {
+		return
+	}
+	var body scimUser
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	scimUpdateUser(w, r, admin, u, body.UserName, body.Active)
+}
+
+// scimPatchUser handles PATCH /scim/v2/Users/{id}.  Of a user's attributes only active is
+// kept, set either by path or as part of a value object; the rest are ignored.
+func scimPatchUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	u, ok := scimUserByID(w, r)
+	if !ok {
+		return
+	}
+	var body scimPatch
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	var userName string
+	var active *bool
+	for _, op := range body.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			continue
+		default:
+			scimError(w, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unknown op %s", op.Op))
+			return
+		}
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+		for attr, raw := range values {
+			switch strings.ToLower(attr) {
+			case "active":
+				b, err := scimBool(raw)
+				if err != nil {
+					scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+					return
+				}
+				active = &b
+			case "username":
+				if err := json.Unmarshal(raw, &userName); err != nil {
+					scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+					return
+				}
+			}
+		}
+	}
+	scimUpdateUser(w, r, admin, u, userName, active)
+}
+
+// scimDeleteUser handles DELETE /scim/v2/Users/{id}, which deactivates the user.
+func scimDeleteUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	u, ok := scimUserByID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.SetDeactivated(u.Name, true, admin); err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, u.Name, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimTeamName is the team a group's displayName stands for.
+func scimTeamName(displayName string) string {
+	if team, ok := scimTeams[strings.ToLower(displayName)]; ok {
+		return team
+	}
+	return displayName
+}
+
+// isAdminTeam is whether members of team are admins.
+func isAdminTeam(team string) bool {
+	for _, t := range scimAdminTeams {
+		if strings.EqualFold(t, team) {
+			return true
+		}
+	}
+	return false
+}
+
+// toSCIMGroup has t as a SCIM group, its members by user id.
+func toSCIMGroup(r *http.Request, t store.Team) (scimGroup, error) {
+	g := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          strconv.Itoa(t.ID),
+		DisplayName: t.Name,
+		Members:     make([]scimMember, 0, len(t.Members)),
+		Meta:        &scimMeta{ResourceType: "Group", Location: scimLocation(r, "Groups", t.ID)},
+	}
+	for _, m := range t.Members {
+		u, err := s.FindUser(m.User)
+		if err != nil {
+			return scimGroup{}, err
+		}
+		g.Members = append(g.Members, scimMember{Value: strconv.Itoa(u.ID), Display: u.Name})
+	}
+	return g, nil
+}
+
+// writeSCIMGroup sends the team name as a group.
+func writeSCIMGroup(w http.ResponseWriter, r *http.Request, code int, name string) {
+	t, err := s.Team(name)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	g, err := toSCIMGroup(r, t)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	if code == http.StatusCreated {
+		w.Header().Set("Location", g.Meta.Location)
+	}
+	writeSCIM(w, code, g)
+}
+
+// scimMemberNames resolves the user ids of members to names.
+func scimMemberNames(members []scimMember) ([]string, error) {
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w, no user %s", store.ErrNotFound, m.Value)
+		}
+		u, err := s.UserByID(id)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, u.Name)
+	}
+	return names, nil
+}
+
+// addSCIMMembers puts users in the team, leaving those already in it, managers included,
+// as they are.  Joining an admin team makes them admins.
+func addSCIMMembers(team store.Team, users []string, admin string) error {
+	all := make([]string, 0, len(team.Members)+len(users))
+	for _, m := range team.Members {
+		all = append(all, m.User)
+	}
+	return replaceSCIMMembers(team, append(all, users...), admin)
+}
+
+// removeSCIMMembers takes users out of the team.  Leaving an admin team stops them being
+// an admin, unless they are still in another one.
+func removeSCIMMembers(team store.Team, users []string, admin string) error {
+	gone := make(map[string]bool, len(users))
+	for _, user := range users {
+		gone[user] = true
+	}
+	var keep []string
+	for _, m := range team.Members {
+		if !gone[m.User] {
+			keep = append(keep, m.User)
+		}
+	}
+	return replaceSCIMMembers(team, keep, admin)
+}
+
+// dropAdmin takes away the admin role user had from being in the admin team left, unless
+// another admin team still gives it to them.
+func dropAdmin(user string, left string) error {
+	if !isAdminTeam(left) {
+		return nil
+	}
+	teams, err := s.Teams(user)
+	if err != nil {
+		return err
+	}
+	for _, t := range teams {
+		if t != left && isAdminTeam(t) {
+			return nil
+		}
+	}
+	_, err = s.SetAdmin(user, false)
+	return err
+}
+
+// scimListGroups handles GET /scim/v2/Groups, every team or with
+// ?filter=displayName eq "..." the one the group stands for.
+func scimListGroups(w http.ResponseWriter, r *http.Request) {
+	if _, ok := scimAdmin(w, r); !ok {
+		return
+	}
+	displayName, filtered, ok := scimFilter(w, r, "displayName")
+	if !ok {
+		return
+	}
+	var names []string
+	if filtered {
+		names = append(names, scimTeamName(displayName))
+	} else {
+		teams, err := s.AllTeams()
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		for _, t := range teams {
+			names = append(names, t.Name)
+		}
+	}
+	resources := make([]interface{}, 0)
+	for _, name := range names {
+		t, err := s.Team(name)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		g, err := toSCIMGroup(r, t)
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		resources = append(resources, g)
+	}
+	writeSCIMList(w, r, resources)
+}
+
+// scimCreateGroup handles POST /scim/v2/Groups, creating the team the group stands for
+// with the group's members and no managers.
+func scimCreateGroup(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	var body scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	name := scimTeamName(body.DisplayName)
+	if err := routes.IsValidTeam(name); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("%s, map group %s to a team in scim.teams.map", err, body.DisplayName))
+		return
+	}
+	if _, err := s.Team(name); err == nil {
+		scimError(w, http.StatusConflict, "uniqueness", fmt.Sprintf("Team %s already exists", name))
+		return
+	}
+	members, err := scimMemberNames(body.Members)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	// the team and its members come together, so a failure leaves nothing to retry around
+	t, err := s.SetTeamMembers(store.Team{Name: name}, members, isAdminTeam, admin)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusCreated)
+	writeSCIMGroup(w, r, http.StatusCreated, t.Name)
+}
+
+// scimTeamByID returns the team of the request's {id}, sending a SCIM error when there is
+// none.
+func scimTeamByID(w http.ResponseWriter, r *http.Request) (store.Team, bool) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return store.Team{}, false
+	}
+	t, err := s.TeamByID(id)
+	if err != nil {
+		scimStoreError(w, err)
+		return store.Team{}, false
+	}
+	return t, true
+}
+
+// scimGetGroup handles GET /scim/v2/Groups/{id}.
+func scimGetGroup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := scimAdmin(w, r); !ok {
+		return
+	}
+	t, ok := scimTeamByID(w, r)
+	if !ok {
+		return
+	}
+	writeSCIMGroup(w, r, http.StatusOK, t.Name)
+}
+
+// checkSCIMRename refuses to change the team t stands for, as links refer to it by name.
+func checkSCIMRename(w http.ResponseWriter, t store.Team, displayName string) bool {
+	if displayName != "" && scimTeamName(displayName) != t.Name {
+		scimError(w, http.StatusBadRequest, "mutability", fmt.Sprintf("Team %s cannot be renamed to %s", t.Name, scimTeamName(displayName)))
+		return false
+	}
+	return true
+}
+
+// replaceSCIMMembers makes the team's members exactly users, all at once so that a
+// failure leaves the team as it was.
+func replaceSCIMMembers(t store.Team, users []string, admin string) error {
+	_, err := s.SetTeamMembers(t, users, isAdminTeam, admin)
+	return err
+}
+
+// scimPutGroup handles PUT /scim/v2/Groups/{id}, replacing the team's members.
+func scimPutGroup(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	t, ok := scimTeamByID(w, r)
+	if !ok {
+		return
+	}
+	var body scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if !checkSCIMRename(w, t, body.DisplayName) {
+		return
+	}
+	members, err := scimMemberNames(body.Members)
+	if err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	if err := replaceSCIMMembers(t, members, admin); err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusOK)
+	writeSCIMGroup(w, r, http.StatusOK, t.Name)
+}
+
+// scimPatchGroup handles PATCH /scim/v2/Groups/{id}, adding, removing or replacing the
+// team's members.
+func scimPatchGroup(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	t, ok := scimTeamByID(w, r)
+	if !ok {
+		return
+	}
+	var body scimPatch
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	for _, op := range body.Operations {
+		var err error
+		// each operation sees what the ones before it did
+		if t, err = s.Team(t.Name); err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		var group scimGroup
+		switch {
+		case scimMemberPathRegexp.MatchString(op.Path):
+			group.Members = []scimMember{{Value: scimMemberPathRegexp.FindStringSubmatch(op.Path)[1]}}
+		case strings.EqualFold(op.Path, "members"):
+			err = json.Unmarshal(op.Value, &group.Members)
+		case strings.EqualFold(op.Path, "displayName"):
+			err = json.Unmarshal(op.Value, &group.DisplayName)
+		case op.Path == "":
+			err = json.Unmarshal(op.Value, &group)
+		default:
+			scimError(w, http.StatusBadRequest, "invalidPath", fmt.Sprintf("Unknown path %s", op.Path))
+			return
+		}
+		if err != nil && !(strings.EqualFold(op.Op, "remove") && len(op.Value) == 0) {
+			scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		if !checkSCIMRename(w, t, group.DisplayName) {
+			return
+		}
+		members, err := scimMemberNames(group.Members)
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+		switch strings.ToLower(op.Op) {
+		case "add":
+			err = addSCIMMembers(t, members, admin)
+		case "remove":
+			if len(members) == 0 && strings.EqualFold(op.Path, "members") {
+				// no value takes everyone out
+				for _, m := range t.Members {
+					members = append(members, m.User)
+				}
+			}
+			err = removeSCIMMembers(t, members, admin)
+		case "replace":
+			if group.Members != nil {
+				err = replaceSCIMMembers(t, members, admin)
+			}
+		default:
+			scimError(w, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unknown op %s", op.Op))
+			return
+		}
+		if err != nil {
+			scimStoreError(w, err)
+			return
+		}
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusOK)
+	writeSCIMGroup(w, r, http.StatusOK, t.Name)
+}
+
+// scimDeleteGroup handles DELETE /scim/v2/Groups/{id}, deleting the team, which has to
+// own no links or namespaces by then.
+func scimDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	admin, ok := scimAdmin(w, r)
+	if !ok {
+		return
+	}
+	t, ok := scimTeamByID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.DeleteTeam(t.Name, admin); err != nil {
+		scimStoreError(w, err)
+		return
+	}
+	for _, m := range t.Members {
+		if err := dropAdmin(m.User, t.Name); err != nil {
+			scimStoreError(w, err)
+			return
+		}
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/tcotav/golinks/auth"
+)
+
+// scimExchange is one request of a recorded SCIM client conversation and the response we
+// expect, of which only the fields given are compared.
+type scimExchange struct {
+	Comment string
+	Request struct {
+		Method string
+		Path   string
+		Body   json.RawMessage
+	}
+	Response struct {
+		Status int
+		Body   interface{}
+	}
+}
+
+// jsonContains is whether got has everything in want.  Arrays have to be as long as each
+// other, their elements compared in order.
+func jsonContains(want interface{}, got interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !jsonContains(v, g[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !jsonContains(w[i], g[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+func TestSCIMConversation(t *testing.T) {
+	useTestStore(t)
+	saved, savedTeams, savedAdminTeams := authenticator, scimTeams, scimAdminTeams
+	defer func() { authenticator, scimTeams, scimAdminTeams = saved, savedTeams, savedAdminTeams }()
+	authenticator = &auth.HeaderAuthenticator{Header: userAuthHeader}
+	// as viper has them, keys lowercased
+	scimTeams = map[string]string{"payments": "payments@example.com", "golinks admins": "admins@example.com"}
+	scimAdminTeams = []string{"admins@example.com"}
+	if _, err := s.SetAdmin("admin@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter()
+
+	recorded, err := ioutil.ReadFile("testdata/scim_conversation.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conversation []scimExchange
+	if err := json.Unmarshal(recorded, &conversation); err != nil {
+		t.Fatal(err)
+	}
+	for i, ex := range conversation {
+		name := fmt.Sprintf("#%d %s %s", i, ex.Request.Method, ex.Request.Path)
+		r := httptest.NewRequest(ex.Request.Method, ex.Request.Path, bytes.NewReader(ex.Request.Body))
+		r.Header.Set(userAuthHeader, "admin@example.com")
+		r.Header.Set("Content-Type", "application/scim+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != ex.Response.Status {
+			t.Fatalf("%s: expected %d, got %d %s", name, ex.Response.Status, w.Code, w.Body)
+		}
+		if ex.Response.Body == nil {
+			continue
+		}
+		if ct := w.Header().Get("content-type"); ct != "application/scim+json" {
+			t.Errorf("%s: unexpected content type %s", name, ct)
+		}
+		var got interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v in %s", name, err, w.Body)
+		}
+		if !jsonContains(ex.Response.Body, got) {
+			t.Errorf("%s: expected %v in %s", name, ex.Response.Body, w.Body)
+		}
+	}
+
+	jane, err := s.FindUser("jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jane.IsAdmin != 0 || jane.Deactivated != 0 {
+		t.Errorf("Expected jane active and, with the admin team gone, no admin, got %+v", jane)
+	}
+	if teams, err := s.Teams("jane@example.com"); err != nil || !reflect.DeepEqual(teams, []string{"payments@example.com"}) {
+		t.Errorf("Unexpected teams of jane %v (err %v)", teams, err)
+	}
+	bob, err := s.FindUser("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.IsAdmin != 0 || bob.Deactivated != 1 {
+		t.Errorf("Expected bob deactivated and no admin, got %+v", bob)
+	}
+
+	// only admins provision
+	r := httptest.NewRequest("GET", "/scim/v2/Users", nil)
+	r.Header.Set(userAuthHeader, "jane@example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", w.Code)
+	}
+}
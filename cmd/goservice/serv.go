@@ -3,17 +3,23 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	// database driver for sql package
 	"github.com/go-redis/redis"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/viper"
+	"github.com/tcotav/golinks/auth"
 	"github.com/tcotav/golinks/routes"
 	"github.com/tcotav/golinks/store"
 )
@@ -30,40 +36,69 @@ const userAuthHeader = "UserNameAuth"
 type MsgReturn struct {
 	ReturnCode int
 	Routes     []routes.Route
+	Revisions  []store.Revision     `json:",omitempty"`
+	Namespaces []routes.Namespace   `json:",omitempty"`
+	Users      []store.User         `json:",omitempty"`
+	Imported   []store.ImportResult `json:",omitempty"`
+	Tokens     []store.APIToken     `json:",omitempty"`
+	Editors    []string             `json:",omitempty"`
+	Teams      []store.Team         `json:",omitempty"`
 	Message    string
 }
 
 func doAuthCheck(r *http.Request) bool {
 	if authRequired {
-		user := r.Header.Get(userAuthHeader)
-		if user == "" {
-			return false
-		}
+		return currentUser(r) != ""
 	}
 	return true
 }
 
-func edit(w http.ResponseWriter, r *http.Request) {
-	user := r.Header.Get(userAuthHeader)
+// legacyUser returns who is making a change through the legacy endpoints, sending a 401 if
+// nobody is.  Even without authrequired a change needs someone to own it, or every
+// anonymous caller would share the links.
+func legacyUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := currentUser(r)
+	if user == "" {
+		http.Error(w, "You must be authenticated", http.StatusUnauthorized)
+		return "", false
+	}
+	return user, true
+}
 
-	if !doAuthCheck(r) {
-		http.Error(w, "You must be authenticated", http.StatusInternalServerError)
+func edit(w http.ResponseWriter, r *http.Request) {
+	user, ok := legacyUser(w, r)
+	if !ok {
 		return
 	}
 	var route routes.Route
-	// what to do in the case of conflict?
+	// the revision in the body guards against clobbering someone else's edit
 	err := json.NewDecoder(r.Body).Decode(&route)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if route.Revision == 0 {
+		http.Error(w, "Send the link's revision in the body", http.StatusPreconditionRequired)
+		return
+	}
 
-	route.Creator = user
+	// who is changing the link comes from who signed in, never from the body
 	route.LastModifiedBy = user
 
 	// process and handle
-	_, err = s.Add(route)
-	// check if err is a duplicate constraint
+	_, err = s.Modify(route)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, store.ErrForbidden) || errors.Is(err, store.ErrLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -78,8 +113,8 @@ func edit(w http.ResponseWriter, r *http.Request) {
 }
 
 func add(w http.ResponseWriter, r *http.Request) {
-	if !doAuthCheck(r) {
-		http.Error(w, "You must be authenticated", http.StatusInternalServerError)
+	user, ok := legacyUser(w, r)
+	if !ok {
 		return
 	}
 	var route routes.Route
@@ -89,6 +124,9 @@ func add(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// owning a link grants changing it, so the owner is who signed in, never the body
+	route.Creator = user
+	route.LastModifiedBy = user
 	// process and handle
 	_, err = s.Add(route)
 	// check if err is a duplicate constraint
@@ -140,22 +178,54 @@ func delete(w http.ResponseWriter, r *http.Request) {
 
 const randomStr = "random"
 
-//
-// get is the main function -- responding to http://go/<key> with a redirect to the desired page
+// get is the main function -- responding to http://go/<key> with a redirect to the desired page.
+// Any path segments after the key and the query string fill in templated links, and what
+// is left over is passed through to the target according to the link's passthrough mode.
 func get(w http.ResponseWriter, r *http.Request) {
-	// format /{secretname}
+	// format /{secretname}[/{args}]
 	vars := mux.Vars(r)
 	shortKey, ok := vars["short_key"]
 	if !ok {
 		http.Error(w, "Invalid url format", http.StatusInternalServerError)
 		return
 	}
+	var args []string
+	for _, a := range strings.Split(vars["args"], "/") {
+		if a != "" {
+			args = append(args, a)
+		}
+	}
 
-	// easter egg -- shortKey == random
-	URL, err := s.GetURL(shortKey)
+	path := strings.Join(append([]string{shortKey}, args...), "/")
+
+	var route routes.Route
+	var err error
+	if routes.NormalizeKey(shortKey) == randomStr {
+		// easter egg -- go/random goes to any link at all
+		route, err = s.Random()
+	} else {
+		// keys may be namespaced, so the longest key that prefixes the path wins
+		route, args, err = s.LookupPrefix(path)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		notFound(w, r, path)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, URL, http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, "", http.StatusInternalServerError)
+		return
+	}
+	route = pickTarget(r, route)
+	URL, err := route.Resolve(args, r.URL.Query())
+	if err != nil {
+		// a strict link has no page for anything after its key
+		code := http.StatusBadRequest
+		if errors.Is(err, routes.ErrUnexpectedArgs) {
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, route.URL, code)
 		return
 	}
 
@@ -165,7 +235,11 @@ func get(w http.ResponseWriter, r *http.Request) {
 }
 
 func delete(w http.ResponseWriter, r *http.Request) {
-	// format /{secretname}
+	user, ok := legacyUser(w, r)
+	if !ok {
+		return
+	}
+	// format /delete/{short_key}
 	vars := mux.Vars(r)
 	shortKey, ok := vars["short_key"]
 	if !ok {
@@ -174,10 +248,14 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// easter egg -- shortKey == random
-	err := s.Delete(shortKey)
+	err := s.Delete(shortKey, user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, shortKey, http.StatusNotFound)
+		code := http.StatusNotFound
+		if errors.Is(err, store.ErrForbidden) || errors.Is(err, store.ErrLocked) {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, shortKey, code)
 		return
 	}
 
@@ -189,11 +267,141 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-var s *store.DataStore
+// history responds to /api/history/{short_key} with every revision of the key.
+func history(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortKey, ok := vars["short_key"]
+	if !ok {
+		http.Error(w, "Invalid url format", http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := s.History(shortKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK, Revisions: revisions})
+	w.Write(resp)
+}
+
+// restore rolls /api/history/{short_key}/restore/{revision} back to that revision,
+// recreating the key if it has been deleted.
+func restore(w http.ResponseWriter, r *http.Request) {
+	user, ok := legacyUser(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	shortKey := vars["short_key"]
+	revision, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.Restore(shortKey, revision, user)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrForbidden) || errors.Is(err, store.ErrLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, shortKey, http.StatusOK)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK})
+	w.Write(resp)
+}
+
+// newRouter wires up every handler.  The catch-all shortlink routes go last so they do not
+// shadow the rest.
+func newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(identify)
+	r.HandleFunc("/add", addForm).Methods("POST")
+	r.HandleFunc("/add/{secret}", add).Methods("POST")
+	r.HandleFunc("/edit/{secret}", edit).Methods("POST", "PUT")
+	// keys may contain "/", so match them with .+
+	r.HandleFunc("/delete/{short_key:.+}", delete).Methods("POST", "DELETE")
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/links", apiListLinks).Methods("GET")
+	api.HandleFunc("/links", apiCreateLink).Methods("POST")
+	api.HandleFunc("/links/{key:.+}/lock", requireScope(store.ScopeAdmin, apiLockLink)).Methods("POST")
+	api.HandleFunc("/links/{key:.+}/lock", requireScope(store.ScopeAdmin, apiUnlockLink)).Methods("DELETE")
+	api.HandleFunc("/links/{key:.+}/editors", apiListEditors).Methods("GET")
+	api.HandleFunc("/links/{key:.+}/editors", apiAddEditor).Methods("POST")
+	api.HandleFunc("/links/{key:.+}/editors/{user}", apiRemoveEditor).Methods("DELETE")
+	api.HandleFunc("/links/{key:.+}", apiGetLink).Methods("GET")
+	api.HandleFunc("/links/{key:.+}", apiPutLink).Methods("PUT")
+	api.HandleFunc("/links/{key:.+}", apiPatchLink).Methods("PATCH")
+	api.HandleFunc("/links/{key:.+}", apiDeleteLink).Methods("DELETE")
+	api.HandleFunc("/users/me", apiCurrentUser).Methods("GET")
+	api.HandleFunc("/users/me/team-links", apiTeamLinks).Methods("GET")
+	api.HandleFunc("/users/{name}/admin", requireScope(store.ScopeAdmin, apiMakeAdmin)).Methods("POST")
+	api.HandleFunc("/users/{name}/deactivate", requireScope(store.ScopeAdmin, apiSetDeactivated)).Methods("POST", "DELETE")
+	api.HandleFunc("/users/{name}/transfer", requireScope(store.ScopeAdmin, apiTransferLinks)).Methods("POST")
+	api.HandleFunc("/orphaned-links", requireScope(store.ScopeAdmin, apiOrphanedLinks)).Methods("GET")
+	api.HandleFunc("/teams", apiListTeams).Methods("GET")
+	api.HandleFunc("/teams", apiCreateTeam).Methods("POST")
+	api.HandleFunc("/teams/{team}", apiGetTeam).Methods("GET")
+	api.HandleFunc("/teams/{team}", apiPatchTeam).Methods("PATCH")
+	api.HandleFunc("/teams/{team}", apiDeleteTeam).Methods("DELETE")
+	api.HandleFunc("/teams/{team}/members/{user}", apiPutTeamMember).Methods("PUT")
+	api.HandleFunc("/teams/{team}/members/{user}", apiRemoveTeamMember).Methods("DELETE")
+	api.HandleFunc("/tokens", apiListTokens).Methods("GET")
+	api.HandleFunc("/tokens", apiCreateToken).Methods("POST")
+	api.HandleFunc("/tokens/{id:[0-9]+}", apiRevokeToken).Methods("DELETE")
+	api.HandleFunc("/export", apiExport).Methods("GET")
+	api.HandleFunc("/import", requireScope(store.ScopeAdmin, apiImport)).Methods("POST")
+	scim := r.PathPrefix("/scim/v2").Subrouter()
+	scim.HandleFunc("/ServiceProviderConfig", scimServiceProviderConfig).Methods("GET")
+	scim.HandleFunc("/Users", requireScope(store.ScopeAdmin, scimListUsers)).Methods("GET")
+	scim.HandleFunc("/Users", requireScope(store.ScopeAdmin, scimCreateUser)).Methods("POST")
+	scim.HandleFunc("/Users/{id}", requireScope(store.ScopeAdmin, scimGetUser)).Methods("GET")
+	scim.HandleFunc("/Users/{id}", requireScope(store.ScopeAdmin, scimPutUser)).Methods("PUT")
+	scim.HandleFunc("/Users/{id}", requireScope(store.ScopeAdmin, scimPatchUser)).Methods("PATCH")
+	scim.HandleFunc("/Users/{id}", requireScope(store.ScopeAdmin, scimDeleteUser)).Methods("DELETE")
+	scim.HandleFunc("/Groups", requireScope(store.ScopeAdmin, scimListGroups)).Methods("GET")
+	scim.HandleFunc("/Groups", requireScope(store.ScopeAdmin, scimCreateGroup)).Methods("POST")
+	scim.HandleFunc("/Groups/{id}", requireScope(store.ScopeAdmin, scimGetGroup)).Methods("GET")
+	scim.HandleFunc("/Groups/{id}", requireScope(store.ScopeAdmin, scimPutGroup)).Methods("PUT")
+	scim.HandleFunc("/Groups/{id}", requireScope(store.ScopeAdmin, scimPatchGroup)).Methods("PATCH")
+	scim.HandleFunc("/Groups/{id}", requireScope(store.ScopeAdmin, scimDeleteGroup)).Methods("DELETE")
+	r.HandleFunc("/api/openapi.json", openAPI).Methods("GET")
+	r.HandleFunc("/auth/login", oidcHandler((*auth.OIDC).Login)).Methods("GET")
+	r.HandleFunc("/auth/callback", oidcHandler((*auth.OIDC).Callback)).Methods("GET")
+	r.HandleFunc("/auth/logout", oidcHandler((*auth.OIDC).Logout)).Methods("GET", "POST")
+	r.HandleFunc("/api/history/{short_key:.+}/restore/{revision:[0-9]+}", restore).Methods("POST")
+	r.HandleFunc("/api/history/{short_key:.+}", history).Methods("GET")
+	r.HandleFunc("/api/trash", trash).Methods("GET")
+	r.HandleFunc("/api/trash/{short_key:.+}/restore", undelete).Methods("POST")
+	r.HandleFunc("/api/namespaces", namespaces).Methods("GET")
+	r.HandleFunc("/api/namespaces", requireScope(store.ScopeAdmin, addNamespace)).Methods("POST")
+	r.HandleFunc("/api/namespaces/{name:.+}", requireScope(store.ScopeAdmin, deleteNamespace)).Methods("DELETE")
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed", r.Method))
+	})
+	r.HandleFunc("/{short_key}", get).Methods("GET", "HEAD")
+	r.HandleFunc("/{short_key}/{args:.*}", get).Methods("GET", "HEAD")
+	return r
+}
+
+var s store.RouteStore
 var authRequired bool
 
-func main() {
-	var err error
+// loadConfig reads config.json from the usual search paths into viper.
+func loadConfig() {
 	viper.SetConfigName("config")         // name of config file (without extension)
 	viper.AddConfigPath("/etc/golinks/")  // path to look for the config file in
 	viper.AddConfigPath("$HOME/.golinks") // call multiple times to add many search paths
@@ -202,9 +410,20 @@ func main() {
 	viper.SetDefault("listenport", "8991")
 	viper.SetDefault("authrequired", true)
 	viper.SetDefault("datastore.use", "sqlite")
+	viper.SetDefault("datastore.automigrate", true)
 	viper.SetDefault("datastore.sqlite.drivername", "sqlite3")
 	viper.SetDefault("datastore.sqlite.path", "./testdb")
+	viper.SetDefault("datastore.postgres.drivername", "postgres")
 	viper.SetDefault("cache.redis.ttl", 21600)
+	viper.SetDefault("trash.retention", "720h")
+	viper.SetDefault("trash.purgeinterval", "1h")
+	viper.SetDefault("keys.ignorepunctuation", "-_.")
+	viper.SetDefault("auth.providers", []string{"header", "apitokens"})
+	viper.SetDefault("auth.header.name", userAuthHeader)
+	viper.SetDefault("auth.jwt.claim", "email")
+	viper.SetDefault("auth.oidc.scopes", []string{"email", "profile"})
+	viper.SetDefault("auth.oidc.claim", "email")
+	viper.SetDefault("auth.oidc.sessionttl", "12h")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -214,13 +433,17 @@ func main() {
 			// Config file was found but another error was produced
 		}
 	}
+	routes.IgnoredPunctuation = viper.GetString("keys.ignorepunctuation")
+	for name := range viper.GetStringMap("import.adapters") {
+		routes.Adapters[name] = routes.Mapping(viper.GetStringMapString("import.adapters." + name))
+	}
+}
 
-	listenAddress := viper.GetString("listenaddress")
-	listenPort := viper.GetString("listenport")
-	authRequired = viper.GetBool("authrequired")
-	useDB := viper.GetString("datastore.use")
-
+// openDatabase opens the configured datastore and returns the handle along with its db type.
+func openDatabase() (*sql.DB, string) {
 	var database *sql.DB
+	var err error
+	useDB := viper.GetString("datastore.use")
 
 	if useDB == "sqlite" {
 		driver := viper.GetString("datastore.sqlite.drivername")
@@ -237,35 +460,102 @@ func main() {
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+	} else if useDB == "postgres" {
+		driver := viper.GetString("datastore.postgres.drivername")
+		url := viper.GetString("datastore.postgres.url")
+		database, err = sql.Open(driver, url)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 	} else {
 		log.Fatal("Check config -- unknown db type set")
 	}
+	return database, useDB
+}
 
-	cacheType := viper.GetString("cache.use")
+// openStore builds the store over database along with the configured cache, which the
+// commands share with the server so that their changes are seen there.
+func openStore(database *sql.DB, useDB string) (store.RouteStore, error) {
 	ttl := -1
-
 	var redisClient *redis.Client
-	if cacheType == "remote" {
+	if viper.GetString("cache.use") == "remote" {
 		ttl = viper.GetInt("cache.redis.ttl")
 		redisClient = redis.NewClient(&redis.Options{
 			Addr:     viper.GetString("cache.redis.host"),
 			Password: viper.GetString("cache.redis.password"),
 		})
 	}
+	return store.GetStore(useDB, database, redisClient, ttl)
+}
+
+func main() {
+	var err error
+	loadConfig()
+	database, useDB := openDatabase()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(database, useDB, os.Args[2:])
+		return
+	}
+
+	if viper.GetBool("datastore.automigrate") {
+		applied, err := store.MigrateUp(database, useDB)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		for _, v := range applied {
+			log.Printf("Applied schema migration %04d", v)
+		}
+		// only report, keys are renamed by `goservice migrate normalize apply`
+		renames, collisions, err := store.NormalizeKeys(database, useDB, false)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		for _, r := range renames {
+			log.Printf("Key %s should be renamed to %s, run `goservice migrate normalize apply`", r.From, r.To)
+		}
+		for _, c := range collisions {
+			log.Printf("Keys %s all normalize to %s, rename all but one with `goservice migrate normalize`", strings.Join(c.Keys, ", "), c.Key)
+		}
+	}
 
-	s, err = store.GetStore(useDB, database, redisClient, ttl)
+	s, err = openStore(database, useDB)
 	if err != nil {
 		// kill process because we won't have a DB anyway
 		log.Fatal(err.Error())
 	}
 
-	r := mux.NewRouter()
-	r.HandleFunc("/{short_key}", get)
-	r.HandleFunc("/add/{secret}", add)
-	r.HandleFunc("/edit/{secret}", edit)
-	r.HandleFunc("/delete/{secret}", delete)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExport(os.Args[2:])
+		case "import":
+			runImport(os.Args[2:])
+		case "sync":
+			runSync(os.Args[2:])
+		default:
+			log.Fatalf("Unknown command %s", os.Args[1])
+		}
+		return
+	}
+
+	listenAddress := viper.GetString("listenaddress")
+	listenPort := viper.GetString("listenport")
+	authRequired = viper.GetBool("authrequired")
+	scimTeams = viper.GetStringMapString("scim.teams.map")
+	scimAdminTeams = viper.GetStringSlice("scim.admin.teams")
+	authenticator, err = newAuthenticator()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	go purgeTrash(viper.GetDuration("trash.retention"), viper.GetDuration("trash.purgeinterval"))
+	if dir := viper.GetString("sync.dir"); dir != "" && viper.GetDuration("sync.interval") > 0 {
+		go syncLoop(dir, viper.GetString("sync.user"), viper.GetBool("sync.gitpull"), false, viper.GetDuration("sync.interval"))
+	}
+
 	srv := &http.Server{
-		Handler:      r,
+		Handler:      newRouter(),
 		Addr:         fmt.Sprintf("%s:%s", listenAddress, listenPort),
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
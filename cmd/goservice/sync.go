@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/tcotav/golinks/store"
+)
+
+const syncUsage = "usage: goservice sync [-dir path] [-user email] [-pull] [-dry-run] [-interval duration]"
+
+// runSync handles `goservice sync`, making the store match the links declared in a
+// directory once, or every -interval until killed.  The flags default to the sync section
+// of the config.
+func runSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	dir := flags.String("dir", viper.GetString("sync.dir"), "directory of YAML files declaring links")
+	user := flags.String("user", viper.GetString("sync.user"), "admin the changes are made as")
+	pull := flags.Bool("pull", viper.GetBool("sync.gitpull"), "git pull the directory before each sync")
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing anything")
+	interval := flags.Duration("interval", 0, "sync again every interval instead of once")
+	flags.Parse(args)
+	if flags.NArg() > 0 || *dir == "" || *user == "" {
+		log.Fatal(syncUsage)
+	}
+
+	if *interval <= 0 {
+		if err := syncDir(*dir, *user, *pull, *dryRun); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+	syncLoop(*dir, *user, *pull, *dryRun, *interval)
+}
+
+// syncDir pulls dir if asked to, then syncs the store to it, logging every change.
+func syncDir(dir string, user string, pull bool, dryRun bool) error {
+	if pull {
+		out, err := exec.Command("git", "-C", dir, "pull", "--ff-only").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git pull in %s failed: %v\n%s", dir, err, out)
+		}
+	}
+	links, err := store.ReadSyncDir(dir, user)
+	if err != nil {
+		return err
+	}
+	changes, err := store.Sync(s, links, user, dryRun)
+	if err != nil {
+		return err
+	}
+	verb := ""
+	if dryRun {
+		verb = "would "
+	}
+	failed := 0
+	for _, c := range changes {
+		switch {
+		case c.Error != "":
+			failed++
+			log.Printf("Sync could not %s %s from %s: %s", c.Action, c.Key, c.Source, c.Error)
+		case c.Source != "":
+			log.Printf("Sync %s%s %s from %s", verb, c.Action, c.Key, c.Source)
+		default:
+			log.Printf("Sync %s%s %s", verb, c.Action, c.Key)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sync changes failed", failed, len(changes))
+	}
+	return nil
+}
+
+// syncLoop syncs dir every interval.  It never returns.
+func syncLoop(dir string, user string, pull bool, dryRun bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := syncDir(dir, user, pull, dryRun); err != nil {
+			log.Printf("Sync of %s failed: %s", dir, err.Error())
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// turns counts the redirects through each multi-target link so round-robin links move on
+// to their next target.  The count is per server, so with several nodes behind a load
+// balancer each one rotates on its own.
+var turns = struct {
+	sync.Mutex
+	n map[string]uint64
+}{n: make(map[string]uint64)}
+
+// nextTurn returns how many times k has been picked before and counts this one.
+func nextTurn(k string) uint64 {
+	turns.Lock()
+	defer turns.Unlock()
+	turn := turns.n[k]
+	turns.n[k] = turn + 1
+	return turn
+}
+
+// pickTarget returns route with its URL set to the target chosen for this request, logging
+// the choice.  Routes without targets come back unchanged.
+func pickTarget(r *http.Request, route routes.Route) routes.Route {
+	i := route.Pick(nextTurn(route.ShortKey))
+	if i < 0 {
+		return route
+	}
+	route.URL = route.Targets[i].URL
+	log.Printf("[%p] %s picked target %d of %d %s", r, route.ShortKey, i+1, len(route.Targets), route.URL)
+	return route
+}
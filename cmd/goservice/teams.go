@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+// apiListTeams handles GET /api/v1/teams, every team without its members.
+func apiListTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := s.AllTeams()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Teams: teams})
+}
+
+// apiCreateTeam handles POST /api/v1/teams, creating the team
+// {"name": ..., "member_access": ..., "default_access": ...} with the requester as its
+// manager.
+func apiCreateTeam(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	var body store.Team
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := s.Team(body.Name); err == nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Team %s already exists", body.Name))
+		return
+	}
+	t, err := s.CreateTeam(store.Team{Name: body.Name, MemberAccess: body.MemberAccess, DefaultAccess: body.DefaultAccess}, user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusCreated)
+	writeJSON(w, http.StatusCreated, MsgReturn{Teams: []store.Team{t}})
+}
+
+// apiGetTeam handles GET /api/v1/teams/{team}, the team along with its members.
+func apiGetTeam(w http.ResponseWriter, r *http.Request) {
+	t, err := s.Team(mux.Vars(r)["team"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Teams: []store.Team{t}})
+}
+
+// apiPatchTeam handles PATCH /api/v1/teams/{team}, where a manager of the team changes its
+// member_access or default_access, leaving out the ones that stay as they are.
+func apiPatchTeam(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	current, err := s.Team(mux.Vars(r)["team"])
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	var body struct {
+		MemberAccess  *store.Access `json:"member_access"`
+		DefaultAccess *store.Access `json:"default_access"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.MemberAccess != nil {
+		current.MemberAccess = *body.MemberAccess
+	}
+	if body.DefaultAccess != nil {
+		current.DefaultAccess = *body.DefaultAccess
+	}
+	t, err := s.UpdateTeam(current, user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, t.Name, http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{Teams: []store.Team{t}})
+}
+
+// apiDeleteTeam handles DELETE /api/v1/teams/{team}, which only works once the team owns no
+// links or namespaces.
+func apiDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["team"]
+	if err := s.DeleteTeam(name, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, name, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiPutTeamMember handles PUT /api/v1/teams/{team}/members/{user}, where a manager of the
+// team adds user to it, or with {"manager": true} makes them a manager too.
+func apiPutTeamMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Manager bool `json:"manager"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	vars := mux.Vars(r)
+	if err := s.AddTeamMember(vars["team"], vars["user"], body.Manager, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, vars["user"], http.StatusOK)
+	apiGetTeam(w, r)
+}
+
+// apiRemoveTeamMember handles DELETE /api/v1/teams/{team}/members/{user}, where a manager
+// of the team takes user out of it, or user leaves it.
+func apiRemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	if err := s.RemoveTeamMember(vars["team"], vars["user"], user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, vars["user"], http.StatusOK)
+	apiGetTeam(w, r)
+}
+
+// apiTeamLinks handles GET /api/v1/users/me/team-links, the links owned by the teams the
+// requester is in.
+func apiTeamLinks(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.TeamLinks(user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if links == nil {
+		links = make([]routes.Route, 0)
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Routes: links})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/auth"
+	"github.com/tcotav/golinks/store"
+)
+
+// apiListTokens handles GET /api/v1/tokens, the requester's own API tokens, or with
+// ?user= an admin's view of someone else's.
+func apiListTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	owner := user
+	if u := r.URL.Query().Get("user"); u != "" && u != user {
+		requester, err := s.GetUser(user)
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		if requester.IsAdmin != 1 || !hasScope(r, store.ScopeAdmin) {
+			apiError(w, fmt.Errorf("%w, only admins may list other users' tokens", store.ErrForbidden))
+			return
+		}
+		owner = u
+	}
+	tokens, err := s.Tokens(owner)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MsgReturn{Tokens: tokens})
+}
+
+// apiCreateToken handles POST /api/v1/tokens, minting a token for the requester from
+// {"name": ..., "scopes": [...], "expires": RFC 3339 time}.  The token is in the response
+// and never shown again.  Tokens cannot be used to mint more tokens.
+func apiCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	if id := auth.FromContext(r.Context()); id != nil && id.Method == "apitoken" {
+		writeError(w, http.StatusForbidden, "API tokens cannot create API tokens")
+		return
+	}
+	var body struct {
+		Name    string
+		Scopes  []string
+		Expires *time.Time
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var expires time.Time
+	if body.Expires != nil {
+		expires = *body.Expires
+	}
+	token, err := s.CreateToken(user, body.Name, body.Scopes, expires)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, token.Name, http.StatusCreated)
+	writeJSON(w, http.StatusCreated, MsgReturn{Tokens: []store.APIToken{token}})
+}
+
+// apiRevokeToken handles DELETE /api/v1/tokens/{id}, for the token's owner or an admin.
+func apiRevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.RevokeToken(id, user); err != nil {
+		apiError(w, err)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, mux.Vars(r)["id"], http.StatusOK)
+	writeJSON(w, http.StatusOK, MsgReturn{})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+const exportUsage = "usage: goservice export [-format json|csv|yaml] [-o file]"
+const importUsage = "usage: goservice import -user email [-format json|csv|yaml] [-adapter name] [-map source=field,...] [-mode skip|overwrite|fail] [-dry-run] file|-"
+
+// readImport reads the file to import, through the adapter and mapping when it comes from
+// another service.
+func readImport(in io.Reader, format string, adapter string, mapping string, user string) ([]routes.Record, error) {
+	if adapter == "" && mapping == "" {
+		return routes.ReadRoutes(in, format, user)
+	}
+	overrides, err := routes.ParseMapping(mapping)
+	if err != nil {
+		return nil, err
+	}
+	m, err := routes.NewMapping(adapter, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return routes.ReadMappedRoutes(in, format, m, user)
+}
+
+// runExport handles `goservice export`, writing every live link to stdout or a file.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "json, csv or yaml, by default from the file name or json")
+	output := flags.String("o", "", "file to write instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		log.Fatal(exportUsage)
+	}
+	if *format == "" {
+		*format = routes.FormatOf(*output)
+	}
+
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := routes.WriteRoutes(w, *format, all); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// runImport handles `goservice import`, printing what happened to each entry.
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	user := flags.String("user", "", "who the import is made as, and the creator of entries without one")
+	format := flags.String("format", "", "json, csv or yaml, by default from the file name or json")
+	adapter := flags.String("adapter", "", "read another service's export with this named field mapping, e.g. keyword or common")
+	mapping := flags.String("map", "", "read another service's export mapping its fields to ours, as in keyword=shortkey,destination=url")
+	mode := flags.String("mode", store.ImportSkip, "what to do with keys that exist: skip, overwrite or fail")
+	dryRun := flags.Bool("dry-run", false, "report what would happen without changing anything")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *user == "" {
+		log.Fatal(importUsage)
+	}
+	name := flags.Arg(0)
+	if *format == "" {
+		*format = routes.FormatOf(name)
+	}
+
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer f.Close()
+		in = f
+	}
+	records, err := readImport(in, *format, *adapter, *mapping, *user)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	results, err := store.Import(s, records, *user, *mode, *dryRun)
+	for _, res := range results {
+		line := fmt.Sprintf("row %d\t%s\t%s", res.Row, res.Action, res.Key)
+		if res.Error != "" {
+			line += "\t" + res.Error
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// apiExport handles GET /api/v1/export, with the format query parameter defaulting to json.
+func apiExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = routes.FormatJSON
+	}
+	if err := routes.IsValidFormat(format); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("content-type", routes.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="golinks.%s"`, format))
+	if err := routes.WriteRoutes(w, format, all); err != nil {
+		log.Printf("Could not export links: %s", err.Error())
+	}
+}
+
+// apiImport handles POST /api/v1/import, which only admins may do.  The body is the file,
+// its format taken from the format query parameter or else the content type, and the
+// adapter, map, mode and dryrun query parameters are as for `goservice import`.  The report is in Imported.
+func apiImport(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiUser(w, r)
+	if !ok {
+		return
+	}
+	u, err := s.GetUser(user)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if u.IsAdmin != 1 {
+		apiError(w, fmt.Errorf("%w, user %s is not admin", store.ErrForbidden, user))
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = routes.FormatOf(r.Header.Get("content-type"))
+	}
+	dryRun := false
+	if v := query.Get("dryrun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid dryrun %s", v))
+			return
+		}
+	}
+
+	records, err := readImport(r.Body, format, query.Get("adapter"), query.Get("map"), user)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := store.Import(s, records, user, query.Get("mode"), dryRun)
+	code := http.StatusOK
+	msg := MsgReturn{Imported: results}
+	if errors.Is(err, store.ErrImportAborted) {
+		code, msg.Message = http.StatusConflict, err.Error()
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, fmt.Sprintf("%d entries", len(results)), code)
+	writeJSON(w, code, msg)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tcotav/golinks/store"
+)
+
+// trash responds to /api/trash with every deleted link that has not been purged yet.
+func trash(w http.ResponseWriter, r *http.Request) {
+	trashed, err := s.Trash()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK, Routes: trashed})
+	w.Write(resp)
+}
+
+// undelete takes /api/trash/{short_key}/restore back out of the trash.
+func undelete(w http.ResponseWriter, r *http.Request) {
+	user, ok := legacyUser(w, r)
+	if !ok {
+		return
+	}
+	shortKey := mux.Vars(r)["short_key"]
+
+	_, err := s.Undelete(shortKey, user)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrForbidden) || errors.Is(err, store.ErrLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logLine([]byte(fmt.Sprintf("%p", r)), r.RemoteAddr, r.RequestURI, shortKey, http.StatusOK)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(MsgReturn{ReturnCode: http.StatusOK})
+	w.Write(resp)
+}
+
+// purgeTrash permanently removes links that have been in the trash longer than retention,
+// checking every interval.  It never returns.
+func purgeTrash(retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Trash purge failed: %s", err.Error())
+		} else if n > 0 {
+			log.Printf("Purged %d links from the trash", n)
+		}
+		<-ticker.C
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/tcotav/golinks
 
-go 1.13
+go 1.16
 
 require (
 	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
@@ -10,8 +10,10 @@ require (
 	github.com/gomodule/redigo v1.8.2 // indirect
 	github.com/gorilla/mux v1.7.3
 	github.com/hashicorp/golang-lru v0.5.4
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/spf13/viper v1.6.2
 	github.com/syndtr/goleveldb v1.0.0 // indirect
 	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da // indirect
+	gopkg.in/yaml.v2 v2.2.4
 )
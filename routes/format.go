@@ -0,0 +1,285 @@
+package routes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Links are exported and imported as a list of routes in one of these formats.  JSON and
+// YAML use the same field names as the API; CSV has a header row naming the CSVColumns it
+// carries, with targets as a JSON list.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatYAML = "yaml"
+)
+
+// Formats lists the formats WriteRoutes and ReadRoutes understand.
+var Formats = []string{FormatJSON, FormatCSV, FormatYAML}
+
+// CSVColumns are the columns WriteRoutes writes and ReadRoutes accepts, in that order.
+var CSVColumns = []string{"shortkey", "url", "fallbackurl", "passthrough", "targets", "rotation", "creator", "team", "locked"}
+
+// ContentType returns the mime type for format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatYAML:
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// FormatOf guesses the format of a file from its extension, or of a request body from its
+// content type, defaulting to JSON.
+func FormatOf(name string) string {
+	if i := strings.Index(name, ";"); i >= 0 {
+		// drop the charset and the like from a content type
+		name = name[:i]
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case strings.HasSuffix(name, "csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, "yaml"), strings.HasSuffix(name, "yml"):
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+// IsValidFormat checks format is one of Formats.
+func IsValidFormat(format string) error {
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid format %s, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteRoutes writes rs to w in format.  Only what it takes to recreate a link is written,
+// not its timestamps or revision.
+func WriteRoutes(w io.Writer, format string, rs []Route) error {
+	if err := IsValidFormat(format); err != nil {
+		return err
+	}
+	portable := make([]Route, len(rs))
+	for i, r := range rs {
+		portable[i] = Route{ShortKey: r.ShortKey, URL: r.URL, FallbackURL: r.FallbackURL, Passthrough: r.Passthrough,
+			Targets: r.Targets, Rotation: r.Rotation, Creator: r.Creator, Team: r.Team, Locked: r.Locked}
+	}
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(CSVColumns)
+		for _, r := range portable {
+			targets := ""
+			if len(r.Targets) > 0 {
+				b, err := json.Marshal(r.Targets)
+				if err != nil {
+					return err
+				}
+				targets = string(b)
+			}
+			cw.Write([]string{r.ShortKey, r.URL, r.FallbackURL, r.Passthrough, targets, r.Rotation, r.Creator, r.Team, strconv.Itoa(r.Locked)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatYAML:
+		b, err := yaml.Marshal(portable)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(portable)
+}
+
+// Record is one entry read by ReadRoutes: the route, or why it is not one.  Row counts
+// the entries from 1, not counting a CSV header.
+type Record struct {
+	Row   int
+	Route Route
+	Err   error
+}
+
+// ReadRoutes reads a list of routes in format from r, giving every entry without a creator
+// to creator.  Each entry goes through the same validation as a route sent to the API, and
+// one that fails it is returned with its error rather than failing the rest.  The error is
+// for input that cannot be read as a list at all.
+func ReadRoutes(r io.Reader, format string, creator string) ([]Record, error) {
+	return ReadMappedRoutes(r, format, nil, creator)
+}
+
+// ReadMappedRoutes is ReadRoutes for another service's export, whose fields m maps to route
+// fields.  Fields m has no use for are ignored rather than being an error.
+func ReadMappedRoutes(r io.Reader, format string, m Mapping, creator string) ([]Record, error) {
+	if err := IsValidFormat(format); err != nil {
+		return nil, err
+	}
+	var entries []map[string]interface{}
+	var err error
+	switch format {
+	case FormatCSV:
+		entries, err = readCSV(r, m == nil)
+	case FormatYAML:
+		entries, err = readYAML(r)
+	default:
+		err = json.NewDecoder(r).Decode(&entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(entries))
+	for i, fields := range entries {
+		records[i].Row = i + 1
+		var err error
+		if m != nil {
+			fields, err = m.apply(fields)
+		}
+		if err == nil && format == FormatCSV {
+			err = typeCSVFields(fields)
+		}
+		if err != nil {
+			records[i].Err = err
+			continue
+		}
+		records[i].Route, records[i].Err = RouteFromFields(fields, creator)
+	}
+	return records, nil
+}
+
+// RouteFromFields builds a route from fields named as in the API, giving it to creator if
+// it has none.
+func RouteFromFields(fields map[string]interface{}, creator string) (Route, error) {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	if v, ok := fields["creator"]; !ok || v == "" {
+		fields["creator"] = creator
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return Route{}, err
+	}
+	var route Route
+	err = json.Unmarshal(b, &route)
+	return route, err
+}
+
+// readCSV reads the rows after the header as fields named by the header, leaving out empty
+// cells.  With strict every column has to be one of CSVColumns.
+func readCSV(r io.Reader, strict bool) ([]map[string]interface{}, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the csv header, %v", err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if strict && !isCSVColumn(header[i]) {
+			return nil, fmt.Errorf("Unknown csv column %s, expected some of %s", name, strings.Join(CSVColumns, ", "))
+		}
+	}
+
+	var entries []map[string]interface{}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]interface{})
+		for i, cell := range row {
+			if cell = strings.TrimSpace(cell); cell != "" {
+				fields[header[i]] = cell
+			}
+		}
+		entries = append(entries, fields)
+	}
+	return entries, nil
+}
+
+// typeCSVFields turns the locked and targets cells of a CSV row into the types a route has
+// for them.
+func typeCSVFields(fields map[string]interface{}) error {
+	if v, ok := fields["locked"]; ok {
+		locked, err := lockedValue(v)
+		if err != nil {
+			return err
+		}
+		fields["locked"] = locked
+	}
+	if v, ok := fields["targets"].(string); ok {
+		var targets []Target
+		if err := json.Unmarshal([]byte(v), &targets); err != nil {
+			return fmt.Errorf("Invalid targets %s, expected a JSON list", v)
+		}
+		fields["targets"] = targets
+	}
+	return nil
+}
+
+func isCSVColumn(name string) bool {
+	for _, c := range CSVColumns {
+		if name == c {
+			return true
+		}
+	}
+	return false
+}
+
+// readYAML reads a YAML list of routes as fields.
+func readYAML(r io.Reader) ([]map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	if err := yaml.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]interface{}, len(list))
+	for i, entry := range list {
+		fields, ok := jsonable(entry).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Entry %d is not a map of fields", i+1)
+		}
+		entries[i] = fields
+	}
+	return entries, nil
+}
+
+// jsonable turns the map[interface{}]interface{} yaml decodes maps into, at any depth, into
+// map[string]interface{} so that it can be marshalled as JSON.
+func jsonable(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonable(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonable(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteReadRoutes(t *testing.T) {
+	rs := []Route{
+		{ShortKey: "jira", URL: "https://jira.example.com/browse/%s", FallbackURL: "https://jira.example.com",
+			Creator: "t@example.com", Team: "team@example.com", Locked: 1, Revision: 7},
+		{ShortKey: "dash", URL: "https://a.example.com", Targets: Targets{{URL: "https://a.example.com", Weight: 3}, {URL: "https://b.example.com"}},
+			Rotation: RotationWeighted, Passthrough: PassthroughIgnore, Creator: "t@example.com", Team: "t@example.com"},
+	}
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := WriteRoutes(&buf, format, rs); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		records, err := ReadRoutes(&buf, format, "importer@example.com")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(records) != len(rs) {
+			t.Fatalf("%s: expected %d records, got %d", format, len(rs), len(records))
+		}
+		for i, rec := range records {
+			if rec.Err != nil {
+				t.Errorf("%s row %d: %v", format, rec.Row, rec.Err)
+				continue
+			}
+			got := rec.Route
+			expected := rs[i]
+			expected.Revision = 0 // not exported
+			got.CreatedAt, got.ModifiedAt, got.LastModifiedBy = "", "", ""
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s row %d: expected %+v, got %+v", format, rec.Row, expected, got)
+			}
+		}
+	}
+}
+
+func TestReadRoutesRows(t *testing.T) {
+	in := `shortkey, url, creator, locked
+wiki, https://wiki.example.com, ,
+bad key!, https://example.com, t@example.com, 0
+docs, not a url, t@example.com, 0
+ops, https://ops.example.com, t@example.com, maybe
+`
+	records, err := ReadRoutes(strings.NewReader(in), FormatCSV, "importer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(records))
+	}
+	if records[0].Err != nil || records[0].Route.Creator != "importer@example.com" {
+		t.Errorf("Expected wiki to go to the importer, got %+v", records[0])
+	}
+	for _, rec := range records[1:] {
+		if rec.Err == nil {
+			t.Errorf("Expected an error for row %d", rec.Row)
+		}
+	}
+	if records[3].Row != 4 {
+		t.Errorf("Expected rows numbered from 1, got %d", records[3].Row)
+	}
+
+	if _, err := ReadRoutes(strings.NewReader("keyword,destination\n"), FormatCSV, "importer@example.com"); err == nil {
+		t.Error("Expected an error for unknown columns")
+	}
+	if _, err := ReadRoutes(strings.NewReader(`{"shortkey": "a"}`), FormatJSON, "importer@example.com"); err == nil {
+		t.Error("Expected an error for json that is not a list")
+	}
+	if _, err := ReadRoutes(strings.NewReader(""), "xml", "importer@example.com"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"links.csv":                FormatCSV,
+		"links.YML":                FormatYAML,
+		"backup.yaml":              FormatYAML,
+		"links.json":               FormatJSON,
+		"":                         FormatJSON,
+		"text/csv; charset=utf-8":  FormatCSV,
+		"application/x-yaml":       FormatYAML,
+		"application/octet-stream": FormatJSON,
+	}
+	for name, expected := range tests {
+		if got := FormatOf(name); got != expected {
+			t.Errorf("FormatOf(%s) = %s, expected %s", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package routes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mapping renames the fields of another go link service's export to the route fields they
+// hold, e.g. keyword to shortkey.  Source names are matched regardless of case, and a field
+// nested in a JSON or YAML object is named by its path, e.g. owner.email.  Several sources
+// may map to the same route field when exports vary in what they call it.
+type Mapping map[string]string
+
+// Adapters are the mappings that can be asked for by name.  More can be added from the
+// import.adapters section of the config.
+var Adapters = map[string]Mapping{
+	// a CSV with keyword, destination and owner columns
+	"keyword": {"keyword": "shortkey", "destination": "url", "owner": "creator"},
+	// the names for each field seen most often across exports
+	"common": {
+		"keyword": "shortkey", "name": "shortkey", "shortcut": "shortkey", "shortlink": "shortkey",
+		"short_key": "shortkey", "alias": "shortkey", "slug": "shortkey",
+		"destination": "url", "destination_url": "url", "target": "url", "target_url": "url",
+		"long_url": "url", "href": "url",
+		"owner": "creator", "owner_email": "creator", "created_by": "creator", "author": "creator",
+		"group": "team", "owner_team": "team",
+		"fallback": "fallbackurl", "fallback_url": "fallbackurl",
+		"is_locked": "locked",
+	},
+}
+
+// ParseMapping reads a mapping written as source=field pairs separated by commas, as in
+// keyword=shortkey,destination=url.
+func ParseMapping(s string) (Mapping, error) {
+	m := make(Mapping)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Invalid mapping %s, expected source=field", pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m.normalized()
+}
+
+// NewMapping combines the named adapter, if any, with overrides, and checks that every
+// field in the result is one a route can be imported with.
+func NewMapping(adapter string, overrides Mapping) (Mapping, error) {
+	m := make(Mapping)
+	if adapter != "" {
+		base, ok := Adapters[strings.ToLower(adapter)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown adapter %s, expected one of %s", adapter, strings.Join(adapterNames(), ", "))
+		}
+		for src, field := range base {
+			m[src] = field
+		}
+	}
+	for src, field := range overrides {
+		m[src] = field
+	}
+	return m.normalized()
+}
+
+// adapterNames lists the Adapters in order.
+func adapterNames() []string {
+	var names []string
+	for name := range Adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalized returns m lowercased, checking its fields.
+func (m Mapping) normalized() (Mapping, error) {
+	out := make(Mapping, len(m))
+	for src, field := range m {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !isCSVColumn(field) {
+			return nil, fmt.Errorf("Invalid mapping %s=%s, expected one of %s", src, field, strings.Join(CSVColumns, ", "))
+		}
+		out[strings.ToLower(strings.TrimSpace(src))] = field
+	}
+	return out, nil
+}
+
+// field returns the route field the source name maps to, if any.  Route field names map to
+// themselves unless the mapping uses them for something else.
+func (m Mapping) field(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if field, ok := m[name]; ok {
+		return field, true
+	}
+	if isCSVColumn(name) {
+		return name, true
+	}
+	return "", false
+}
+
+// apply renames fields, including the nested ones, to route fields, dropping those it has
+// no use for.  Two sources with different values for one field is an error.
+func (m Mapping) apply(fields map[string]interface{}) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	flatten("", fields, flat)
+
+	// sorted so that which of two conflicting sources is named first does not vary
+	names := make([]string, 0, len(flat))
+	for name := range flat {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]interface{})
+	from := make(map[string]string)
+	for _, name := range names {
+		v := flat[name]
+		field, ok := m.field(name)
+		if !ok || v == nil || v == "" {
+			continue
+		}
+		if field == "locked" {
+			locked, err := lockedValue(v)
+			if err != nil {
+				return nil, err
+			}
+			v = locked
+		}
+		if prev, ok := out[field]; ok && fmt.Sprint(prev) != fmt.Sprint(v) {
+			return nil, fmt.Errorf("Both %s and %s give %s", from[field], name, field)
+		}
+		out[field] = v
+		from[field] = name
+	}
+	return out, nil
+}
+
+// flatten copies fields into flat, naming nested fields by their dotted path.
+func flatten(prefix string, fields map[string]interface{}, flat map[string]interface{}) {
+	for k, v := range fields {
+		name := strings.ToLower(prefix + k)
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(name+".", nested, flat)
+			continue
+		}
+		flat[name] = v
+	}
+}
+
+// lockedValue reads a lock flag written as a bool, a number or a string as 0 or 1.
+func lockedValue(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		if v != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	case int:
+		if v != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	locked, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprint(v)))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid locked %v", v)
+	}
+	if locked {
+		return 1, nil
+	}
+	return 0, nil
+}
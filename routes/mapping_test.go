@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadMappedRoutes(t *testing.T) {
+	csvIn := `Keyword,Destination,Owner,Visits
+wiki,https://wiki.example.com,t@example.com,12
+jira,https://jira.example.com,jdoe,3
+`
+	m, err := NewMapping("keyword", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadMappedRoutes(strings.NewReader(csvIn), FormatCSV, m, "importer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if r := records[0].Route; records[0].Err != nil || r.ShortKey != "wiki" || r.URL != "https://wiki.example.com" || r.Creator != "t@example.com" {
+		t.Errorf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Err == nil {
+		t.Error("Expected an owner that is not an email to fail validation")
+	}
+
+	jsonIn := `[
+		{"alias": "Docs", "target_url": "https://docs.example.com", "owner": {"email": "o@example.com"}, "is_locked": true, "tags": ["a"]},
+		{"alias": "dash", "href": "https://a.example.com", "destination_url": "https://b.example.com"}
+	]`
+	overrides, err := ParseMapping("owner.email=creator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewMapping("common", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = ReadMappedRoutes(strings.NewReader(jsonIn), FormatJSON, m, "importer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := records[0].Route; records[0].Err != nil || r.ShortKey != "docs" || r.Creator != "o@example.com" || r.Locked != 1 {
+		t.Errorf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Err == nil || !strings.Contains(records[1].Err.Error(), "give url") {
+		t.Errorf("Expected two different urls to be an error, got %v", records[1].Err)
+	}
+
+	yamlIn := `
+- Shortcut: oncall
+  Destination: https://oncall.example.com
+`
+	records, err = ReadMappedRoutes(strings.NewReader(yamlIn), FormatYAML, m, "importer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := records[0].Route; records[0].Err != nil || r.ShortKey != "oncall" || r.Creator != "importer@example.com" {
+		t.Errorf("Unexpected yaml record %+v", records[0])
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	m, err := ParseMapping(" Keyword = shortkey, destination=URL ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["keyword"] != "shortkey" || m["destination"] != "url" {
+		t.Errorf("Unexpected mapping %v", m)
+	}
+	for _, bad := range []string{"keyword", "=url", "keyword=title"} {
+		if _, err := ParseMapping(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+	if _, err := NewMapping("nope", nil); err == nil {
+		t.Error("Expected an error for an unknown adapter")
+	}
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Keys are made of one or more segments separated by "/", so go/payments/oncall is the key
+// payments/oncall.  A namespace such as payments is owned by a team and only that team may
+// create keys under it.  Requests resolve to the longest key that prefixes their path, the
+// remaining segments being handed to the link as arguments.
+
+// MaxKeyLength is the longest key, namespace segments included, that the store can hold.
+const MaxKeyLength = 200
+
+// ReservedKeys cannot start a key or namespace as the server answers them itself.
+var ReservedKeys = []string{"add", "edit", "delete", "api", "auth", "random", "scim"}
+
+// keySegmentRegex matches a single segment of a key.
+var keySegmentRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Namespace is a key prefix owned by a team.
+type Namespace struct {
+	Name      string `json:"name"`
+	Team      string `json:"team"`
+	Creator   string `json:"creator,omitempty"`
+	CreatedAt string `json:"createdat,omitempty"`
+}
+
+// NewNamespace returns the namespace name, in canonical form, owned by team.
+func NewNamespace(name string, team string, creator string) (Namespace, error) {
+	if err := IsValidKey(name); err != nil {
+		return Namespace{}, err
+	}
+	name = NormalizeKey(name)
+	if err := IsValidTeam(team); err != nil {
+		return Namespace{}, err
+	}
+	if !isEmailValid(creator) {
+		return Namespace{}, errors.New("Invalid or bad format creator email address")
+	}
+	return Namespace{Name: name, Team: team, Creator: creator, CreatedAt: time.Now().Format(TimeFormat)}, nil
+}
+
+// IsValidKey checks that k is a well formed key that is not reserved once normalized.
+func IsValidKey(k string) error {
+	if k == "" {
+		return errors.New("Key cannot be empty")
+	}
+	if len(k) > MaxKeyLength {
+		return fmt.Errorf("Key %s is longer than %d characters", k, MaxKeyLength)
+	}
+	for _, seg := range strings.Split(k, "/") {
+		if !keySegmentRegex.MatchString(seg) {
+			return fmt.Errorf("Invalid key %s, use letters, digits, '.', '_' and '-' between '/'", k)
+		}
+	}
+	segments := strings.Split(NormalizeKey(k), "/")
+	for _, seg := range segments {
+		if seg == "" {
+			return fmt.Errorf("Invalid key %s, every part needs a letter or digit", k)
+		}
+	}
+	for _, reserved := range ReservedKeys {
+		if segments[0] == reserved {
+			return fmt.Errorf("Key %s is reserved", reserved)
+		}
+	}
+	return nil
+}
+
+// Prefixes returns k and every key that prefixes it, longest first, so a/b/c gives
+// a/b/c, a/b and a.
+func Prefixes(k string) []string {
+	prefixes := []string{k}
+	for i := len(k) - 1; i > 0; i-- {
+		if k[i] == '/' {
+			prefixes = append(prefixes, k[:i])
+		}
+	}
+	return prefixes
+}
+
+// Owner returns the innermost of namespaces that the key k sits under.
+func Owner(k string, namespaces []Namespace) (Namespace, bool) {
+	var owner Namespace
+	found := false
+	for _, ns := range namespaces {
+		if strings.HasPrefix(k, ns.Name+"/") && len(ns.Name) > len(owner.Name) {
+			owner, found = ns, true
+		}
+	}
+	return owner, found
+}
+
+// CheckShadowing returns an error if the key k would hide any of namespaces, either by
+// having the same name or by prefixing it and so catching requests meant for its keys.
+func CheckShadowing(k string, namespaces []Namespace) error {
+	for _, ns := range namespaces {
+		if k == ns.Name || strings.HasPrefix(ns.Name, k+"/") {
+			return fmt.Errorf("Key %s would shadow namespace %s", k, ns.Name)
+		}
+	}
+	return nil
+}
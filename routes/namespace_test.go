@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsValidKey(t *testing.T) {
+	valid := []string{"jira", "payments/oncall", "a.b_c-d", "payments/eu/oncall"}
+	for _, k := range valid {
+		if err := IsValidKey(k); err != nil {
+			t.Errorf("Expected %s to be valid, %v", k, err)
+		}
+	}
+
+	invalid := []string{"", "random", "api/links", "auth", "auth/login", "scim", "scim/v2", "payments/", "/oncall", "a//b", "on call", "ключ"}
+	for _, k := range invalid {
+		if err := IsValidKey(k); err == nil {
+			t.Errorf("Expected %q to be invalid", k)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	got := Prefixes("payments/eu/oncall")
+	expected := []string{"payments/eu/oncall", "payments/eu", "payments"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expected %v", got, expected)
+	}
+	if got := Prefixes("jira"); !reflect.DeepEqual(got, []string{"jira"}) {
+		t.Errorf("Got %v for a flat key", got)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	namespaces := []Namespace{{Name: "payments", Team: "pay@t.com"}, {Name: "payments/eu", Team: "eu@t.com"}}
+
+	tests := []struct {
+		key      string
+		owner    string
+		shadowed bool
+	}{
+		{"jira", "", false},
+		{"paymentsx", "", false},
+		{"payments/oncall", "payments", false},
+		{"payments/eu/oncall", "payments/eu", false},
+		{"payments", "", true},
+		{"payments/eu", "payments", true},
+	}
+	for _, tc := range tests {
+		owner, ok := Owner(tc.key, namespaces)
+		if ok != (tc.owner != "") || owner.Name != tc.owner {
+			t.Errorf("Owner of %s is %q, expected %q", tc.key, owner.Name, tc.owner)
+		}
+		if err := CheckShadowing(tc.key, namespaces); (err != nil) != tc.shadowed {
+			t.Errorf("Shadowing check for %s returned %v", tc.key, err)
+		}
+	}
+}
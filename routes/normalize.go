@@ -0,0 +1,21 @@
+package routes
+
+import "strings"
+
+// Keys are stored and looked up in a canonical form so that go/OnCall, go/on-call and
+// go/on_call all reach the same link.  Case never matters and the characters in
+// IgnoredPunctuation are dropped, "/" always being kept to separate namespaces.
+
+// IgnoredPunctuation holds the characters that make no difference to a key.  It is set from
+// the keys.ignorepunctuation config; changing it calls for `goservice migrate normalize`.
+var IgnoredPunctuation = "-_."
+
+// NormalizeKey returns the canonical form of the key k.
+func NormalizeKey(k string) string {
+	return strings.Map(func(c rune) rune {
+		if c != '/' && strings.ContainsRune(IgnoredPunctuation, c) {
+			return -1
+		}
+		return c
+	}, strings.ToLower(k))
+}
@@ -0,0 +1,25 @@
+package routes
+
+import "testing"
+
+func TestNormalizeKey(t *testing.T) {
+	tests := map[string]string{
+		"oncall":           "oncall",
+		"OnCall":           "oncall",
+		"on-call":          "oncall",
+		"on_call":          "oncall",
+		"On.Call":          "oncall",
+		"Payments/On-Call": "payments/oncall",
+	}
+	for k, expected := range tests {
+		if got := NormalizeKey(k); got != expected {
+			t.Errorf("NormalizeKey(%s) = %s, expected %s", k, got, expected)
+		}
+	}
+
+	defer func(p string) { IgnoredPunctuation = p }(IgnoredPunctuation)
+	IgnoredPunctuation = "-"
+	if got := NormalizeKey("On-Call_v1.2"); got != "oncall_v1.2" {
+		t.Errorf("Only hyphens should be ignored, got %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Passthrough modes say what happens to anything after the key that a link does not use
+// itself: extra path segments for plain links, and query parameters that are not consumed
+// by a {name} placeholder.
+const (
+	// PassthroughAppend joins extra path segments onto the link's path and adds extra query
+	// parameters to its query.  This is the default.
+	PassthroughAppend = "append"
+	// PassthroughIgnore drops anything extra.
+	PassthroughIgnore = "ignore"
+	// PassthroughStrict refuses requests that carry anything extra.
+	PassthroughStrict = "strict"
+)
+
+// ErrUnexpectedArgs is returned by Resolve for a strict link that was given extra path or query.
+var ErrUnexpectedArgs = errors.New("Link does not accept extra path or query")
+
+// isValidPassthrough checks p is one of the passthrough modes, or empty for the default.
+func isValidPassthrough(p string) error {
+	switch p {
+	case "", PassthroughAppend, PassthroughIgnore, PassthroughStrict:
+		return nil
+	}
+	return fmt.Errorf("Invalid passthrough %s, expected %s, %s or %s", p, PassthroughAppend, PassthroughIgnore, PassthroughStrict)
+}
+
+// Resolve returns the URL to redirect to for this route given the path segments that
+// followed the key and the request's query parameters.  Templates are expanded first and
+// whatever is left over is handled according to the route's Passthrough mode.
+func (r Route) Resolve(args []string, query url.Values) (string, error) {
+	target := r.URL
+	extraPath := args
+	extraQuery := query
+	if IsTemplate(r.URL) {
+		var err error
+		if target, err = r.Expand(args, query); err != nil {
+			return "", err
+		}
+		// path segments always belong to the template
+		extraPath = nil
+		extraQuery = url.Values{}
+		named := map[string]bool{}
+		for _, p := range placeholders(r.URL) {
+			named[p.name] = true
+		}
+		for k, v := range query {
+			if !named[k] {
+				extraQuery[k] = v
+			}
+		}
+	}
+	if len(extraPath) == 0 && len(extraQuery) == 0 {
+		return target, nil
+	}
+
+	switch r.Passthrough {
+	case PassthroughIgnore:
+		return target, nil
+	case PassthroughStrict:
+		return "", ErrUnexpectedArgs
+	}
+	return appendPassthrough(target, extraPath, extraQuery)
+}
+
+// appendPassthrough joins path onto the path of target and adds query after its existing
+// query, leaving any fragment where it is.
+func appendPassthrough(target string, path []string, query url.Values) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	if len(path) > 0 {
+		escaped := make([]string, len(path))
+		for i, p := range path {
+			escaped[i] = url.PathEscape(p)
+		}
+		rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.Join(escaped, "/")
+		if u.Path, err = url.PathUnescape(rawPath); err != nil {
+			return "", err
+		}
+		u.RawPath = rawPath
+	}
+
+	if len(query) > 0 {
+		if u.RawQuery == "" {
+			u.RawQuery = query.Encode()
+		} else {
+			u.RawQuery += "&" + query.Encode()
+		}
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		url         string
+		passthrough string
+		args        []string
+		query       string
+		expected    string
+		err         error
+	}{
+		{"https://docs.example.com", "", nil, "", "https://docs.example.com", nil},
+		{"https://docs.example.com", "", []string{"setup", "linux"}, "tab=2", "https://docs.example.com/setup/linux?tab=2", nil},
+		{"https://docs.example.com/", PassthroughAppend, []string{"setup"}, "", "https://docs.example.com/setup", nil},
+		{"https://docs.example.com/guide?lang=en#install", PassthroughAppend, []string{"linux"}, "tab=2", "https://docs.example.com/guide/linux?lang=en&tab=2#install", nil},
+		{"https://docs.example.com/a%2Fb", PassthroughAppend, []string{"c d"}, "", "https://docs.example.com/a%2Fb/c%20d", nil},
+		{"https://docs.example.com/guide", PassthroughIgnore, []string{"setup"}, "tab=2", "https://docs.example.com/guide", nil},
+		{"https://docs.example.com/guide", PassthroughStrict, nil, "", "https://docs.example.com/guide", nil},
+		{"https://docs.example.com/guide", PassthroughStrict, []string{"setup"}, "", "", ErrUnexpectedArgs},
+		{"https://docs.example.com/guide", PassthroughStrict, nil, "tab=2", "", ErrUnexpectedArgs},
+		// templates keep their path args, leftover query is passed through
+		{"https://jira.example.com/browse/%s", "", []string{"PROJ-1"}, "focus=1", "https://jira.example.com/browse/PROJ-1?focus=1", nil},
+		{"https://search.example.com/?q={q}", "", nil, "q=go&page=2", "https://search.example.com/?q=go&page=2", nil},
+		{"https://search.example.com/?q={q}", PassthroughStrict, nil, "q=go", "https://search.example.com/?q=go", nil},
+		{"https://search.example.com/?q={q}", PassthroughStrict, nil, "q=go&page=2", "", ErrUnexpectedArgs},
+		{"https://jira.example.com/browse/%s", "", nil, "", "", ErrMissingArgs},
+	}
+	for _, tc := range tests {
+		query, _ := url.ParseQuery(tc.query)
+		r := Route{URL: tc.url, Passthrough: tc.passthrough}
+		got, err := r.Resolve(tc.args, query)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s %s %v: expected error %v, got %v", tc.url, tc.passthrough, tc.args, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s %v: %v", tc.url, tc.passthrough, tc.args, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%s %s %v: expected %s, got %s", tc.url, tc.passthrough, tc.args, tc.expected, got)
+		}
+	}
+
+	var r Route
+	bad := `{"shortkey": "docs", "url":"https://docs.example.com", "passthrough":"sometimes", "creator":"t@t.com"}`
+	if err := json.Unmarshal([]byte(bad), &r); err == nil {
+		t.Error("Expected failure for unknown passthrough mode")
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 /*
 #### Data structure:
-- short_key - key used in url for lookup
+- short_key - key used in url for lookup, may be namespaced as team/key, see NormalizeKey
 - url - returned url correlated to the key
 - creator - creator of the k+v
 - created_at - date of creation
@@ -20,15 +20,27 @@ import (
 */
 // Route is
 type Route struct {
-	ID             int    `json:"id,omitempty"`
-	ShortKey       string `json:"shortkey"`
-	URL            string `json:"url"`
-	Creator        string `json:"creator"`
-	Team           string `json:"team,omitempty"`
-	CreatedAt      string `json:"createdat,omitempty"`
-	ModifiedAt     string `json:"modifiedat,omitempty"`
-	LastModifiedBy string `json:"lastmodifiedby,omitempty"`
-	Locked         int    `json:"locked"` // we will have some entries that will require elevated privs to change
+	ID             int     `json:"id,omitempty" yaml:"id,omitempty"`
+	ShortKey       string  `json:"shortkey" yaml:"shortkey,omitempty"`
+	URL            string  `json:"url" yaml:"url,omitempty"`                           // may be a template, see Expand
+	FallbackURL    string  `json:"fallbackurl,omitempty" yaml:"fallbackurl,omitempty"` // used when a template is missing its arguments
+	Passthrough    string  `json:"passthrough,omitempty" yaml:"passthrough,omitempty"` // append (default), ignore or strict, see Resolve
+	Targets        Targets `json:"targets,omitempty" yaml:"targets,omitempty"`         // when set the route rotates through these instead of URL
+	Rotation       string  `json:"rotation,omitempty" yaml:"rotation,omitempty"`       // roundrobin (default) or weighted, see Pick
+	Creator        string  `json:"creator" yaml:"creator,omitempty"`
+	Team           string  `json:"team,omitempty" yaml:"team,omitempty"`     // the name of the team owning the route
+	TeamID         int     `json:"teamid,omitempty" yaml:"teamid,omitempty"` // that team's id, set by the store
+	CreatedAt      string  `json:"createdat,omitempty" yaml:"createdat,omitempty"`
+	ModifiedAt     string  `json:"modifiedat,omitempty" yaml:"modifiedat,omitempty"`
+	LastModifiedBy string  `json:"lastmodifiedby,omitempty" yaml:"lastmodifiedby,omitempty"`
+	Locked         int     `json:"locked" yaml:"locked,omitempty"`               // we will have some entries that will require elevated privs to change
+	LockedBy       string  `json:"lockedby,omitempty" yaml:"lockedby,omitempty"` // the admin who locked the route
+	LockedAt       string  `json:"lockedat,omitempty" yaml:"lockedat,omitempty"`
+	LockReason     string  `json:"lockreason,omitempty" yaml:"lockreason,omitempty"` // why, for whoever finds they cannot change it
+	DeletedAt      string  `json:"deletedat,omitempty" yaml:"deletedat,omitempty"`   // set while the route sits in the trash
+	DeletedBy      string  `json:"deletedby,omitempty" yaml:"deletedby,omitempty"`
+	Revision       int     `json:"revision,omitempty" yaml:"revision,omitempty"` // bumped by every change; when set on a change it must be the current one
+	Managed        int     `json:"managed,omitempty" yaml:"managed,omitempty"`   // declared in a synced directory, which is where it has to be changed
 }
 
 const TimeFormat string = "2006-01-02 15:04:05"
@@ -44,25 +56,48 @@ func isEmailValid(e string) bool {
 	return emailRegex.MatchString(e)
 }
 
+// IsValidTeam checks that team is a well formed team name, which like a user is an email
+// address.
+func IsValidTeam(team string) error {
+	if !isEmailValid(team) {
+		return errors.New("Invalid or bad format team email address")
+	}
+	return nil
+}
+
+// IsValidUser checks that a user name is an email address.
+func IsValidUser(user string) error {
+	if !isEmailValid(user) {
+		return errors.New("Invalid or bad format user email address")
+	}
+	return nil
+}
+
 // NewRoute is a
 func NewRoute(k string, url string, creator string, team string) (Route, error) {
 	now := time.Now().Format(TimeFormat)
 
-	err := isValidURL(url)
+	if err := IsValidKey(k); err != nil {
+		return Route{}, err
+	}
+	err := isValidTemplate(url)
 	if err != nil {
 		return Route{}, err
 	}
 	if !isEmailValid(creator) {
 		return Route{}, errors.New("Invalid or bad format creator email address")
 	}
-	if !isEmailValid(team) { // allow blank team
-		return Route{}, errors.New("Invalid or bad format team email address")
+	// a blank team leaves the route to its creator alone
+	if team != "" {
+		if err := IsValidTeam(team); err != nil {
+			return Route{}, err
+		}
 	}
-	return Route{ShortKey: k, URL: url, Creator: creator, Team: team,
+	return Route{ShortKey: NormalizeKey(k), URL: url, Creator: creator, Team: team,
 		CreatedAt: now, ModifiedAt: now, LastModifiedBy: creator}, nil
 }
 
-// isValidURL is
+// isValidURL checks that testURL is an absolute url with a scheme and host.
 func isValidURL(testURL string) error {
 	_, err := url.ParseRequestURI(testURL)
 	if err != nil {
@@ -70,9 +105,12 @@ func isValidURL(testURL string) error {
 	}
 
 	u, err := url.Parse(testURL)
-	if err != nil || u.Scheme == "" || u.Host == "" {
+	if err != nil {
 		return err
 	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Invalid url %s, scheme and host are required", testURL)
+	}
 
 	return nil
 }
@@ -90,13 +128,47 @@ func (r *Route) UnmarshalJSON(body []byte) (err error) {
 	}
 
 	route := Route(rLocal)
-	r.ShortKey = route.ShortKey
+	if err := IsValidKey(route.ShortKey); err != nil {
+		return err
+	}
+	r.ShortKey = NormalizeKey(route.ShortKey)
+
+	r.Targets = route.Targets
+	r.Rotation = route.Rotation
+	if err := isValidTargets(r.Targets, r.Rotation); err != nil {
+		return err
+	}
 
-	// expect valid url
+	// expect valid url, which defaults to the first target
 	r.URL = route.URL
-	if err != nil {
+	if r.URL == "" && len(r.Targets) > 0 {
+		r.URL = r.Targets[0].URL
+	}
+	if err := isValidTemplate(r.URL); err != nil {
 		return err
 	}
+	r.FallbackURL = route.FallbackURL
+	if r.FallbackURL != "" {
+		if IsTemplate(r.FallbackURL) {
+			return fmt.Errorf("Fallback url %s cannot be a template", r.FallbackURL)
+		}
+		if err := isValidURL(r.FallbackURL); err != nil {
+			return err
+		}
+	}
+	r.Passthrough = route.Passthrough
+	if err := isValidPassthrough(r.Passthrough); err != nil {
+		return err
+	}
+
+	r.Locked = route.Locked
+	if r.Locked != 0 && r.Locked != 1 {
+		return fmt.Errorf("Invalid locked %d, expected 0 or 1", r.Locked)
+	}
+	r.Revision = route.Revision
+	if r.Revision < 0 {
+		return fmt.Errorf("Invalid revision %d", r.Revision)
+	}
 
 	now := time.Now().Format(TimeFormat)
 
@@ -123,9 +195,7 @@ func (r *Route) UnmarshalJSON(body []byte) (err error) {
 		return fmt.Errorf("Invalid or bad format lastmodified by email address, %s", r.LastModifiedBy)
 	}
 	r.Team = route.Team
-	if r.Team == "" {
-		r.Team = r.Creator
-	} else if !isEmailValid(r.Team) { // allow blank team
+	if r.Team != "" && !isEmailValid(r.Team) { // allow blank team
 		return fmt.Errorf("Invalid or bad format team by email address, %s", r.Team)
 	}
 	return nil
@@ -26,6 +26,12 @@ func TestCreate(t *testing.T) {
 	if err == nil {
 		t.Error("Expected failure for bad team email")
 	}
+
+	// no team leaves the route to its creator alone
+	r, err := NewRoute("d", "http://www.google.com", "t@t.com", "")
+	if err != nil || r.Team != "" {
+		t.Errorf("Expected a route with no team, got %+v (err %v)", r, err)
+	}
 }
 
 func TestJSONMarshal(t *testing.T) {
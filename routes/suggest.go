@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"sort"
+	"strings"
+)
+
+// minSimilarity is how alike a key has to be to the one asked for before it is suggested.
+const minSimilarity = 0.4
+
+// Suggest returns up to n of keys that look most like k, best first, for a "did you mean"
+// page.  Each key is compared with as many leading segments of k as it has itself, so
+// go/jria/PROJ-1 still suggests jira.
+func Suggest(k string, keys []string, n int) []string {
+	want := strings.Split(NormalizeKey(k), "/")
+
+	type scored struct {
+		key   string
+		score float64
+	}
+	var found []scored
+	for _, key := range keys {
+		norm := NormalizeKey(key)
+		depth := strings.Count(norm, "/") + 1
+		if depth > len(want) {
+			depth = len(want)
+		}
+		score := similarity(strings.Join(want[:depth], "/"), norm)
+		if score >= minSimilarity {
+			found = append(found, scored{key, score})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		return found[i].key < found[j].key
+	})
+
+	var suggestions []string
+	for i := 0; i < len(found) && i < n; i++ {
+		suggestions = append(suggestions, found[i].key)
+	}
+	return suggestions
+}
+
+// similarity scores a against b from 0 to 1 as the best of their edit distance, whether one
+// is a prefix of the other and how many trigrams they share.
+func similarity(a string, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	score := 1 - float64(editDistance(a, b))/float64(longest)
+
+	if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+		shortest := len(a) + len(b) - longest
+		if prefix := 0.5 + 0.5*float64(shortest)/float64(longest); prefix > score {
+			score = prefix
+		}
+	}
+	if tri := trigramSimilarity(a, b); tri > score {
+		score = tri
+	}
+	return score
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// trigrams returns the set of three character windows over s, padded as pg_trgm does so
+// that short keys still have some.
+func trigrams(s string) map[string]bool {
+	s = "  " + s + " "
+	set := make(map[string]bool)
+	for i := 0; i+3 <= len(s); i++ {
+		set[s[i:i+3]] = true
+	}
+	return set
+}
+
+// trigramSimilarity is the share of trigrams a and b have in common.
+func trigramSimilarity(a string, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
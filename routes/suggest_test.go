@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	keys := []string{"jira", "oncall", "oncall-eu", "payments/oncall", "wiki", "calendar"}
+
+	tests := []struct {
+		k        string
+		expected []string
+	}{
+		{"jria", []string{"jira"}},               // transposed letters
+		{"jira/PROJ-1", []string{"jira"}},        // args after the key
+		{"onc", []string{"oncall", "oncall-eu"}}, // prefix, shortest first
+		{"payments/oncal", []string{"payments/oncall"}},
+		{"zzzzzz", nil},
+	}
+	for _, tc := range tests {
+		got := Suggest(tc.k, keys, 2)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Suggest(%s) = %v, expected %v", tc.k, got, tc.expected)
+		}
+	}
+
+	if got := Suggest("oncall", keys, 1); len(got) != 1 {
+		t.Errorf("Expected a single suggestion, got %v", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"jira", "jira", 0},
+		{"jria", "jira", 2},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, tc := range tests {
+		if got := editDistance(tc.a, tc.b); got != tc.expected {
+			t.Errorf("editDistance(%s, %s) = %d, expected %d", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
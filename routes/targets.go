@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+// A route can have several targets instead of a single URL, say to rotate through the
+// on-call dashboards or to split traffic between two versions of an internal tool.  Each
+// request picks one according to the route's Rotation and the pick is then treated exactly
+// as if it were the route's URL.
+const (
+	// RotationRoundRobin takes the targets in turn.  This is the default.
+	RotationRoundRobin = "roundrobin"
+	// RotationWeighted picks a target at random in proportion to its weight.
+	RotationWeighted = "weighted"
+)
+
+// Target is one of the URLs a multi-target route may send a request to.
+type Target struct {
+	URL    string `json:"url" yaml:"url"`                           // may be a template, see Expand
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"` // only used by weighted rotation, defaults to 1
+}
+
+// Targets is stored as a single JSON encoded column, empty when a route has none.
+type Targets []Target
+
+// Value implements driver.Valuer.
+func (t Targets) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal([]Target(t))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (t *Targets) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("Cannot scan %T into targets", src)
+	}
+	if len(b) == 0 {
+		*t = nil
+		return nil
+	}
+	return json.Unmarshal(b, (*[]Target)(t))
+}
+
+// isValidTargets checks every target is a usable URL and that rotation fits them.
+func isValidTargets(targets Targets, rotation string) error {
+	switch rotation {
+	case "", RotationRoundRobin, RotationWeighted:
+	default:
+		return fmt.Errorf("Invalid rotation %s, expected %s or %s", rotation, RotationRoundRobin, RotationWeighted)
+	}
+	if len(targets) == 0 {
+		if rotation != "" {
+			return fmt.Errorf("Rotation %s requires targets", rotation)
+		}
+		return nil
+	}
+
+	for _, t := range targets {
+		if err := isValidTemplate(t.URL); err != nil {
+			return err
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("Invalid weight %d for target %s", t.Weight, t.URL)
+		}
+	}
+	return nil
+}
+
+// weight is the effective weight of t, an unset weight counting as 1.
+func (t Target) weight() int {
+	if t.Weight == 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// Pick chooses the target for the turn'th request to a multi-target route and returns its
+// index, or -1 for a route with a single URL.  Round-robin routes use turn, weighted ones
+// ignore it.
+func (r Route) Pick(turn uint64) int {
+	if len(r.Targets) == 0 {
+		return -1
+	}
+	if r.Rotation != RotationWeighted {
+		return int(turn % uint64(len(r.Targets)))
+	}
+
+	total := 0
+	for _, t := range r.Targets {
+		total += t.weight()
+	}
+	n := rand.Intn(total)
+	for i, t := range r.Targets {
+		if n < t.weight() {
+			return i
+		}
+		n -= t.weight()
+	}
+	return len(r.Targets) - 1
+}
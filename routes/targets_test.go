@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTargetsJSON(t *testing.T) {
+	var r Route
+	body := `{"shortkey": "oncall", "creator": "t@t.com", "rotation": "weighted",
+		"targets": [{"url": "https://dash.example.com/a", "weight": 3}, {"url": "https://dash.example.com/b"}]}`
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != "https://dash.example.com/a" {
+		t.Errorf("URL should default to the first target, got %s", r.URL)
+	}
+	if len(r.Targets) != 2 || r.Targets[0].Weight != 3 || r.Rotation != RotationWeighted {
+		t.Errorf("Unexpected targets %+v %s", r.Targets, r.Rotation)
+	}
+
+	bad := []string{
+		`{"shortkey": "x", "creator": "t@t.com", "targets": [{"url": "dash.example.com"}]}`,
+		`{"shortkey": "x", "creator": "t@t.com", "targets": [{"url": "https://dash.example.com", "weight": -1}]}`,
+		`{"shortkey": "x", "creator": "t@t.com", "rotation": "random", "targets": [{"url": "https://dash.example.com"}]}`,
+		`{"shortkey": "x", "creator": "t@t.com", "url": "https://dash.example.com", "rotation": "weighted"}`,
+	}
+	for _, b := range bad {
+		if err := json.Unmarshal([]byte(b), &Route{}); err == nil {
+			t.Errorf("Expected failure for %s", b)
+		}
+	}
+}
+
+func TestTargetsScan(t *testing.T) {
+	in := Targets{{URL: "https://a.example.com", Weight: 2}, {URL: "https://b.example.com"}}
+	v, err := in.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Targets
+	if err := out.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Round trip gave %+v", out)
+	}
+
+	if v, _ := Targets(nil).Value(); v != "" {
+		t.Errorf("No targets should store as empty, got %v", v)
+	}
+	if err := out.Scan(""); err != nil || out != nil {
+		t.Errorf("Empty column should scan to nil, got %+v %v", out, err)
+	}
+}
+
+func TestPick(t *testing.T) {
+	r := Route{URL: "https://a.example.com"}
+	if i := r.Pick(0); i != -1 {
+		t.Errorf("Single url route picked %d", i)
+	}
+
+	r.Targets = Targets{{URL: "https://a.example.com"}, {URL: "https://b.example.com"}, {URL: "https://c.example.com"}}
+	for turn, expected := range []int{0, 1, 2, 0, 1} {
+		if i := r.Pick(uint64(turn)); i != expected {
+			t.Errorf("Round robin turn %d picked %d, expected %d", turn, i, expected)
+		}
+	}
+
+	r.Rotation = RotationWeighted
+	r.Targets = Targets{{URL: "https://a.example.com", Weight: 9}, {URL: "https://b.example.com"}}
+	counts := make([]int, 2)
+	for n := 0; n < 10000; n++ {
+		counts[r.Pick(0)]++
+	}
+	// expect roughly 9000 and 1000
+	if counts[0] < 8500 || counts[1] < 500 {
+		t.Errorf("Weighted picks are off, got %v", counts)
+	}
+}
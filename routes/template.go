@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// A route URL can be a template.  Each %s is filled, in order, by the path segments that
+// follow the key, so with https://jira.example.com/browse/%s go/jira/PROJ-123 lands on
+// https://jira.example.com/browse/PROJ-123.  Any extra segments go into the last %s.
+// {name} is filled from the query parameter of the same name, so with
+// https://search.example.com/?q={q} go/search?q=golinks searches for golinks.
+
+// ErrMissingArgs is returned by Expand when a template needs arguments that were not given
+// and the route has no fallback URL.
+var ErrMissingArgs = errors.New("Link requires arguments")
+
+// placeholderRegex matches a positional %s or a named {name} placeholder.
+var placeholderRegex = regexp.MustCompile(`%s|\{([A-Za-z0-9_]+)\}`)
+
+// placeholder is a single %s or {name} in a template, by byte offset.
+type placeholder struct {
+	start, end int
+	name       string // empty for positional
+}
+
+// placeholders returns every placeholder in the template u in order.
+func placeholders(u string) []placeholder {
+	var found []placeholder
+	for _, m := range placeholderRegex.FindAllStringSubmatchIndex(u, -1) {
+		p := placeholder{start: m[0], end: m[1]}
+		if m[2] >= 0 {
+			p.name = u[m[2]:m[3]]
+		}
+		found = append(found, p)
+	}
+	return found
+}
+
+// IsTemplate reports whether the url u has any placeholders.
+func IsTemplate(u string) bool {
+	return len(placeholders(u)) > 0
+}
+
+// fill replaces each placeholder in u with the value returned by value.  Values placed in
+// the query string are query escaped and the rest path escaped.
+func fill(u string, value func(p placeholder, inQuery bool) string) string {
+	query := strings.Index(u, "?")
+	var b strings.Builder
+	last := 0
+	for _, p := range placeholders(u) {
+		b.WriteString(u[last:p.start])
+		b.WriteString(value(p, query >= 0 && p.start > query))
+		last = p.end
+	}
+	b.WriteString(u[last:])
+	return b.String()
+}
+
+// isValidTemplate checks that u is a usable URL once its placeholders are filled in.
+func isValidTemplate(u string) error {
+	return isValidURL(fill(u, func(placeholder, bool) string { return "x" }))
+}
+
+// Expand returns the URL to redirect to for this route given the path segments that
+// followed the key and the request's query parameters.  Routes that are not templates
+// ignore both.
+func (r Route) Expand(args []string, query url.Values) (string, error) {
+	ph := placeholders(r.URL)
+	if len(ph) == 0 {
+		return r.URL, nil
+	}
+
+	positional := 0
+	var missing []string
+	for _, p := range ph {
+		if p.name == "" {
+			positional++
+		} else if query.Get(p.name) == "" {
+			missing = append(missing, p.name)
+		}
+	}
+	if len(args) < positional || len(missing) > 0 {
+		if r.FallbackURL != "" {
+			return r.FallbackURL, nil
+		}
+		if len(args) < positional {
+			return "", fmt.Errorf("%w: expected %d, got %d", ErrMissingArgs, positional, len(args))
+		}
+		return "", fmt.Errorf("%w: missing %s", ErrMissingArgs, strings.Join(missing, ", "))
+	}
+
+	escape := func(v string, inQuery bool) string {
+		if inQuery {
+			return url.QueryEscape(v)
+		}
+		return url.PathEscape(v)
+	}
+	seen := 0
+	return fill(r.URL, func(p placeholder, inQuery bool) string {
+		if p.name != "" {
+			return escape(query.Get(p.name), inQuery)
+		}
+		seen++
+		if seen < positional {
+			return escape(args[seen-1], inQuery)
+		}
+		// the last positional placeholder soaks up everything left over
+		rest := make([]string, 0, len(args)-seen+1)
+		for _, a := range args[seen-1:] {
+			rest = append(rest, escape(a, inQuery))
+		}
+		return strings.Join(rest, "/")
+	}), nil
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		url      string
+		fallback string
+		args     []string
+		query    string
+		expected string
+		err      error
+	}{
+		{"http://www.google.com", "", nil, "", "http://www.google.com", nil},
+		{"http://www.google.com", "", []string{"ignored"}, "", "http://www.google.com", nil},
+		{"https://jira.example.com/browse/%s", "", []string{"PROJ-123"}, "", "https://jira.example.com/browse/PROJ-123", nil},
+		{"https://gh.example.com/%s/%s/issues", "", []string{"org", "repo"}, "", "https://gh.example.com/org/repo/issues", nil},
+		// leftovers go into the last placeholder
+		{"https://docs.example.com/%s", "", []string{"setup", "linux"}, "", "https://docs.example.com/setup/linux", nil},
+		{"https://search.example.com/?q=%s", "", []string{"a b&c"}, "", "https://search.example.com/?q=a+b%26c", nil},
+		{"https://search.example.com/?q={q}&lang={lang}", "", nil, "q=golinks&lang=go", "https://search.example.com/?q=golinks&lang=go", nil},
+		{"https://x.example.com/%s?user={user}", "", []string{"dash"}, "user=a@b.com", "https://x.example.com/dash?user=a%40b.com", nil},
+		{"https://jira.example.com/browse/%s", "https://jira.example.com", nil, "", "https://jira.example.com", nil},
+		{"https://search.example.com/?q={q}", "https://search.example.com", nil, "", "https://search.example.com", nil},
+		{"https://jira.example.com/browse/%s", "", nil, "", "", ErrMissingArgs},
+		{"https://search.example.com/?q={q}", "", nil, "other=1", "", ErrMissingArgs},
+	}
+	for _, tc := range tests {
+		query, _ := url.ParseQuery(tc.query)
+		r := Route{URL: tc.url, FallbackURL: tc.fallback}
+		got, err := r.Expand(tc.args, query)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s %v: expected error %v, got %v", tc.url, tc.args, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.url, tc.args, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%s %v: expected %s, got %s", tc.url, tc.args, tc.expected, got)
+		}
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	if _, err := NewRoute("jira", "https://jira.example.com/browse/%s", "t@t.com", "team@t.com"); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewRoute("jira", "%s/browse", "t@t.com", "team@t.com"); err == nil {
+		t.Error("Expected failure for template without a host")
+	}
+
+	var r Route
+	valid := `{"shortkey": "jira", "url":"https://jira.example.com/browse/%s", "fallbackurl":"https://jira.example.com", "creator":"t@t.com"}`
+	if err := json.Unmarshal([]byte(valid), &r); err != nil {
+		t.Error(err)
+	}
+	if r.FallbackURL != "https://jira.example.com" {
+		t.Errorf("Fallback url not kept, got %q", r.FallbackURL)
+	}
+
+	badFallback := `{"shortkey": "jira", "url":"https://jira.example.com/browse/%s", "fallbackurl":"https://jira.example.com/%s", "creator":"t@t.com"}`
+	if err := json.Unmarshal([]byte(badFallback), &r); err == nil {
+		t.Error("Expected failure for templated fallback url")
+	}
+	badURL := `{"shortkey": "jira", "url":"jira/browse/%s", "creator":"t@t.com"}`
+	if err := json.Unmarshal([]byte(badURL), &r); err == nil {
+		t.Error("Expected failure for bad url")
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// We should not use the local cache if we have redis as that assumes we have multiple nodes
+// and could have a local cache go stale.  Either way the cache holds just enough of a route
+// to redirect, keyed on the short key.
+
+// cacheEntry is the cached form of a route.  routes.Route has its own validating JSON
+// decoding meant for API input, so redis gets this instead.
+type cacheEntry struct {
+	URL         string         `json:"url"`
+	FallbackURL string         `json:"fallbackurl,omitempty"`
+	Passthrough string         `json:"passthrough,omitempty"`
+	Targets     routes.Targets `json:"targets,omitempty"`
+	Rotation    string         `json:"rotation,omitempty"`
+}
+
+func (e cacheEntry) route(k string) routes.Route {
+	return routes.Route{ShortKey: k, URL: e.URL, FallbackURL: e.FallbackURL, Passthrough: e.Passthrough,
+		Targets: e.Targets, Rotation: e.Rotation}
+}
+
+func newCacheEntry(r routes.Route) cacheEntry {
+	return cacheEntry{URL: r.URL, FallbackURL: r.FallbackURL, Passthrough: r.Passthrough,
+		Targets: r.Targets, Rotation: r.Rotation}
+}
+
+// fromCache returns the cached route for k, if there is one.
+func (s *DataStore) fromCache(k string) (routes.Route, bool) {
+	if s.redis != nil {
+		sRet, _ := s.redis.Get(k).Result()
+		if sRet == "" {
+			return routes.Route{}, false
+		}
+		var e cacheEntry
+		if err := json.Unmarshal([]byte(sRet), &e); err != nil {
+			return routes.Route{}, false
+		}
+		return e.route(k), true
+	} else if s.cache != nil { // check local cache for single node runs
+		v, ok := s.cache.Get(k)
+		if ok {
+			return v.(cacheEntry).route(k), true
+		}
+	}
+	return routes.Route{}, false
+}
+
+// toCache stores r in whichever cache is in use.
+func (s *DataStore) toCache(r routes.Route) {
+	e := newCacheEntry(r)
+	if s.redis != nil {
+		b, err := json.Marshal(e)
+		if err == nil {
+			s.redis.Set(r.ShortKey, string(b), s.redisTTL).Err()
+		}
+	} else if s.cache != nil {
+		s.cache.Add(r.ShortKey, e)
+	}
+}
+
+// uncache drops k from whichever cache is in use so the redirect path goes back to the database.
+func (s *DataStore) uncache(k string) {
+	if s.redis != nil {
+		s.redis.Del(k).Err()
+	} else if s.cache != nil {
+		s.cache.Remove(k)
+	}
+}
+
+// keysTTL is how long Keys trusts its list.  Changes made through the store drop it at once,
+// so this only bounds how long changes made by other processes take to show.
+const keysTTL = time.Minute
+
+// keyCache holds the live keys for Keys so that every not found page does not read them all.
+type keyCache struct {
+	sync.Mutex
+	keys []string
+	at   time.Time
+}
+
+// drop forgets the keys, to be read again on the next call to Keys.
+func (c *keyCache) drop() {
+	c.Lock()
+	defer c.Unlock()
+	c.keys = nil
+}
+
+// Keys lists every live key, in no particular order, for suggesting keys like a missing
+// one.  The list is shared and must not be changed.
+func (s *DataStore) Keys() ([]string, error) {
+	s.keys.Lock()
+	defer s.keys.Unlock()
+	if s.keys.keys != nil && time.Since(s.keys.at) < keysTTL {
+		return s.keys.keys, nil
+	}
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getLiveKeys"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]string, 0)
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.keys.keys, s.keys.at = keys, time.Now()
+	return keys, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-redis/redis"
 	"github.com/go-sql-driver/mysql"
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/lib/pq"
 	"github.com/tcotav/golinks/routes"
 
 	// database driver for sql package
@@ -30,6 +31,7 @@ type DataStore struct {
 	db       *sql.DB
 	cache    *lru.Cache
 	redis    *redis.Client
+	keys     *keyCache
 }
 
 var (
@@ -50,43 +52,47 @@ func NewStore(dbtype string, dbConn *sql.DB, redisClient *redis.Client, redisTTL
 	if redisClient == nil {
 		cache, _ = lru.New(500)
 	}
-	newStore := &DataStore{dbtype: dbtype, db: dbConn, cache: cache, redis: redisClient, redisTTL: (time.Duration(redisTTL) * time.Second)}
+	newStore := &DataStore{dbtype: dbtype, db: dbConn, cache: cache, redis: redisClient, redisTTL: (time.Duration(redisTTL) * time.Second), keys: &keyCache{}}
 	// end database setup
 	return newStore, nil
 }
 
 func (s *DataStore) GetUser(username string) (*User, error) {
-	// create or get
-	rows, err := s.db.Query(GetSQL(s.dbtype, "getUser"), username)
-	if err != nil {
-		return &User{}, err
-	}
-	defer rows.Close()
+	return s.getUser(s.db, username)
+}
 
-	var user User
-	for rows.Next() {
-		err := rows.Scan(&user.ID, &user.Name, &user.IsAdmin)
-		if err != nil {
-			return &User{}, err
-		}
-		return &user, nil
+// getUser returns username through q, creating them if there is no such user yet.
+func (s *DataStore) getUser(q execer, username string) (*User, error) {
+	u, err := scanUser(q.QueryRow(GetSQL(s.dbtype, "getUser"), username), username)
+	if !errors.Is(err, ErrNotFound) {
+		return u, err
 	}
-
-	now := time.Now()
-	stmt, err := s.db.Prepare(GetSQL(s.dbtype, "insertUser"))
+	id, err := s.insertReturningID(q, GetSQL(s.dbtype, "insertUser"), username, time.Now(), 0)
 	if err != nil {
 		return &User{}, err
 	}
-	res, err := stmt.Exec(username, now, 0)
-	if err != nil {
-		return &User{}, err
+	return &User{ID: int(id), Name: username}, nil
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	querier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertReturningID runs an INSERT and returns the id of the new row.  Postgres has no
+// LastInsertId so its queries end in RETURNING id and we read that back instead.
+func (s *DataStore) insertReturningID(q execer, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if s.dbtype == "postgres" {
+		err := q.QueryRow(query, args...).Scan(&id)
+		return id, err
 	}
-	id, err := res.LastInsertId()
+	res, err := q.Exec(query, args...)
 	if err != nil {
-		return &User{}, err
+		return -1, err
 	}
-	return &User{ID: int(id), Name: username}, nil
-
+	return res.LastInsertId()
 }
 
 func (s *DataStore) DumpAllRoutes() ([]routes.Route, error) {
@@ -95,17 +101,21 @@ func (s *DataStore) DumpAllRoutes() ([]routes.Route, error) {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanRouteList(rows)
+}
 
+// scanRouteList reads the routes from a getAllRoutes query.
+func scanRouteList(rows *sql.Rows) ([]routes.Route, error) {
 	var r routes.Route
 	routeList := make([]routes.Route, 0)
 	for rows.Next() {
-		err := rows.Scan(&r.ShortKey, &r.URL, &r.Creator, &r.Team, &r.LastModifiedBy)
+		err := rows.Scan(&r.ShortKey, &r.URL, &r.FallbackURL, &r.Passthrough, &r.Targets, &r.Rotation, &r.Creator, &r.Team, &r.TeamID, &r.LastModifiedBy, &r.Locked, &r.Revision, &r.Managed)
 		if err != nil {
 			return nil, err
 		}
 		routeList = append(routeList, r)
 	}
-	return routeList, nil
+	return routeList, rows.Err()
 }
 
 func (s *DataStore) GetAllUsers() error {
@@ -117,7 +127,7 @@ func (s *DataStore) GetAllUsers() error {
 
 	var user User
 	for rows.Next() {
-		err := rows.Scan(&user.ID, &user.Name, &user.IsAdmin)
+		err := rows.Scan(&user.ID, &user.Name, &user.IsAdmin, &user.Deactivated)
 		if err != nil {
 			return err
 		}
@@ -133,7 +143,7 @@ func (s *DataStore) MakeAdmin(username string, admin string) (int, error) {
 		return -1, err
 	}
 	if adminUser.IsAdmin != 1 {
-		return -1, fmt.Errorf("%s is not an admin, makeadmin called failed.", admin)
+		return -1, fmt.Errorf("%w, %s is not an admin, makeadmin called failed.", ErrForbidden, admin)
 	}
 
 	u, err := s.GetUser(username)
@@ -152,17 +162,73 @@ func (s *DataStore) MakeAdmin(username string, admin string) (int, error) {
 	return int(affect), nil
 }
 
-// Lock locks the entry so that it requires admin to unlock and change
+// SetAdmin makes username an admin, or no longer one, on the word of an identity provider
+// the server trusts to say so.  Unlike MakeAdmin nobody is checked, so it is not for
+// anything a user can ask for directly.
+func (s *DataStore) SetAdmin(username string, admin bool) (*User, error) {
+	u, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	isAdmin := 0
+	if admin {
+		isAdmin = 1
+	}
+	if u.IsAdmin == isAdmin {
+		return u, nil
+	}
+	now := time.Now().Format(routes.TimeFormat)
+	if _, err := s.db.Exec(GetSQL(s.dbtype, "setUserAdmin"), isAdmin, now, u.ID); err != nil {
+		return nil, err
+	}
+	u.IsAdmin = isAdmin
+	return u, nil
+}
+
+// Lock locks the entry so that it requires admin to unlock and change.  r.LastModifiedBy,
+// who has to be an admin, is kept as who locked it and r.LockReason as why.
 func (s *DataStore) Lock(r routes.Route) (int, error) {
-	now := time.Now()
+	return s.setLock(r, "lock", "updateURLLock", func(user *User, now string) []interface{} {
+		return []interface{}{user.ID, now, r.LockReason, user.ID, now}
+	})
+}
+
+// Unlock lets the owners and editors of the route r.ShortKey change it again, which only
+// admins, r.LastModifiedBy among them, may do.
+func (s *DataStore) Unlock(r routes.Route) (int, error) {
+	return s.setLock(r, "unlock", "updateURLUnlock", func(user *User, now string) []interface{} {
+		return []interface{}{user.ID, now}
+	})
+}
+
+// Manage marks the route r.ShortKey as managed by a synced directory, locking it so that
+// only admins, and so the sync, may change it.
+func (s *DataStore) Manage(r routes.Route) (int, error) {
+	return s.setLock(r, "manage", "updateURLManaged", func(user *User, now string) []interface{} {
+		return []interface{}{user.ID, now, "managed in a synced directory, change it there", user.ID, now}
+	})
+}
+
+// setLock runs query on the route r.ShortKey on behalf of the admin r.LastModifiedBy and
+// records it in the history as action.  args gives the query's parameters up to the key.
+func (s *DataStore) setLock(r routes.Route, action string, query string, args func(user *User, now string) []interface{}) (int, error) {
+	r.ShortKey = routes.NormalizeKey(r.ShortKey)
+	now := time.Now().Format(routes.TimeFormat)
 	user, err := s.GetUser(r.LastModifiedBy)
 	if err != nil {
 		return -1, err
 	}
 	if user.IsAdmin != 1 {
-		return -1, fmt.Errorf("User %s is not admin", user.Name)
+		return -1, fmt.Errorf("%w, user %s is not admin", ErrForbidden, user.Name)
 	}
-	res, err := s.db.Exec(GetSQL(s.dbtype, "updateURLLock"), user.ID, now, r.ShortKey)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(GetSQL(s.dbtype, query), append(args(user, now), r.ShortKey)...)
 	if err != nil {
 		return -1, err
 	}
@@ -170,19 +236,79 @@ func (s *DataStore) Lock(r routes.Route) (int, error) {
 	if err != nil {
 		return -1, err
 	}
-	return int(affect), nil
+	if affect == 0 {
+		return 0, ErrNotFound
+	}
+	if err := s.recordHistory(tx, r.ShortKey, action, user.ID, now); err != nil {
+		return -1, err
+	}
+	return int(affect), tx.Commit()
 }
 
 func (s *DataStore) Add(r routes.Route) (int, error) {
-	stmt, err := s.db.Prepare(GetSQL(s.dbtype, "insertRoute"))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	affect, err := s.add(tx, r)
+	if err != nil {
+		return -1, err
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+	s.keys.drop()
+	return affect, nil
+}
+
+// AddAll adds every one of rs in a single transaction and returns how many it added.  If
+// the store refuses one of them none are added, and the count is the index of the refused
+// route, or -1 when the failure was not down to any one of them.
+func (s *DataStore) AddAll(rs []routes.Route) (int, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return -1, err
 	}
-	u, err := s.GetUser(r.Creator)
+	defer tx.Rollback()
+
+	for i, r := range rs {
+		if _, err := s.add(tx, r); err != nil {
+			return i, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+	s.keys.drop()
+	return len(rs), nil
+}
+
+// add inserts the route r inside tx, creating its creator if need be.
+func (s *DataStore) add(tx *sql.Tx, r routes.Route) (int, error) {
+	r.ShortKey = routes.NormalizeKey(r.ShortKey)
+	u, err := s.getUser(tx, r.Creator)
+	if err != nil {
+		return -1, err
+	}
+	if err := s.checkNamespace(r, u); err != nil {
+		return -1, err
+	}
+
+	// a key sitting in the trash gives way to a new link of the same name; its history
+	// is kept so it can still be restored from there
+	if _, err := tx.Exec(GetSQL(s.dbtype, "purgeTrashedKey"), r.ShortKey); err != nil {
+		return -1, err
+	}
+	if _, err := tx.Exec(GetSQL(s.dbtype, "purgeOrphanEditors")); err != nil {
+		return -1, err
+	}
+	teamID, err := s.teamID(tx, r.Team, u)
 	if err != nil {
 		return -1, err
 	}
-	res, err := stmt.Exec(r.ShortKey, r.URL, u.ID, r.Team, r.CreatedAt, r.ModifiedAt, u.ID)
+	res, err := tx.Exec(GetSQL(s.dbtype, "insertRoute"), r.ShortKey, r.URL, r.FallbackURL, r.Passthrough, r.Targets, r.Rotation, u.ID, teamID, r.CreatedAt, r.ModifiedAt, u.ID)
 	if err != nil {
 		return -1, err
 	}
@@ -190,17 +316,30 @@ func (s *DataStore) Add(r routes.Route) (int, error) {
 	if err != nil {
 		return -1, err
 	}
+	if err := s.recordHistory(tx, r.ShortKey, "add", u.ID, r.ModifiedAt); err != nil {
+		return -1, err
+	}
 	return int(affect), nil
 }
 
-func (s *DataStore) GetRandomURL(k string) (routes.Route, error) {
-	// get count of rows in url list
-	//
-	return routes.Route{}, nil
+// Random returns a random live route for go/random, skipping templates that would have
+// nowhere to go without their arguments.
+func (s *DataStore) Random() (routes.Route, error) {
+	var r routes.Route
+	err := s.db.QueryRow(GetSQL(s.dbtype, "getRandomRoute")).Scan(&r.ShortKey, &r.URL, &r.FallbackURL, &r.Passthrough, &r.Targets, &r.Rotation)
+	if err == sql.ErrNoRows {
+		return routes.Route{}, ErrNotFound
+	}
+	if err != nil {
+		return routes.Route{}, err
+	}
+	return r, nil
 }
 
-// Get is
+// Get returns the full route for the short key k, with the creator and last modifier
+// resolved to user names.
 func (s *DataStore) Get(k string) (routes.Route, error) {
+	k = routes.NormalizeKey(k)
 	rows, err := s.db.Query(GetSQL(s.dbtype, "getRouteSQL"), k)
 	if err != nil {
 		return routes.Route{}, err
@@ -209,59 +348,61 @@ func (s *DataStore) Get(k string) (routes.Route, error) {
 
 	var r routes.Route
 	for rows.Next() {
-		err := rows.Scan(&r.ShortKey, &r.URL, &r.CreatedAt, &r.Creator, &r.Team, &r.ModifiedAt, &r.LastModifiedBy)
+		var lockedAt sql.NullString
+		err := rows.Scan(&r.ShortKey, &r.URL, &r.FallbackURL, &r.Passthrough, &r.Targets, &r.Rotation, &r.CreatedAt, &r.Creator, &r.Team, &r.TeamID, &r.ModifiedAt, &r.LastModifiedBy,
+			&r.Locked, &r.LockedBy, &r.LockReason, &lockedAt, &r.Revision, &r.Managed)
 		if err != nil {
 			return routes.Route{}, err
 		}
+		r.LockedAt = lockedAt.String
 		return r, nil
 	}
-	return routes.Route{}, errors.New("No match found")
+	return routes.Route{}, ErrNotFound
 }
 
-// GetURL is the main entry point for the app.  It is the shortlink.  The other getters are
-// designed for potentially slower access via an editor tool.
+// GetURL returns the url stored for k.  Templated urls come back unexpanded; the redirect
+// path should use Lookup and routes.Route.Expand instead.
 func (s *DataStore) GetURL(k string) (string, error) {
-	// we should not use the local cache if we have redis as that assumes we have multiple nodes
-	// and could have a local cache go stale
-	if s.redis != nil {
-		sRet, _ := s.redis.Get(k).Result()
-		if sRet != "" {
-			// update lcl cache and return
-			return sRet, nil
-		}
-	} else if s.cache != nil { // check local cache for single node runs
-		v, ok := s.cache.Get(k)
-		if ok {
-			return v.(string), nil
-		}
+	r, err := s.Lookup(k)
+	if err != nil {
+		return "", err
+	}
+	return r.URL, nil
+}
+
+// Lookup is the main entry point for the app.  It is the shortlink.  The other getters are
+// designed for potentially slower access via an editor tool.  The route it returns only
+// carries what is needed to redirect.
+func (s *DataStore) Lookup(k string) (routes.Route, error) {
+	k = routes.NormalizeKey(k)
+	if r, ok := s.fromCache(k); ok {
+		return r, nil
 	}
 
 	// then database
 	rows, err := s.db.Query(GetSQL(s.dbtype, "getURLSQL"), k)
 	if err != nil {
-		return "", err
+		return routes.Route{}, err
 	}
 	defer rows.Close()
-	var url string
 	for rows.Next() {
-		err := rows.Scan(&url)
+		r := routes.Route{ShortKey: k}
+		err := rows.Scan(&r.URL, &r.FallbackURL, &r.Passthrough, &r.Targets, &r.Rotation)
 		if err != nil {
-			return "", err
-		}
-
-		if s.redis != nil {
-			// update redis cache
-			s.redis.Set(k, url, s.redisTTL).Err()
-		} else if s.cache != nil {
-			// update local cache
-			s.cache.Add(k, url)
+			return routes.Route{}, err
 		}
-		return url, nil
+		s.toCache(r)
+		return r, nil
 	}
-	return "", errors.New("No match found")
+	return routes.Route{}, ErrNotFound
 }
 
+// Modify changes the urls and settings of the route r.ShortKey on behalf of
+// r.LastModifiedBy, who must be one of its owners or editors.  When r.Revision is set it
+// must be the route's current revision, otherwise ErrConflict is returned and nothing
+// changes.
 func (s *DataStore) Modify(r routes.Route) (int, error) {
+	r.ShortKey = routes.NormalizeKey(r.ShortKey)
 	// what about case where we are changing the shortkey -- how to invalidate caches?
 	now := time.Now().Format(routes.TimeFormat)
 	user, err := s.GetUser(r.LastModifiedBy)
@@ -269,28 +410,28 @@ func (s *DataStore) Modify(r routes.Route) (int, error) {
 		return -1, err
 	}
 
-	// double check the lock status of the key in question before we move on
-	// then database
-	rows, err := s.db.Query(GetSQL(s.dbtype, "getURLIsLocked"), r.ShortKey)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return -1, err
 	}
-	defer rows.Close()
-	var isLocked int
-	for rows.Next() {
-		err := rows.Scan(&isLocked)
-		if err != nil {
-			return -1, err
-		}
+	defer tx.Rollback()
+
+	// double check the lock status of the key in question before we move on
+	lock, err := s.lockStatus(tx, r.ShortKey)
+	if err != nil {
+		return -1, err
 	}
 
 	// exit if not allowed in
-	if isLocked == 1 && user.IsAdmin != 1 {
-		return -1, fmt.Errorf("User %s is not admin", user.Name)
+	if err := lock.check(r.ShortKey, user); err != nil {
+		return -1, err
+	}
+	if _, err := s.authorize(tx, r.ShortKey, user, AccessEditor, "change"); err != nil {
+		return -1, err
 	}
 
 	// then move on
-	res, err := s.db.Exec(GetSQL(s.dbtype, "updateURLSQL"), r.URL, user.ID, now, r.ShortKey)
+	res, err := tx.Exec(GetSQL(s.dbtype, "updateURLSQL"), r.URL, r.FallbackURL, r.Passthrough, r.Targets, r.Rotation, user.ID, now, r.ShortKey, r.Revision, r.Revision)
 	if err != nil {
 		return -1, err
 	}
@@ -298,23 +439,58 @@ func (s *DataStore) Modify(r routes.Route) (int, error) {
 	if err != nil {
 		return -1, err
 	}
-	// update the cache
-	// is it in the cache
-	// if it is, change the url
-	if s.redis != nil {
-		s.redis.Set(r.ShortKey, r.URL, s.redisTTL).Err()
-	} else if s.cache != nil {
-		if _, ok := s.cache.Get(r.ShortKey); !ok {
-			s.cache.Remove(r.ShortKey)
-			s.cache.Add(r.ShortKey, r.URL)
+	if affect == 0 {
+		// the route is there, lockStatus found it, so it has moved on from r.Revision
+		var current int
+		if err := tx.QueryRow(GetSQL(s.dbtype, "getURLRevision"), r.ShortKey).Scan(&current); err != nil {
+			return -1, err
 		}
+		return -1, fmt.Errorf("%w, %s is at revision %d not %d", ErrConflict, r.ShortKey, current, r.Revision)
+	}
+	if err := s.recordHistory(tx, r.ShortKey, "modify", user.ID, now); err != nil {
+		return -1, err
 	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+
+	s.uncache(r.ShortKey)
 	return int(affect), nil
 }
 
-func (s *DataStore) Delete(k string) error {
-	// what about case where we are changing the shortkey -- how to invalidate caches?
-	res, err := s.db.Exec(GetSQL(s.dbtype, "deleteRouteSQL"), k)
+// Delete moves the route k to the trash, where it stays until Undelete brings it back or
+// PurgeTrash removes it for good.  username, who must be one of its owners, is recorded as
+// the deleter.
+func (s *DataStore) Delete(k string, username string) error {
+	k = routes.NormalizeKey(k)
+	now := time.Now().Format(routes.TimeFormat)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lock, err := s.lockStatus(tx, k)
+	if err != nil {
+		return err
+	}
+	if err := lock.check(k, user); err != nil {
+		return err
+	}
+	if _, err := s.authorize(tx, k, user, AccessOwner, "delete"); err != nil {
+		return err
+	}
+
+	// snapshot the route before it goes so it can be restored later
+	if err := s.recordHistory(tx, k, "delete", user.ID, now); err != nil {
+		return err
+	}
+	res, err := tx.Exec(GetSQL(s.dbtype, "trashRouteSQL"), now, user.ID, k)
 	if err != nil {
 		return err
 	}
@@ -322,23 +498,52 @@ func (s *DataStore) Delete(k string) error {
 	if err != nil {
 		return err
 	}
+	if affect == 0 {
+		return ErrNotFound
+	}
 	if affect != 1 {
 		return fmt.Errorf("Invalid delete for %s -- impacted %d rows", k, affect)
 	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
-	// update the cache
-	// is it in the cache
-	// if it is, change the url
+	s.uncache(k)
+	s.keys.drop()
+	return nil
+}
 
-	if s.redis != nil {
-		s.redis.Del(k).Err()
-	} else if s.cache != nil {
-		if _, ok := s.cache.Get(k); !ok {
-			s.cache.Remove(k)
-		}
+// routeLock is whether a route is locked, by whom and why.
+type routeLock struct {
+	locked int
+	by     string
+	reason string
+}
+
+// check refuses user, unless an admin, a change to the locked route k, naming who locked it
+// and why.
+func (l routeLock) check(k string, user *User) error {
+	if l.locked != 1 || user.IsAdmin == 1 {
+		return nil
+	}
+	detail := ""
+	if l.by != "" {
+		detail = " by " + l.by
+	}
+	if l.reason != "" {
+		detail += " because " + l.reason
 	}
+	return fmt.Errorf("%w, %s was locked%s, only admins may change it and %s is not one", ErrLocked, k, detail, user.Name)
+}
 
-	return nil
+// lockStatus returns the lock of route k as seen inside tx.
+func (s *DataStore) lockStatus(tx *sql.Tx, k string) (routeLock, error) {
+	var l routeLock
+	err := tx.QueryRow(GetSQL(s.dbtype, "getURLIsLocked"), k).Scan(&l.locked, &l.by, &l.reason)
+	if err == sql.ErrNoRows {
+		return routeLock{}, ErrNotFound
+	}
+	return l, err
 }
 
 func (s *DataStore) IsSQLErrUniqueContraint(err error) bool {
@@ -358,6 +563,14 @@ func (s *DataStore) IsSQLErrUniqueContraint(err error) bool {
 			}
 		}
 		return false
+	} else if s.dbtype == "postgres" {
+		// 23505 unique_violation
+		if driverErr, ok := err.(*pq.Error); ok {
+			if driverErr.Code == "23505" {
+				return true
+			}
+		}
+		return false
 	}
 	return false
 }
@@ -382,6 +595,14 @@ func (s *DataStore) IsSQLErrDuplicateContraint(err error) bool {
 			}
 		}
 		return false
+	} else if s.dbtype == "postgres" {
+		// 23505 unique_violation covers both the primary key and unique indexes
+		if driverErr, ok := err.(*pq.Error); ok {
+			if driverErr.Code == "23505" {
+				return true
+			}
+		}
+		return false
 	}
 	return false
 }
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Revision is one entry in the edit history of a short key.  Route holds the route as it
+// stood after the change, or just before it for a delete.
+type Revision struct {
+	Revision  int          `json:"revision"`
+	Action    string       `json:"action"`
+	Route     routes.Route `json:"route"`
+	ChangedBy string       `json:"changedby"`
+	ChangedAt string       `json:"changedat"`
+}
+
+// recordHistory snapshots the current row for k into route_history as the next revision.
+// It must run inside the same transaction as the change it records.
+func (s *DataStore) recordHistory(tx *sql.Tx, k string, action string, userID int, now string) error {
+	_, err := tx.Exec(GetSQL(s.dbtype, "insertHistory"), k, action, userID, now, k)
+	return err
+}
+
+// History returns every revision of the short key k, oldest first.
+func (s *DataStore) History(k string) ([]Revision, error) {
+	k = routes.NormalizeKey(k)
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getHistory"), k)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]Revision, 0)
+	for rows.Next() {
+		var rev Revision
+		var creator, changedBy sql.NullString
+		err := rows.Scan(&rev.Revision, &rev.Action, &rev.Route.ShortKey, &rev.Route.URL, &rev.Route.FallbackURL, &rev.Route.Passthrough, &rev.Route.Targets, &rev.Route.Rotation, &rev.Route.Team,
+			&rev.Route.Locked, &creator, &rev.ChangedAt, &changedBy)
+		if err != nil {
+			return nil, err
+		}
+		rev.Route.Creator = creator.String
+		rev.ChangedBy = changedBy.String
+		rev.Route.LastModifiedBy = rev.ChangedBy
+		rev.Route.ModifiedAt = rev.ChangedAt
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+	return revisions, nil
+}
+
+// Restore rolls the short key k back to the urls, targets and team it had at revision.
+// If k has since been deleted it is taken out of the trash, or recreated under its original
+// creator once the trash has been purged.  The restore is itself recorded as a new revision
+// by username, who must be an owner or editor of k, or an owner to bring it back from the
+// trash or to move it back to another team.  Either way k has to fit the namespaces as they
+// are now, as it would to be added.
+func (s *DataStore) Restore(k string, revision int, username string) (int, error) {
+	k = routes.NormalizeKey(k)
+	now := time.Now().Format(routes.TimeFormat)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	var snap routes.Route
+	var creatorID int
+	var snapTeam sql.NullInt64
+	err = tx.QueryRow(GetSQL(s.dbtype, "getHistoryRevision"), k, revision).Scan(&snap.URL, &snap.FallbackURL, &snap.Passthrough, &snap.Targets, &snap.Rotation, &snapTeam, &creatorID)
+	if err == sql.ErrNoRows {
+		return -1, ErrNotFound
+	}
+	if err != nil {
+		return -1, err
+	}
+	// the team may have been deleted since, leaving the link without one
+	var teamID interface{}
+	var teamName string
+	if snapTeam.Valid {
+		t, err := s.teamByID(tx, int(snapTeam.Int64))
+		if err != nil && err != ErrNotFound {
+			return -1, err
+		}
+		if err == nil {
+			teamID, teamName = t.ID, t.Name
+		}
+	}
+
+	var res sql.Result
+	lock, err := s.lockStatus(tx, k)
+	switch {
+	case err == ErrNotFound:
+		// resurrect a deleted key, which only its owners may do
+		if err := s.authorizeRestore(tx, k, user, creatorID, teamID); err != nil {
+			return -1, err
+		}
+		// a namespace may have been handed to another team since
+		if err := s.checkNamespace(routes.Route{ShortKey: k, Team: teamName}, user); err != nil {
+			return -1, err
+		}
+		res, err = s.undelete(tx, k, user.ID, now)
+		if err == ErrNotFound {
+			res, err = tx.Exec(GetSQL(s.dbtype, "insertRoute"), k, snap.URL, snap.FallbackURL, snap.Passthrough, snap.Targets, snap.Rotation, creatorID, teamID, now, now, user.ID)
+		} else if err == nil {
+			res, err = tx.Exec(GetSQL(s.dbtype, "restoreRouteSQL"), snap.URL, snap.FallbackURL, snap.Passthrough, snap.Targets, snap.Rotation, teamID, user.ID, now, k)
+		}
+	case err != nil:
+		return -1, err
+	case lock.locked == 1 && user.IsAdmin != 1:
+		return -1, lock.check(k, user)
+	default:
+		var a routeAccess
+		if a, err = s.authorize(tx, k, user, AccessEditor, "restore"); err != nil {
+			return -1, err
+		}
+		// the team owns the link along with its creator, so only owners may change it
+		if a.team != teamName && a.access < AccessOwner {
+			return -1, fmt.Errorf("%w, %s may not restore %s to another team, only its owners and admins may", ErrForbidden, user.Name, k)
+		}
+		if a.team != teamName {
+			if err := s.checkNamespace(routes.Route{ShortKey: k, Team: teamName}, user); err != nil {
+				return -1, err
+			}
+		}
+		res, err = tx.Exec(GetSQL(s.dbtype, "restoreRouteSQL"), snap.URL, snap.FallbackURL, snap.Passthrough, snap.Targets, snap.Rotation, teamID, user.ID, now, k)
+	}
+	if err != nil {
+		return -1, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	if err := s.recordHistory(tx, k, "restore", user.ID, now); err != nil {
+		return -1, err
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+
+	s.uncache(k)
+	s.keys.drop()
+	return int(affect), nil
+}
+
+// authorizeRestore makes sure user owns k, a deleted route, to bring it back.  Once the
+// trash has been purged the route is gone, so its owners are the ones it had at the
+// revision being restored, creatorID and the team teamID.
+func (s *DataStore) authorizeRestore(tx *sql.Tx, k string, user *User, creatorID int, teamID interface{}) error {
+	_, err := s.authorize(tx, k, user, AccessOwner, "restore")
+	if err != ErrNotFound {
+		return err
+	}
+	var a routeAccess
+	if err := tx.QueryRow(GetSQL(s.dbtype, "getUserName"), creatorID).Scan(&a.creator); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	var defaultAccess Access
+	member := false
+	if id, ok := teamID.(int); ok {
+		t, err := s.teamByID(tx, id)
+		if err != nil {
+			return err
+		}
+		a.team, a.memberAccess, defaultAccess = t.Name, t.MemberAccess, t.DefaultAccess
+		var manager int
+		err = tx.QueryRow(GetSQL(s.dbtype, "getTeamMember"), id, user.ID).Scan(&manager)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		member = err == nil
+	}
+	a.grant(user, defaultAccess, member, false)
+	if a.access >= AccessOwner {
+		return nil
+	}
+	return forbidden(user, "restore", k, AccessOwner, a)
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// What Import does with a key that already exists.
+const (
+	// ImportSkip leaves the existing link alone.  This is the default.
+	ImportSkip = "skip"
+	// ImportOverwrite changes the existing link to match the import.
+	ImportOverwrite = "overwrite"
+	// ImportFail changes nothing if any key exists, any entry is invalid or the store
+	// refuses any entry.
+	ImportFail = "fail"
+)
+
+// What Import did, or in a dry run would do, with each entry.
+const (
+	ImportAdded       = "add"
+	ImportOverwritten = "overwrite"
+	ImportUnchanged   = "unchanged"
+	ImportSkipped     = "skip"
+	ImportError       = "error"
+)
+
+// ErrImportAborted is returned by an ImportFail import that found an entry it could not
+// take, along with the report saying which.
+var ErrImportAborted = errors.New("Import aborted, nothing was changed")
+
+// ImportResult reports on one entry of an import.  An entry can have an Error alongside
+// what was done with it, e.g. a link that was added but could not be locked.
+type ImportResult struct {
+	Row    int    `json:"row"`
+	Key    string `json:"key,omitempty"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Import adds the routes read by routes.ReadRoutes to s as user, who is the one recorded as
+// changing existing links and who must be an admin for locked entries to be locked.  mode
+// is one of ImportSkip, ImportOverwrite or ImportFail.  With dryRun nothing is changed and
+// the report says what would be; checks that only the store can make, such as namespace
+// ownership, are not part of it.
+func Import(s RouteStore, records []routes.Record, user string, mode string, dryRun bool) ([]ImportResult, error) {
+	switch mode {
+	case "":
+		mode = ImportSkip
+	case ImportSkip, ImportOverwrite, ImportFail:
+	default:
+		return nil, fmt.Errorf("Invalid import mode %s, expected skip, overwrite or fail", mode)
+	}
+
+	// plan every entry before changing anything, so that fail can back out cleanly
+	results := make([]ImportResult, len(records))
+	existing := make([]routes.Route, len(records))
+	seen := make(map[string]int)
+	failed := false
+	for i, rec := range records {
+		res := &results[i]
+		res.Row = rec.Row
+		res.Key = rec.Route.ShortKey
+		if rec.Err != nil {
+			res.Action, res.Error = ImportError, rec.Err.Error()
+			failed = true
+			continue
+		}
+		if row, ok := seen[res.Key]; ok {
+			res.Action, res.Error = ImportError, fmt.Sprintf("%s is already in row %d", res.Key, row)
+			failed = true
+			continue
+		}
+		seen[res.Key] = rec.Row
+
+		current, err := s.Get(res.Key)
+		existing[i] = current
+		switch {
+		case errors.Is(err, ErrNotFound):
+			res.Action = ImportAdded
+		case err != nil:
+			res.Action, res.Error = ImportError, err.Error()
+			failed = true
+		case sameLink(current, rec.Route):
+			res.Action = ImportUnchanged
+		case mode == ImportOverwrite:
+			res.Action = ImportOverwritten
+		case mode == ImportFail:
+			res.Action, res.Error = ImportError, fmt.Sprintf("%s already exists", res.Key)
+			failed = true
+		default:
+			res.Action = ImportSkipped
+		}
+	}
+	if failed && mode == ImportFail {
+		return results, ErrImportAborted
+	}
+	if dryRun {
+		return results, nil
+	}
+	if mode == ImportFail {
+		if err := addAll(s, records, results); err != nil {
+			return results, err
+		}
+	}
+
+	for i, rec := range records {
+		res := &results[i]
+		route := rec.Route
+		var err error
+		switch res.Action {
+		case ImportAdded:
+			if mode != ImportFail {
+				_, err = s.Add(route)
+			}
+		case ImportOverwritten:
+			// only the urls and settings change, the link keeps its creator and team
+			route.LastModifiedBy = user
+			route.Revision = existing[i].Revision
+			_, err = s.Modify(route)
+		case ImportUnchanged:
+		default:
+			continue
+		}
+		if err != nil {
+			res.Action, res.Error = ImportError, err.Error()
+			continue
+		}
+		// locks are only ever added, unlocking is up to an admin
+		if route.Locked == 1 && existing[i].Locked != 1 {
+			if _, err := s.Lock(routes.Route{ShortKey: route.ShortKey, LastModifiedBy: user}); err != nil {
+				res.Error = fmt.Sprintf("Not locked, %v", err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// addAll adds the new links of an ImportFail import in one go, so that when the store
+// refuses one of them, on grounds only it checks such as namespace ownership, none are
+// added and results say which it was.
+func addAll(s RouteStore, records []routes.Record, results []ImportResult) error {
+	var adds []routes.Route
+	var rows []int
+	for i, rec := range records {
+		if results[i].Action == ImportAdded {
+			adds = append(adds, rec.Route)
+			rows = append(rows, i)
+		}
+	}
+	n, err := s.AddAll(adds)
+	if err == nil {
+		return nil
+	}
+	if n < 0 {
+		return err
+	}
+	refused := rows[n]
+	for _, i := range rows {
+		results[i].Action, results[i].Error = ImportSkipped, fmt.Sprintf("Not imported, row %d was refused", records[refused].Row)
+	}
+	results[refused].Action, results[refused].Error = ImportError, err.Error()
+	return ErrImportAborted
+}
+
+// sameLink is whether a and b send people to the same place in the same way.
+func sameLink(a routes.Route, b routes.Route) bool {
+	if len(a.Targets) != len(b.Targets) {
+		return false
+	}
+	for i := range a.Targets {
+		if a.Targets[i] != b.Targets[i] {
+			return false
+		}
+	}
+	return a.URL == b.URL && a.FallbackURL == b.FallbackURL && a.Passthrough == b.Passthrough && a.Rotation == b.Rotation
+}
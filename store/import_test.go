@@ -0,0 +1,130 @@
+package store_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+	"github.com/tcotav/golinks/store/storetest"
+)
+
+func TestImport(t *testing.T) {
+	s, err := store.NewStore("sqlite", newSQLiteDB(t), nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"wiki", "jira"} {
+		r, _ := routes.NewRoute(k, "https://"+k+".example.com", "t@example.com", "")
+		if _, err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in := `shortkey,url,locked
+wiki,https://new-wiki.example.com,0
+jira,https://jira.example.com,1
+docs,https://docs.example.com,0
+docs,https://docs2.example.com,0
+bad key,https://example.com,0
+`
+	read := func() []routes.Record {
+		records, err := routes.ReadRoutes(strings.NewReader(in), routes.FormatCSV, storetest.Admin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	actions := func(results []store.ImportResult) []string {
+		var got []string
+		for _, res := range results {
+			got = append(got, res.Action)
+		}
+		return got
+	}
+
+	results, err := store.Import(s, read(), storetest.Admin, store.ImportFail, false)
+	if !errors.Is(err, store.ErrImportAborted) {
+		t.Errorf("Expected ErrImportAborted, got %v", err)
+	}
+	if expected := []string{"error", "unchanged", "add", "error", "error"}; !reflect.DeepEqual(actions(results), expected) {
+		t.Errorf("Expected %v, got %v", expected, actions(results))
+	}
+	if _, err := s.Get("docs"); !errors.Is(err, store.ErrNotFound) {
+		t.Error("A failed import added links")
+	}
+
+	results, err = store.Import(s, read(), storetest.Admin, store.ImportOverwrite, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"overwrite", "unchanged", "add", "error", "error"}; !reflect.DeepEqual(actions(results), expected) {
+		t.Errorf("Expected %v, got %v", expected, actions(results))
+	}
+	if got, _ := s.Get("wiki"); got.URL != "https://wiki.example.com" {
+		t.Error("A dry run changed links")
+	}
+
+	results, err = store.Import(s, read(), storetest.Admin, store.ImportSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"skip", "unchanged", "add", "error", "error"}; !reflect.DeepEqual(actions(results), expected) {
+		t.Errorf("Expected %v, got %v", expected, actions(results))
+	}
+	if results[3].Error != "docs is already in row 3" {
+		t.Errorf("Unexpected error for a repeated key, %s", results[3].Error)
+	}
+	if got, _ := s.Get("wiki"); got.URL != "https://wiki.example.com" {
+		t.Error("Skip changed an existing link")
+	}
+	if got, _ := s.Get("jira"); got.Locked != 1 {
+		t.Error("Locked entry was not locked")
+	}
+	if got, err := s.Get("docs"); err != nil || got.Creator != storetest.Admin {
+		t.Errorf("Expected docs added for the importer, got %+v %v", got, err)
+	}
+
+	if _, err := store.Import(s, read(), storetest.Admin, store.ImportOverwrite, false); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.Get("wiki")
+	if got.URL != "https://new-wiki.example.com" || got.Creator != "t@example.com" || got.LastModifiedBy != storetest.Admin {
+		t.Errorf("Unexpected overwritten link %+v", got)
+	}
+
+	if _, err := store.Import(s, read(), storetest.Admin, "merge", false); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+
+	// fail adds nothing when the store refuses any entry
+	if _, err := s.CreateTeam(store.Team{Name: "payments@example.com"}, storetest.Admin); err != nil {
+		t.Fatal(err)
+	}
+	ns, _ := routes.NewNamespace("payments", "payments@example.com", storetest.Admin)
+	if _, err := s.AddNamespace(ns); err != nil {
+		t.Fatal(err)
+	}
+	in = `shortkey,url,creator
+before,https://before.example.com,new@example.com
+payments/oncall,https://oncall.example.com,t@example.com
+after,https://after.example.com,t@example.com
+`
+	results, err = store.Import(s, read(), storetest.Admin, store.ImportFail, false)
+	if !errors.Is(err, store.ErrImportAborted) {
+		t.Errorf("Expected ErrImportAborted, got %v", err)
+	}
+	if expected := []string{"skip", "error", "skip"}; !reflect.DeepEqual(actions(results), expected) {
+		t.Errorf("Expected %v, got %v", expected, actions(results))
+	}
+	for _, k := range []string{"before", "after"} {
+		if _, err := s.Get(k); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("Expected %s left out of a refused import, got %v", k, err)
+		}
+	}
+	if _, err := s.FindUser("new@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected a refused import not to create its creators, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Schema migrations live in migrations/<dbtype>/NNNN_name.up.sql with a matching
+// NNNN_name.down.sql and are compiled into the binary.  Every dialect carries the same
+// versions so a database of any type ends up with the same logical schema.
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationState reports whether a Migration has been applied to a database.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Migrations returns every migration known for dbtype, ordered by version.
+func Migrations(dbtype string) ([]Migration, error) {
+	dir := path.Join("migrations", dbtype)
+	entries, err := migrationFS.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("No migrations for db type %s", dbtype)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Bad migration file name %s", name)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Bad migration file name %s", name)
+		}
+		body, err := migrationFS.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements breaks a migration file into individual statements, as the mysql
+// driver will not run more than one per Exec.  "--" comments are stripped first so they
+// are free to contain semicolons.
+func splitStatements(body string) []string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if idx := strings.Index(line, "--"); idx >= 0 {
+			lines[i] = line[:idx]
+		}
+	}
+
+	var stmts []string
+	for _, chunk := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt := strings.TrimSpace(chunk); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// appliedVersions returns the applied_at time of every version in schema_version,
+// creating the table if this is a brand new database.
+func appliedVersions(db *sql.DB, dbtype string) (map[int]string, error) {
+	if _, err := db.Exec(GetSQL(dbtype, "createSchemaVersion")); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(GetSQL(dbtype, "getSchemaVersions"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration executes one direction of m and records it in schema_version within
+// a single transaction.
+func runMigration(db *sql.DB, dbtype string, m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body := m.down
+	if up {
+		body = m.up
+	}
+	for _, stmt := range splitStatements(body) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+
+	if up {
+		now := time.Now().Format(routes.TimeFormat)
+		_, err = tx.Exec(GetSQL(dbtype, "insertSchemaVersion"), m.Version, m.Name, now)
+	} else {
+		_, err = tx.Exec(GetSQL(dbtype, "deleteSchemaVersion"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies every pending migration in order and returns the versions applied.
+func MigrateUp(db *sql.DB, dbtype string) ([]int, error) {
+	migrations, err := Migrations(dbtype)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db, dbtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := runMigration(db, dbtype, m, true); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the newest steps applied migrations and returns the versions reverted.
+func MigrateDown(db *sql.DB, dbtype string, steps int) ([]int, error) {
+	migrations, err := Migrations(dbtype)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db, dbtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := runMigration(db, dbtype, m, false); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied.
+func MigrationStatus(db *sql.DB, dbtype string) ([]MigrationState, error) {
+	migrations, err := Migrations(dbtype)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db, dbtype)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+	return states, nil
+}
@@ -0,0 +1,122 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/tcotav/golinks/store"
+)
+
+func TestMigrations(t *testing.T) {
+	for _, dbtype := range []string{"sqlite", "mysql", "postgres"} {
+		if _, err := store.Migrations(dbtype); err != nil {
+			t.Error(err)
+		}
+	}
+	sqlite, _ := store.Migrations("sqlite")
+	for _, dbtype := range []string{"mysql", "postgres"} {
+		other, _ := store.Migrations(dbtype)
+		if len(other) != len(sqlite) {
+			t.Errorf("%s has %d migrations, sqlite has %d", dbtype, len(other), len(sqlite))
+			continue
+		}
+		for i := range other {
+			if other[i].Version != sqlite[i].Version || other[i].Name != sqlite[i].Name {
+				t.Errorf("%s migration %04d_%s does not match sqlite %04d_%s", dbtype,
+					other[i].Version, other[i].Name, sqlite[i].Version, sqlite[i].Name)
+			}
+		}
+	}
+	if _, err := store.Migrations("oracle"); err == nil {
+		t.Error("Expected error for unknown db type")
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db := openSQLiteDB(t)
+	migrations, err := store.Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := store.MigrateUp(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Errorf("Expected %d migrations applied, got %v", len(migrations), done)
+	}
+
+	// nothing left to do the second time around
+	done, err = store.MigrateUp(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 0 {
+		t.Errorf("Expected no migrations applied, got %v", done)
+	}
+
+	states, err := store.MigrationStatus(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range states {
+		if !st.Applied {
+			t.Errorf("Migration %d not reported as applied", st.Version)
+		}
+	}
+
+	done, err = store.MigrateDown(db, "sqlite", len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) || done[0] != migrations[len(migrations)-1].Version {
+		t.Errorf("Expected every migration reverted newest first, got %v", done)
+	}
+	states, err = store.MigrationStatus(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range states {
+		if st.Applied {
+			t.Errorf("Migration %d still reported as applied", st.Version)
+		}
+	}
+
+	// and back up again from scratch
+	if _, err := store.MigrateUp(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMigrateAdoptsHandBuiltSchema covers databases that were set up by hand from the old
+// sql/sqlite3_init.sql before migrations existed.
+func TestMigrateAdoptsHandBuiltSchema(t *testing.T) {
+	db := openSQLiteDB(t)
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY, name TEXT, isadmin int, created_at datetime)",
+		"CREATE UNIQUE INDEX idx_users_name ON users(name)",
+		"CREATE TABLE IF NOT EXISTS routes (id INTEGER PRIMARY KEY, short_key TEXT, url TEXT, creatorid int, teamid int, created_at datetime, modified_at datetime, last_modified_by int, locked int default 0)",
+		"CREATE UNIQUE INDEX idx_short_key ON routes(short_key)",
+		"INSERT INTO users(name, isadmin) VALUES('t@example.com', 0)",
+		"INSERT INTO routes(short_key, url, creatorid, teamid, created_at, modified_at, last_modified_by) VALUES('a', 'http://www.google.com', 1, 'team@example.com', '2020-01-01 00:00:00', '2020-01-01 00:00:00', 1)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.MigrateUp(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.NewStore("sqlite", db, nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Team != "team@example.com" || r.Creator != "t@example.com" {
+		t.Errorf("Unexpected route after migration %+v", r)
+	}
+}
@@ -0,0 +1,2 @@
+-- getUser has always selected isadmin, but the mysql users table never had it
+ALTER TABLE users ADD COLUMN isadmin int default 0;
@@ -0,0 +1,16 @@
+-- one row per change to a route, holding the route as it stood after the change
+-- (or just before it, for deletes)
+CREATE TABLE IF NOT EXISTS route_history (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			short_key VARCHAR(20), 
+			revision int, 
+			action VARCHAR(10), -- add, modify, lock, delete or restore
+			url VARCHAR(4000), 
+			team VARCHAR(40), 
+			locked int, 
+			creatorid int, 
+			changed_by int, 
+			changed_at datetime, 
+			UNIQUE KEY idx_route_history_revision (short_key, revision),
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(changed_by) REFERENCES users(id)
+			);
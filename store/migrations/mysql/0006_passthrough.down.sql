@@ -0,0 +1,2 @@
+ALTER TABLE route_history DROP COLUMN passthrough;
+ALTER TABLE routes DROP COLUMN passthrough;
@@ -0,0 +1,4 @@
+-- fails if any key has grown past 20 characters
+ALTER TABLE route_history MODIFY short_key VARCHAR(20);
+ALTER TABLE routes MODIFY short_key VARCHAR(20);
+DROP TABLE IF EXISTS namespaces;
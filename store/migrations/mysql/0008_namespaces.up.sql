@@ -0,0 +1,12 @@
+-- key prefixes owned by a team; only that team may create keys under them
+CREATE TABLE IF NOT EXISTS namespaces (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			name VARCHAR(200), 
+			team VARCHAR(40), 
+			creatorid int, 
+			created_at datetime, 
+			UNIQUE KEY idx_namespaces_name (name),
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+-- namespaced keys need more than 20 characters, see routes.MaxKeyLength
+ALTER TABLE routes MODIFY short_key VARCHAR(200);
+ALTER TABLE route_history MODIFY short_key VARCHAR(200);
@@ -0,0 +1,2 @@
+-- bumped by every change to a route so that concurrent edits can be detected
+ALTER TABLE routes ADD COLUMN revision INT NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+ALTER TABLE routes DROP COLUMN managed;
@@ -0,0 +1,2 @@
+-- set on links declared in a synced directory, see goservice sync
+ALTER TABLE routes ADD COLUMN managed INT NOT NULL DEFAULT 0;
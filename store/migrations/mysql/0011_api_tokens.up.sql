@@ -0,0 +1,13 @@
+-- personal API tokens, kept as a sha256 of the token; scopes are space separated
+CREATE TABLE IF NOT EXISTS api_tokens (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			userid int NOT NULL, 
+			name VARCHAR(100) NOT NULL, 
+			token_hash CHAR(64) NOT NULL, 
+			scopes VARCHAR(200) NOT NULL, 
+			created_at datetime, 
+			expires_at datetime, 
+			last_used_at datetime, 
+			UNIQUE KEY idx_api_tokens_hash (token_hash),
+			UNIQUE KEY idx_api_tokens_name (userid, name),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
@@ -0,0 +1,17 @@
+-- users an owner has let edit a link, on top of its creator and team; rows go when the
+-- route is purged, so routeid has no foreign key to hold that up
+CREATE TABLE IF NOT EXISTS link_editors (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			routeid int NOT NULL, 
+			userid int NOT NULL, 
+			granted_by int, 
+			created_at datetime, 
+			UNIQUE KEY idx_link_editors (routeid, userid),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+-- the teams a user is in, as the identity provider has them; members own their team's links
+CREATE TABLE IF NOT EXISTS user_teams (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			userid int NOT NULL, 
+			team VARCHAR(40) NOT NULL, 
+			UNIQUE KEY idx_user_teams (userid, team),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
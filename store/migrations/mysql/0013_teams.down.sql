@@ -0,0 +1,20 @@
+-- back to team names, losing the teams' settings and managers
+ALTER TABLE routes ADD COLUMN team VARCHAR(40);
+UPDATE routes r JOIN teams t ON t.id = r.teamid SET r.team = t.name;
+ALTER TABLE routes DROP FOREIGN KEY fk_routes_team, DROP COLUMN teamid;
+ALTER TABLE route_history ADD COLUMN team VARCHAR(40);
+UPDATE route_history h JOIN teams t ON t.id = h.teamid SET h.team = t.name;
+ALTER TABLE route_history DROP COLUMN teamid;
+ALTER TABLE namespaces ADD COLUMN team VARCHAR(40);
+UPDATE namespaces n JOIN teams t ON t.id = n.teamid SET n.team = t.name;
+ALTER TABLE namespaces DROP FOREIGN KEY fk_namespaces_team, DROP COLUMN teamid;
+
+CREATE TABLE IF NOT EXISTS user_teams (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			userid int NOT NULL, 
+			team VARCHAR(40) NOT NULL, 
+			UNIQUE KEY idx_user_teams (userid, team),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+INSERT INTO user_teams(userid, team) SELECT m.userid, t.name FROM team_members m JOIN teams t ON t.id = m.teamid;
+DROP TABLE team_members;
+DROP TABLE teams;
@@ -0,0 +1,38 @@
+-- teams own links and namespaces by id instead of by a free-form name; member_access is
+-- what the members may do to the team's links and default_access what everyone else may,
+-- as a store.Access: 0 none, 1 editor, 2 owner
+CREATE TABLE IF NOT EXISTS teams (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			name VARCHAR(40) NOT NULL, 
+			member_access int NOT NULL DEFAULT 2, 
+			default_access int NOT NULL DEFAULT 0, 
+			creatorid int, 
+			created_at datetime, 
+			UNIQUE KEY idx_teams_name (name),
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+-- managers may change a team's members and settings
+CREATE TABLE IF NOT EXISTS team_members (id INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY, 
+			teamid int NOT NULL, 
+			userid int NOT NULL, 
+			manager int NOT NULL DEFAULT 0, 
+			created_at datetime, 
+			UNIQUE KEY idx_team_members (teamid, userid),
+			FOREIGN KEY(teamid) REFERENCES teams(id),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+
+-- every team named so far becomes a row, and user_teams its members
+INSERT INTO teams(name, created_at) SELECT team, NOW() FROM (SELECT team FROM routes UNION SELECT team FROM namespaces UNION SELECT team FROM route_history UNION SELECT team FROM user_teams) names WHERE team IS NOT NULL AND team <> '';
+INSERT INTO team_members(teamid, userid, created_at) SELECT t.id, u.userid, NOW() FROM user_teams u JOIN teams t ON t.name = u.team;
+DROP TABLE user_teams;
+
+ALTER TABLE routes ADD COLUMN teamid int, ADD CONSTRAINT fk_routes_team FOREIGN KEY(teamid) REFERENCES teams(id);
+UPDATE routes r JOIN teams t ON t.name = r.team SET r.teamid = t.id;
+ALTER TABLE routes DROP COLUMN team;
+-- history keeps the id of the team a route had, which may since have been deleted
+ALTER TABLE route_history ADD COLUMN teamid int;
+UPDATE route_history h JOIN teams t ON t.name = h.team SET h.teamid = t.id;
+ALTER TABLE route_history DROP COLUMN team;
+ALTER TABLE namespaces ADD COLUMN teamid int, ADD CONSTRAINT fk_namespaces_team FOREIGN KEY(teamid) REFERENCES teams(id);
+UPDATE namespaces n JOIN teams t ON t.name = n.team SET n.teamid = t.id;
+ALTER TABLE namespaces DROP COLUMN team;
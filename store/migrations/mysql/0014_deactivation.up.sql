@@ -0,0 +1,3 @@
+-- set on users who have left; they may no longer sign in and their links show up as
+-- orphaned until an admin transfers them
+ALTER TABLE users ADD COLUMN deactivated INT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE routes DROP COLUMN lock_reason;
+ALTER TABLE routes DROP COLUMN locked_at;
+ALTER TABLE routes DROP COLUMN locked_by;
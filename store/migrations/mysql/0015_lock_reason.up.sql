@@ -0,0 +1,4 @@
+-- who locked a route, when and why, so those who may no longer change it know whom to ask
+ALTER TABLE routes ADD COLUMN locked_by int;
+ALTER TABLE routes ADD COLUMN locked_at datetime;
+ALTER TABLE routes ADD COLUMN lock_reason VARCHAR(255);
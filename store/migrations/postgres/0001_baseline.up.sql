@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS users (id SERIAL PRIMARY KEY, name VARCHAR(50), isadmin int default 0, created_at timestamp, modified_at timestamp, last_modified_by int);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name);
+CREATE TABLE IF NOT EXISTS routes (id SERIAL PRIMARY KEY, 
+			short_key VARCHAR(20), 
+			url VARCHAR(4000),
+			creatorid int REFERENCES users(id), 
+			team VARCHAR(40), 
+			created_at timestamp, 
+			modified_at timestamp, 
+			last_modified_by int REFERENCES users(id),
+			locked int default 0 -- 0 means unlocked, 1 is locked
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_short_key ON routes(short_key);
@@ -0,0 +1 @@
+-- postgres started out with the reconciled schema, nothing to do
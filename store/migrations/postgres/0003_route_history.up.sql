@@ -0,0 +1,14 @@
+-- one row per change to a route, holding the route as it stood after the change
+-- (or just before it, for deletes)
+CREATE TABLE IF NOT EXISTS route_history (id SERIAL PRIMARY KEY, 
+			short_key VARCHAR(20), 
+			revision int, 
+			action VARCHAR(10), -- add, modify, lock, delete or restore
+			url VARCHAR(4000), 
+			team VARCHAR(40), 
+			locked int, 
+			creatorid int REFERENCES users(id), 
+			changed_by int REFERENCES users(id), 
+			changed_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_history_revision ON route_history(short_key, revision);
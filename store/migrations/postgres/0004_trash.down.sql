@@ -0,0 +1,3 @@
+DELETE FROM routes where deleted_at IS NOT NULL;
+ALTER TABLE routes DROP COLUMN deleted_by;
+ALTER TABLE routes DROP COLUMN deleted_at;
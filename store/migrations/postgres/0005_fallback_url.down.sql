@@ -0,0 +1,2 @@
+ALTER TABLE route_history DROP COLUMN fallback_url;
+ALTER TABLE routes DROP COLUMN fallback_url;
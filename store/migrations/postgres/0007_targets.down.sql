@@ -0,0 +1,4 @@
+ALTER TABLE route_history DROP COLUMN rotation;
+ALTER TABLE route_history DROP COLUMN targets;
+ALTER TABLE routes DROP COLUMN rotation;
+ALTER TABLE routes DROP COLUMN targets;
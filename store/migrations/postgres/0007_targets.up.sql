@@ -0,0 +1,5 @@
+-- JSON list of {url, weight} for links that rotate through several targets, '' otherwise
+ALTER TABLE routes ADD COLUMN targets TEXT NOT NULL DEFAULT '';
+ALTER TABLE routes ADD COLUMN rotation VARCHAR(10) NOT NULL DEFAULT '';
+ALTER TABLE route_history ADD COLUMN targets TEXT NOT NULL DEFAULT '';
+ALTER TABLE route_history ADD COLUMN rotation VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- fails if any key has grown past 20 characters
+ALTER TABLE route_history ALTER COLUMN short_key TYPE VARCHAR(20);
+ALTER TABLE routes ALTER COLUMN short_key TYPE VARCHAR(20);
+DROP TABLE IF EXISTS namespaces;
@@ -0,0 +1,11 @@
+-- key prefixes owned by a team; only that team may create keys under them
+CREATE TABLE IF NOT EXISTS namespaces (id SERIAL PRIMARY KEY, 
+			name VARCHAR(200), 
+			team VARCHAR(40), 
+			creatorid int REFERENCES users(id), 
+			created_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_name ON namespaces(name);
+-- namespaced keys need more than 20 characters, see routes.MaxKeyLength
+ALTER TABLE routes ALTER COLUMN short_key TYPE VARCHAR(200);
+ALTER TABLE route_history ALTER COLUMN short_key TYPE VARCHAR(200);
@@ -0,0 +1,12 @@
+-- personal API tokens, kept as a sha256 of the token; scopes are space separated
+CREATE TABLE IF NOT EXISTS api_tokens (id SERIAL PRIMARY KEY, 
+			userid int NOT NULL REFERENCES users(id), 
+			name VARCHAR(100) NOT NULL, 
+			token_hash CHAR(64) NOT NULL, 
+			scopes VARCHAR(200) NOT NULL, 
+			created_at timestamp, 
+			expires_at timestamp, 
+			last_used_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_hash ON api_tokens(token_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_name ON api_tokens(userid, name);
@@ -0,0 +1,15 @@
+-- users an owner has let edit a link, on top of its creator and team; rows go when the
+-- route is purged, so routeid has no foreign key to hold that up
+CREATE TABLE IF NOT EXISTS link_editors (id SERIAL PRIMARY KEY, 
+			routeid int NOT NULL, 
+			userid int NOT NULL REFERENCES users(id), 
+			granted_by int, 
+			created_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_link_editors ON link_editors(routeid, userid);
+-- the teams a user is in, as the identity provider has them; members own their team's links
+CREATE TABLE IF NOT EXISTS user_teams (id SERIAL PRIMARY KEY, 
+			userid int NOT NULL REFERENCES users(id), 
+			team VARCHAR(40) NOT NULL
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_teams ON user_teams(userid, team);
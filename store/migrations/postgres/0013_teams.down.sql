@@ -0,0 +1,19 @@
+-- back to team names, losing the teams' settings and managers
+ALTER TABLE routes ADD COLUMN team VARCHAR(40);
+UPDATE routes r SET team = t.name FROM teams t WHERE t.id = r.teamid;
+ALTER TABLE routes DROP COLUMN teamid;
+ALTER TABLE route_history ADD COLUMN team VARCHAR(40);
+UPDATE route_history h SET team = t.name FROM teams t WHERE t.id = h.teamid;
+ALTER TABLE route_history DROP COLUMN teamid;
+ALTER TABLE namespaces ADD COLUMN team VARCHAR(40);
+UPDATE namespaces n SET team = t.name FROM teams t WHERE t.id = n.teamid;
+ALTER TABLE namespaces DROP COLUMN teamid;
+
+CREATE TABLE IF NOT EXISTS user_teams (id SERIAL PRIMARY KEY, 
+			userid int NOT NULL REFERENCES users(id), 
+			team VARCHAR(40) NOT NULL
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_teams ON user_teams(userid, team);
+INSERT INTO user_teams(userid, team) SELECT m.userid, t.name FROM team_members m JOIN teams t ON t.id = m.teamid;
+DROP TABLE team_members;
+DROP TABLE teams;
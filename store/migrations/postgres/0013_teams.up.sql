@@ -0,0 +1,35 @@
+-- teams own links and namespaces by id instead of by a free-form name; member_access is
+-- what the members may do to the team's links and default_access what everyone else may,
+-- as a store.Access: 0 none, 1 editor, 2 owner
+CREATE TABLE IF NOT EXISTS teams (id SERIAL PRIMARY KEY, 
+			name VARCHAR(40) NOT NULL, 
+			member_access int NOT NULL DEFAULT 2, 
+			default_access int NOT NULL DEFAULT 0, 
+			creatorid int REFERENCES users(id), 
+			created_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_name ON teams(name);
+-- managers may change a team's members and settings
+CREATE TABLE IF NOT EXISTS team_members (id SERIAL PRIMARY KEY, 
+			teamid int NOT NULL REFERENCES teams(id), 
+			userid int NOT NULL REFERENCES users(id), 
+			manager int NOT NULL DEFAULT 0, 
+			created_at timestamp
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_members ON team_members(teamid, userid);
+
+-- every team named so far becomes a row, and user_teams its members
+INSERT INTO teams(name, created_at) SELECT team, NOW() FROM (SELECT team FROM routes UNION SELECT team FROM namespaces UNION SELECT team FROM route_history UNION SELECT team FROM user_teams) AS names WHERE team IS NOT NULL AND team <> '';
+INSERT INTO team_members(teamid, userid, created_at) SELECT t.id, u.userid, NOW() FROM user_teams u JOIN teams t ON t.name = u.team;
+DROP TABLE user_teams;
+
+ALTER TABLE routes ADD COLUMN teamid int REFERENCES teams(id);
+UPDATE routes r SET teamid = t.id FROM teams t WHERE t.name = r.team;
+ALTER TABLE routes DROP COLUMN team;
+-- history keeps the id of the team a route had, which may since have been deleted
+ALTER TABLE route_history ADD COLUMN teamid int;
+UPDATE route_history h SET teamid = t.id FROM teams t WHERE t.name = h.team;
+ALTER TABLE route_history DROP COLUMN team;
+ALTER TABLE namespaces ADD COLUMN teamid int REFERENCES teams(id);
+UPDATE namespaces n SET teamid = t.id FROM teams t WHERE t.name = n.team;
+ALTER TABLE namespaces DROP COLUMN team;
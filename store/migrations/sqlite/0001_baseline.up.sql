@@ -1,5 +1,6 @@
+-- the schema as it was applied by hand from sql/sqlite3_init.sql
 CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY, name TEXT, isadmin int, created_at datetime);
-CREATE UNIQUE INDEX idx_users_name ON users(name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name);
 CREATE TABLE IF NOT EXISTS routes (id INTEGER PRIMARY KEY, 
 			short_key TEXT, 
 			url TEXT,	
@@ -12,4 +13,4 @@ CREATE TABLE IF NOT EXISTS routes (id INTEGER PRIMARY KEY,
 			FOREIGN KEY(creatorid) REFERENCES users(id),
 			FOREIGN KEY(last_modified_by) REFERENCES users(id)
 			);
-CREATE UNIQUE INDEX idx_short_key ON routes(short_key);
\ No newline at end of file
+CREATE UNIQUE INDEX IF NOT EXISTS idx_short_key ON routes(short_key);
@@ -0,0 +1,2 @@
+-- sqlite cannot drop columns, so the users audit columns stay behind
+ALTER TABLE routes RENAME COLUMN team TO teamid;
@@ -0,0 +1,5 @@
+-- bring sqlite in line with the other dialects: users get the audit columns and
+-- routes store the team name rather than an id
+ALTER TABLE users ADD COLUMN modified_at datetime;
+ALTER TABLE users ADD COLUMN last_modified_by int;
+ALTER TABLE routes RENAME COLUMN teamid TO team;
@@ -0,0 +1,16 @@
+-- one row per change to a route, holding the route as it stood after the change
+-- (or just before it, for deletes)
+CREATE TABLE IF NOT EXISTS route_history (id INTEGER PRIMARY KEY, 
+			short_key TEXT, 
+			revision int, 
+			action TEXT, -- add, modify, lock, delete or restore
+			url TEXT, 
+			team TEXT, 
+			locked int, 
+			creatorid int, 
+			changed_by int, 
+			changed_at datetime, 
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(changed_by) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_history_revision ON route_history(short_key, revision);
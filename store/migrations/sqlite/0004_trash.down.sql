@@ -0,0 +1,2 @@
+-- sqlite cannot drop columns, so just empty the trash; deleted_at stays behind unused
+DELETE FROM routes where deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- deleted routes stay in the table, marked with who trashed them and when, until the
+-- purger removes them for good
+ALTER TABLE routes ADD COLUMN deleted_at datetime;
+ALTER TABLE routes ADD COLUMN deleted_by int;
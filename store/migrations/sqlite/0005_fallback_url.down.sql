@@ -0,0 +1 @@
+-- sqlite cannot drop columns, fallback_url stays behind unused
@@ -0,0 +1,3 @@
+-- where a templated link goes when it is used without its arguments
+ALTER TABLE routes ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE route_history ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+-- sqlite cannot drop columns, passthrough stays behind unused
@@ -0,0 +1,3 @@
+-- what happens to path and query after the key: '' or append, ignore, strict
+ALTER TABLE routes ADD COLUMN passthrough TEXT NOT NULL DEFAULT '';
+ALTER TABLE route_history ADD COLUMN passthrough TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+-- sqlite cannot drop columns, targets and rotation stay behind unused
@@ -0,0 +1,9 @@
+-- key prefixes owned by a team; only that team may create keys under them
+CREATE TABLE IF NOT EXISTS namespaces (id INTEGER PRIMARY KEY, 
+			name TEXT, 
+			team TEXT, 
+			creatorid int, 
+			created_at datetime, 
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_name ON namespaces(name);
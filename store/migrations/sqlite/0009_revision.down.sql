@@ -0,0 +1 @@
+-- sqlite cannot drop columns, revision stays behind unused
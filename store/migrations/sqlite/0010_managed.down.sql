@@ -0,0 +1 @@
+-- sqlite cannot drop columns, managed stays behind unused
@@ -0,0 +1,13 @@
+-- personal API tokens, kept as a sha256 of the token; scopes are space separated
+CREATE TABLE IF NOT EXISTS api_tokens (id INTEGER PRIMARY KEY, 
+			userid int NOT NULL, 
+			name TEXT NOT NULL, 
+			token_hash TEXT NOT NULL, 
+			scopes TEXT NOT NULL, 
+			created_at datetime, 
+			expires_at datetime, 
+			last_used_at datetime, 
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_hash ON api_tokens(token_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_name ON api_tokens(userid, name);
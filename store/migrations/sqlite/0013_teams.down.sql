@@ -0,0 +1,69 @@
+-- back to team names, losing the teams' settings and managers
+CREATE TABLE routes_names (id INTEGER PRIMARY KEY, 
+			short_key TEXT, 
+			url TEXT, 
+			creatorid int, 
+			team TEXT, 
+			created_at datetime, 
+			modified_at datetime, 
+			last_modified_by int, 
+			locked int default 0, 
+			deleted_at datetime, 
+			deleted_by int, 
+			fallback_url TEXT NOT NULL DEFAULT '', 
+			passthrough TEXT NOT NULL DEFAULT '', 
+			targets TEXT NOT NULL DEFAULT '', 
+			rotation TEXT NOT NULL DEFAULT '', 
+			revision INTEGER NOT NULL DEFAULT 1, 
+			managed INTEGER NOT NULL DEFAULT 0, 
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(last_modified_by) REFERENCES users(id)
+			);
+INSERT INTO routes_names(id, short_key, url, creatorid, team, created_at, modified_at, last_modified_by, locked, deleted_at, deleted_by, fallback_url, passthrough, targets, rotation, revision, managed) SELECT r.id, r.short_key, r.url, r.creatorid, t.name, r.created_at, r.modified_at, r.last_modified_by, r.locked, r.deleted_at, r.deleted_by, r.fallback_url, r.passthrough, r.targets, r.rotation, r.revision, r.managed FROM routes r LEFT JOIN teams t ON t.id = r.teamid;
+DROP TABLE routes;
+ALTER TABLE routes_names RENAME TO routes;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_short_key ON routes(short_key);
+
+CREATE TABLE route_history_names (id INTEGER PRIMARY KEY, 
+			short_key TEXT, 
+			revision int, 
+			action TEXT, 
+			url TEXT, 
+			team TEXT, 
+			locked int, 
+			creatorid int, 
+			changed_by int, 
+			changed_at datetime, 
+			fallback_url TEXT NOT NULL DEFAULT '', 
+			passthrough TEXT NOT NULL DEFAULT '', 
+			targets TEXT NOT NULL DEFAULT '', 
+			rotation TEXT NOT NULL DEFAULT '', 
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(changed_by) REFERENCES users(id)
+			);
+INSERT INTO route_history_names(id, short_key, revision, action, url, team, locked, creatorid, changed_by, changed_at, fallback_url, passthrough, targets, rotation) SELECT h.id, h.short_key, h.revision, h.action, h.url, t.name, h.locked, h.creatorid, h.changed_by, h.changed_at, h.fallback_url, h.passthrough, h.targets, h.rotation FROM route_history h LEFT JOIN teams t ON t.id = h.teamid;
+DROP TABLE route_history;
+ALTER TABLE route_history_names RENAME TO route_history;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_history_revision ON route_history(short_key, revision);
+
+CREATE TABLE namespaces_names (id INTEGER PRIMARY KEY, 
+			name TEXT, 
+			team TEXT, 
+			creatorid int, 
+			created_at datetime, 
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+INSERT INTO namespaces_names(id, name, team, creatorid, created_at) SELECT n.id, n.name, t.name, n.creatorid, n.created_at FROM namespaces n LEFT JOIN teams t ON t.id = n.teamid;
+DROP TABLE namespaces;
+ALTER TABLE namespaces_names RENAME TO namespaces;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_name ON namespaces(name);
+
+CREATE TABLE IF NOT EXISTS user_teams (id INTEGER PRIMARY KEY, 
+			userid int NOT NULL, 
+			team TEXT NOT NULL, 
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_teams ON user_teams(userid, team);
+INSERT INTO user_teams(userid, team) SELECT m.userid, t.name FROM team_members m JOIN teams t ON t.id = m.teamid;
+DROP TABLE team_members;
+DROP TABLE teams;
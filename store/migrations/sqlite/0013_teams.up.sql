@@ -0,0 +1,90 @@
+-- teams own links and namespaces by id instead of by a free-form name; member_access is
+-- what the members may do to the team's links and default_access what everyone else may,
+-- as a store.Access: 0 none, 1 editor, 2 owner
+CREATE TABLE IF NOT EXISTS teams (id INTEGER PRIMARY KEY, 
+			name TEXT NOT NULL, 
+			member_access int NOT NULL DEFAULT 2, 
+			default_access int NOT NULL DEFAULT 0, 
+			creatorid int, 
+			created_at datetime, 
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_name ON teams(name);
+-- managers may change a team's members and settings
+CREATE TABLE IF NOT EXISTS team_members (id INTEGER PRIMARY KEY, 
+			teamid int NOT NULL, 
+			userid int NOT NULL, 
+			manager int NOT NULL DEFAULT 0, 
+			created_at datetime, 
+			FOREIGN KEY(teamid) REFERENCES teams(id),
+			FOREIGN KEY(userid) REFERENCES users(id)
+			);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_members ON team_members(teamid, userid);
+
+-- every team named so far becomes a row, and user_teams its members
+INSERT INTO teams(name, created_at) SELECT team, CURRENT_TIMESTAMP FROM (SELECT team FROM routes UNION SELECT team FROM namespaces UNION SELECT team FROM route_history UNION SELECT team FROM user_teams) WHERE team IS NOT NULL AND team <> '';
+INSERT INTO team_members(teamid, userid, created_at) SELECT t.id, u.userid, CURRENT_TIMESTAMP FROM user_teams u JOIN teams t ON t.name = u.team;
+DROP TABLE user_teams;
+
+-- sqlite cannot drop columns, so the tables holding a team are rebuilt around teamid
+CREATE TABLE routes_teams (id INTEGER PRIMARY KEY, 
+			short_key TEXT, 
+			url TEXT, 
+			creatorid int, 
+			teamid int, 
+			created_at datetime, 
+			modified_at datetime, 
+			last_modified_by int, 
+			locked int default 0, 
+			deleted_at datetime, 
+			deleted_by int, 
+			fallback_url TEXT NOT NULL DEFAULT '', 
+			passthrough TEXT NOT NULL DEFAULT '', 
+			targets TEXT NOT NULL DEFAULT '', 
+			rotation TEXT NOT NULL DEFAULT '', 
+			revision INTEGER NOT NULL DEFAULT 1, 
+			managed INTEGER NOT NULL DEFAULT 0, 
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(teamid) REFERENCES teams(id),
+			FOREIGN KEY(last_modified_by) REFERENCES users(id)
+			);
+INSERT INTO routes_teams(id, short_key, url, creatorid, teamid, created_at, modified_at, last_modified_by, locked, deleted_at, deleted_by, fallback_url, passthrough, targets, rotation, revision, managed) SELECT r.id, r.short_key, r.url, r.creatorid, t.id, r.created_at, r.modified_at, r.last_modified_by, r.locked, r.deleted_at, r.deleted_by, r.fallback_url, r.passthrough, r.targets, r.rotation, r.revision, r.managed FROM routes r LEFT JOIN teams t ON t.name = r.team;
+DROP TABLE routes;
+ALTER TABLE routes_teams RENAME TO routes;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_short_key ON routes(short_key);
+
+-- history keeps the id of the team a route had, which may since have been deleted
+CREATE TABLE route_history_teams (id INTEGER PRIMARY KEY, 
+			short_key TEXT, 
+			revision int, 
+			action TEXT, 
+			url TEXT, 
+			teamid int, 
+			locked int, 
+			creatorid int, 
+			changed_by int, 
+			changed_at datetime, 
+			fallback_url TEXT NOT NULL DEFAULT '', 
+			passthrough TEXT NOT NULL DEFAULT '', 
+			targets TEXT NOT NULL DEFAULT '', 
+			rotation TEXT NOT NULL DEFAULT '', 
+			FOREIGN KEY(creatorid) REFERENCES users(id),
+			FOREIGN KEY(changed_by) REFERENCES users(id)
+			);
+INSERT INTO route_history_teams(id, short_key, revision, action, url, teamid, locked, creatorid, changed_by, changed_at, fallback_url, passthrough, targets, rotation) SELECT h.id, h.short_key, h.revision, h.action, h.url, t.id, h.locked, h.creatorid, h.changed_by, h.changed_at, h.fallback_url, h.passthrough, h.targets, h.rotation FROM route_history h LEFT JOIN teams t ON t.name = h.team;
+DROP TABLE route_history;
+ALTER TABLE route_history_teams RENAME TO route_history;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_history_revision ON route_history(short_key, revision);
+
+CREATE TABLE namespaces_teams (id INTEGER PRIMARY KEY, 
+			name TEXT, 
+			teamid int, 
+			creatorid int, 
+			created_at datetime, 
+			FOREIGN KEY(teamid) REFERENCES teams(id),
+			FOREIGN KEY(creatorid) REFERENCES users(id)
+			);
+INSERT INTO namespaces_teams(id, name, teamid, creatorid, created_at) SELECT n.id, n.name, t.id, n.creatorid, n.created_at FROM namespaces n LEFT JOIN teams t ON t.name = n.team;
+DROP TABLE namespaces;
+ALTER TABLE namespaces_teams RENAME TO namespaces;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_name ON namespaces(name);
@@ -0,0 +1 @@
+-- sqlite cannot drop columns, deactivated stays behind unused
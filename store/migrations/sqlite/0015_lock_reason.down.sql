@@ -0,0 +1 @@
+-- sqlite cannot drop columns, locked_by, locked_at and lock_reason stay behind unused
@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/tcotav/golinks/store"
+	"github.com/tcotav/golinks/store/storetest"
+
+	// database driver for sql package
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestMySQLConformance runs the conformance suite against the MySQL database named by
+// GOLINKS_TEST_MYSQL_URL, e.g. "root:root@tcp(db:3306)/routes".  Migrations are applied
+// and every table is emptied between tests.
+func TestMySQLConformance(t *testing.T) {
+	url := os.Getenv("GOLINKS_TEST_MYSQL_URL")
+	if url == "" {
+		t.Skip("GOLINKS_TEST_MYSQL_URL not set")
+	}
+	db, err := sql.Open("mysql", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := store.MigrateUp(db, "mysql"); err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(t *testing.T) store.RouteStore {
+		// children before the tables their foreign keys point at
+		for _, stmt := range []string{"DELETE FROM link_editors", "DELETE FROM api_tokens", "DELETE FROM route_history", "DELETE FROM team_members",
+			"DELETE FROM namespaces", "DELETE FROM routes", "DELETE FROM teams", "DELETE FROM users"} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO users(name, isadmin) VALUES(?, 1)", storetest.Admin); err != nil {
+			t.Fatal(err)
+		}
+		s, err := store.NewStore("mysql", db, nil, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
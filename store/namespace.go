@@ -0,0 +1,146 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Namespaces lists every namespace ordered by name.
+func (s *DataStore) Namespaces() ([]routes.Namespace, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getNamespaces"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	namespaces := make([]routes.Namespace, 0)
+	for rows.Next() {
+		var ns routes.Namespace
+		var creator sql.NullString
+		if err := rows.Scan(&ns.Name, &ns.Team, &creator, &ns.CreatedAt); err != nil {
+			return nil, err
+		}
+		ns.Creator = creator.String
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, rows.Err()
+}
+
+// AddNamespace hands the namespace ns to its team.  Only admins may create namespaces and
+// not over an existing key that would shadow it.
+func (s *DataStore) AddNamespace(ns routes.Namespace) (int, error) {
+	ns.Name = routes.NormalizeKey(ns.Name)
+	user, err := s.GetUser(ns.Creator)
+	if err != nil {
+		return -1, err
+	}
+	if user.IsAdmin != 1 {
+		return -1, fmt.Errorf("%w, user %s is not admin", ErrForbidden, user.Name)
+	}
+	for _, k := range routes.Prefixes(ns.Name) {
+		_, err := s.Lookup(k)
+		if err == nil {
+			return -1, fmt.Errorf("Key %s would shadow namespace %s", k, ns.Name)
+		}
+		if err != ErrNotFound {
+			return -1, err
+		}
+	}
+
+	teamID, err := s.teamID(s.db, ns.Team, user)
+	if err != nil {
+		return -1, err
+	}
+	res, err := s.db.Exec(GetSQL(s.dbtype, "insertNamespace"), ns.Name, teamID, user.ID, ns.CreatedAt)
+	if err != nil {
+		return -1, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	return int(affect), nil
+}
+
+// DeleteNamespace removes the empty namespace name on behalf of the admin username.
+func (s *DataStore) DeleteNamespace(name string, username string) error {
+	name = routes.NormalizeKey(name)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.IsAdmin != 1 {
+		return fmt.Errorf("%w, user %s is not admin", ErrForbidden, user.Name)
+	}
+
+	var keys int
+	prefix := name + "/"
+	if err := s.db.QueryRow(GetSQL(s.dbtype, "countNamespaceKeys"), len(prefix), prefix).Scan(&keys); err != nil {
+		return err
+	}
+	if keys > 0 {
+		return fmt.Errorf("Namespace %s still has %d keys", name, keys)
+	}
+
+	res, err := s.db.Exec(GetSQL(s.dbtype, "deleteNamespace"), name)
+	if err != nil {
+		return err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affect == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkNamespace makes sure the new route r neither shadows a namespace nor lands in one
+// that belongs to another team, unless user is an admin.  Namespaced keys need their
+// namespace to exist first.
+func (s *DataStore) checkNamespace(r routes.Route, user *User) error {
+	namespaces, err := s.Namespaces()
+	if err != nil {
+		return err
+	}
+	if err := routes.CheckShadowing(r.ShortKey, namespaces); err != nil {
+		return err
+	}
+	owner, ok := routes.Owner(r.ShortKey, namespaces)
+	if !ok {
+		if strings.Contains(r.ShortKey, "/") {
+			return fmt.Errorf("No namespace for key %s", r.ShortKey)
+		}
+		return nil
+	}
+	if r.Team != owner.Team && user.IsAdmin != 1 {
+		return fmt.Errorf("%w, namespace %s belongs to team %s", ErrForbidden, owner.Name, owner.Team)
+	}
+	return nil
+}
+
+// LookupPrefix resolves a request path to the longest key that prefixes it, returning the
+// route and the path segments left over after the key.
+func (s *DataStore) LookupPrefix(path string) (routes.Route, []string, error) {
+	for _, k := range routes.Prefixes(path) {
+		r, err := s.Lookup(k)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return routes.Route{}, nil, err
+		}
+		var args []string
+		for _, a := range strings.Split(path[len(k):], "/") {
+			if a != "" {
+				args = append(args, a)
+			}
+		}
+		return r, args, nil
+	}
+	return routes.Route{}, nil, ErrNotFound
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// KeyRename is a stored key that is not in canonical form.
+type KeyRename struct {
+	From string
+	To   string
+}
+
+// KeyCollision is a set of stored keys that all normalize to Key.  They are left alone for
+// someone to sort out by hand, as only one of them can keep the name.
+type KeyCollision struct {
+	Key  string
+	Keys []string
+}
+
+// NormalizeKeys finds every key in routes, route history and namespaces that is not in the
+// form routes.NormalizeKey gives it, and when apply is set rewrites the ones that can be
+// rewritten.  Keys that would collide after normalization are reported and never touched.
+// It is needed once for keys stored before normalization, and again whenever
+// routes.IgnoredPunctuation changes.
+func NormalizeKeys(db *sql.DB, dbtype string, apply bool) ([]KeyRename, []KeyCollision, error) {
+	rows, err := db.Query(GetSQL(dbtype, "getAllKeys"))
+	if err != nil {
+		return nil, nil, err
+	}
+	byKey := make(map[string][]string)
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		norm := routes.NormalizeKey(k)
+		byKey[norm] = append(byKey[norm], k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var renames []KeyRename
+	var collisions []KeyCollision
+	for norm, keys := range byKey {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			collisions = append(collisions, KeyCollision{Key: norm, Keys: keys})
+		} else if keys[0] != norm {
+			renames = append(renames, KeyRename{From: keys[0], To: norm})
+		}
+	}
+	sort.Slice(renames, func(i, j int) bool { return renames[i].From < renames[j].From })
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].Key < collisions[j].Key })
+	if !apply || len(renames) == 0 {
+		return renames, collisions, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	for _, r := range renames {
+		for _, query := range []string{"renameRouteKey", "renameHistoryKey", "renameNamespace"} {
+			if _, err := tx.Exec(GetSQL(dbtype, query), r.To, r.From); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return renames, collisions, tx.Commit()
+}
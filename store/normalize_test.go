@@ -0,0 +1,57 @@
+package store_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tcotav/golinks/store"
+)
+
+func TestNormalizeKeys(t *testing.T) {
+	db := newSQLiteDB(t)
+	// keys as they could have been stored before normalization
+	for _, k := range []string{"On-Call", "oncall", "Wiki", "jira"} {
+		_, err := db.Exec("INSERT INTO routes(short_key, url, creatorid, created_at, modified_at, last_modified_by) VALUES(?, 'https://example.com', 1, '2020-01-01 00:00:00', '2020-01-01 00:00:00', 1)", k)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO route_history(short_key, revision, action, url, locked, creatorid, changed_by, changed_at) VALUES('Wiki', 1, 'add', 'https://example.com', 0, 1, 1, '2020-01-01 00:00:00')"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRenames := []store.KeyRename{{From: "Wiki", To: "wiki"}}
+	expectedCollisions := []store.KeyCollision{{Key: "oncall", Keys: []string{"On-Call", "oncall"}}}
+	renames, collisions, err := store.NormalizeKeys(db, "sqlite", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(renames, expectedRenames) || !reflect.DeepEqual(collisions, expectedCollisions) {
+		t.Errorf("Unexpected report %+v %+v", renames, collisions)
+	}
+
+	s, err := store.NewStore("sqlite", db, nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("Wiki"); err == nil {
+		t.Error("Dry run renamed keys")
+	}
+
+	if _, _, err := store.NormalizeKeys(db, "sqlite", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("WIKI"); err != nil {
+		t.Errorf("Renamed key not found, %v", err)
+	}
+	if revisions, err := s.History("wiki"); err != nil || len(revisions) != 1 {
+		t.Errorf("History not renamed, %v %v", revisions, err)
+	}
+	renames, collisions, err = store.NormalizeKeys(db, "sqlite", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 0 || !reflect.DeepEqual(collisions, expectedCollisions) {
+		t.Errorf("Unexpected report after applying %+v %+v", renames, collisions)
+	}
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Access is what a user may do to a link.  Each level may do everything the ones below it
+// may.
+type Access int
+
+const (
+	// AccessNone may only follow the link.
+	AccessNone Access = iota
+	// AccessEditor may change the link's urls and settings, having been made an editor by
+	// an owner.
+	AccessEditor
+	// AccessOwner may also delete the link and choose its editors.  A link's owners are its
+	// creator and, unless the team says they are only editors, the members of its team.
+	AccessOwner
+	// AccessAdmin may do anything to any link.
+	AccessAdmin
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessEditor:
+		return "editor"
+	case AccessOwner:
+		return "owner"
+	case AccessAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// MarshalText has Access appear by name in JSON.
+func (a Access) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText reads an Access by name.
+func (a *Access) UnmarshalText(text []byte) error {
+	for _, level := range []Access{AccessNone, AccessEditor, AccessOwner, AccessAdmin} {
+		if string(text) == level.String() {
+			*a = level
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown access %s, expected none, editor, owner or admin", text)
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// routeAccess is who owns a route, live or in the trash, and what one user may do to it.
+type routeAccess struct {
+	id           int
+	creator      string
+	team         string
+	memberAccess Access
+	access       Access
+}
+
+// grant works out what user may do to the route, given what its team lets everyone do and
+// whether user is a member of the team or one of the route's editors.
+func (a *routeAccess) grant(user *User, defaultAccess Access, member bool, editor bool) {
+	a.access = defaultAccess
+	if editor && a.access < AccessEditor {
+		a.access = AccessEditor
+	}
+	if member && a.memberAccess > a.access {
+		a.access = a.memberAccess
+	}
+	if a.creator == user.Name {
+		a.access = AccessOwner
+	}
+	if user.IsAdmin == 1 {
+		a.access = AccessAdmin
+	}
+}
+
+// Access returns what username may do to the link k.
+func (s *DataStore) Access(k string, username string) (Access, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return AccessNone, err
+	}
+	a, err := s.access(s.db, routes.NormalizeKey(k), user)
+	return a.access, err
+}
+
+func (s *DataStore) access(q querier, k string, user *User) (routeAccess, error) {
+	var a routeAccess
+	var creator sql.NullString
+	var defaultAccess Access
+	var editor, member int
+	err := q.QueryRow(GetSQL(s.dbtype, "getRouteAccess"), user.ID, user.ID, k).Scan(&a.id, &creator, &a.team, &a.memberAccess, &defaultAccess, &editor, &member)
+	if err == sql.ErrNoRows {
+		return a, ErrNotFound
+	}
+	if err != nil {
+		return a, err
+	}
+	a.creator = creator.String
+	a.grant(user, defaultAccess, member > 0, editor > 0)
+	return a, nil
+}
+
+// authorize makes sure user has at least need on the route k to do action to it, saying
+// who could if they cannot.
+func (s *DataStore) authorize(q querier, k string, user *User, need Access, action string) (routeAccess, error) {
+	a, err := s.access(q, k, user)
+	if err != nil || a.access >= need {
+		return a, err
+	}
+	return a, forbidden(user, action, k, need, a)
+}
+
+// forbidden explains that user may not do action to k, which takes need, and who may.
+func forbidden(user *User, action string, k string, need Access, a routeAccess) error {
+	who := []string{"its creator " + a.creator}
+	if a.team != "" && a.memberAccess >= need {
+		who = append(who, "members of team "+a.team)
+	}
+	if need == AccessEditor {
+		who = append(who, "editors they have chosen")
+	}
+	who = append(who, "admins")
+	return fmt.Errorf("%w, %s may not %s %s, only %s and %s may", ErrForbidden, user.Name, action, k,
+		strings.Join(who[:len(who)-1], ", "), who[len(who)-1])
+}
+
+// Editors lists the users the owners of the link k have made its editors.
+func (s *DataStore) Editors(k string) ([]string, error) {
+	k = routes.NormalizeKey(k)
+	if _, err := s.Get(k); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getEditors"), k)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	editors := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		editors = append(editors, name)
+	}
+	return editors, rows.Err()
+}
+
+// AddEditor lets editor change the link k, on behalf of username, one of its owners.
+func (s *DataStore) AddEditor(k string, editor string, username string) error {
+	k = routes.NormalizeKey(k)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Get(k); err != nil {
+		return err
+	}
+	a, err := s.authorize(s.db, k, user, AccessOwner, "choose the editors of")
+	if err != nil {
+		return err
+	}
+	e, err := s.GetUser(editor)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(GetSQL(s.dbtype, "insertEditor"), a.id, e.ID, user.ID, time.Now().Format(routes.TimeFormat))
+	if err != nil && (s.IsSQLErrUniqueContraint(err) || s.IsSQLErrDuplicateContraint(err)) {
+		// already an editor
+		return nil
+	}
+	return err
+}
+
+// RemoveEditor stops editor changing the link k, on behalf of username, one of its owners.
+func (s *DataStore) RemoveEditor(k string, editor string, username string) error {
+	k = routes.NormalizeKey(k)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Get(k); err != nil {
+		return err
+	}
+	a, err := s.authorize(s.db, k, user, AccessOwner, "choose the editors of")
+	if err != nil {
+		return err
+	}
+	e, err := s.GetUser(editor)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(GetSQL(s.dbtype, "deleteEditor"), a.id, e.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("%w, %s is not an editor of %s", ErrNotFound, e.Name, k)
+	}
+	return nil
+}
+
+// Teams lists the teams username is a member of.
+func (s *DataStore) Teams(username string) ([]string, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getUserTeams"), username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := make([]string, 0)
+	for rows.Next() {
+		var team string
+		if err := rows.Scan(&team); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// SetTeams makes username a member of exactly teams, on the word of an identity provider
+// the server trusts to say so.  Like SetAdmin nobody is checked.  Teams that do not exist
+// yet are created, and names that could not be teams are skipped.  Managers stay managers
+// of the teams they are still in.
+func (s *DataStore) SetTeams(username string, teams []string) error {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+	want := make(map[int]bool)
+	for _, name := range teams {
+		name = strings.TrimSpace(name)
+		if routes.IsValidTeam(name) != nil {
+			continue
+		}
+		t, err := s.ensureTeam(name)
+		if err != nil {
+			return err
+		}
+		want[t.ID] = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(GetSQL(s.dbtype, "getUserTeamIDs"), user.ID)
+	if err != nil {
+		return err
+	}
+	var leave []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if want[id] {
+			delete(want, id)
+		} else {
+			leave = append(leave, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range leave {
+		if _, err := tx.Exec(GetSQL(s.dbtype, "deleteTeamMember"), id, user.ID); err != nil {
+			return err
+		}
+	}
+	now := time.Now().Format(routes.TimeFormat)
+	for id := range want {
+		if _, err := tx.Exec(GetSQL(s.dbtype, "insertTeamMember"), id, user.ID, 0, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/tcotav/golinks/store"
+	"github.com/tcotav/golinks/store/storetest"
+
+	// database driver for sql package
+	_ "github.com/lib/pq"
+)
+
+// TestPostgresConformance runs the conformance suite against the Postgres database named by
+// GOLINKS_TEST_POSTGRES_URL, e.g. "postgres://golinks:golinks@db/golinks?sslmode=disable".
+// Migrations are applied and every table is emptied between tests.
+func TestPostgresConformance(t *testing.T) {
+	url := os.Getenv("GOLINKS_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("GOLINKS_TEST_POSTGRES_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := store.MigrateUp(db, "postgres"); err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(t *testing.T) store.RouteStore {
+		// children before the tables their foreign keys point at
+		for _, stmt := range []string{"DELETE FROM link_editors", "DELETE FROM api_tokens", "DELETE FROM route_history", "DELETE FROM team_members",
+			"DELETE FROM namespaces", "DELETE FROM routes", "DELETE FROM teams", "DELETE FROM users"} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO users(name, isadmin) VALUES($1, 1)", storetest.Admin); err != nil {
+			t.Fatal(err)
+		}
+		s, err := store.NewStore("postgres", db, nil, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
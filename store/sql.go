@@ -8,32 +8,227 @@ func initSQLDict() {
 	SQLDict = make(map[string]map[string]string)
 
 	SQLDict["sqlite"] = map[string]string{
-		"insertRoute":    "INSERT INTO routes(short_key, url, creatorid, teamid, created_at, modified_at, last_modified_by) VALUES (?,?,?,?,?,?,?)",
-		"insertUser":     "INSERT INTO users(name, created_at, isadmin) VALUES(?,?,?)",
-		"getUser":        "SELECT id, name, isadmin FROM users where name = ?",
-		"getAllUsers":    "SELECT id, name, isadmin FROM users",
-		"makeUserAdmin":  "UPDATE users SET isadmin = 1 where name = ?",
-		"updateURLLock":  "UPDATE routes SET lock=1, last_modified_by=?, modified_at=? where short_key = ?",
-		"getRouteSQL":    "SELECT short_key, url, creatorid, team, created_at, modified_at, last_modified_by FROM routes where short_key = ?",
-		"getURLSQL":      "SELECT  url FROM routes where short_key = ?",
-		"getURLIsLocked": "SELECT locked FROM routes where short_key = ?",
-		"updateURLSQL":   "UPDATE routes SET url=?, last_modified_by=?, modified_at=? where short_key = ?",
-		"deleteRouteSQL": "DELETE FROM routes where short_key = ?",
+		"insertRoute":         "INSERT INTO routes(short_key, url, fallback_url, passthrough, targets, rotation, creatorid, teamid, created_at, modified_at, last_modified_by) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
+		"insertUser":          "INSERT INTO users(name, created_at, isadmin) VALUES(?,?,?)",
+		"getUser":             "SELECT id, name, isadmin, deactivated FROM users where name = ?",
+		"getAllUsers":         "SELECT id, name, isadmin, deactivated FROM users ORDER BY id",
+		"makeUserAdmin":       "UPDATE users SET isadmin = 1, modified_at=?, last_modified_by=? where id = ?",
+		"updateURLLock":       "UPDATE routes SET locked=1, locked_by=?, locked_at=?, lock_reason=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"getRouteSQL":         "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, ''), r.locked_at, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users l ON l.id = r.locked_by where r.short_key = ? AND r.deleted_at IS NULL",
+		"getAllRoutes":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL",
+		"getURLSQL":           "SELECT url, fallback_url, passthrough, targets, rotation FROM routes where short_key = ? AND deleted_at IS NULL",
+		"getURLIsLocked":      "SELECT r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, '') FROM routes r LEFT JOIN users l ON l.id = r.locked_by where r.short_key = ? AND r.deleted_at IS NULL",
+		"updateURLSQL":        "UPDATE routes SET url=?, fallback_url=?, passthrough=?, targets=?, rotation=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL AND (revision = ? OR ? = 0)",
+		"createSchemaVersion": "CREATE TABLE IF NOT EXISTS schema_version (version int PRIMARY KEY, name TEXT, applied_at datetime)",
+		"getSchemaVersions":   "SELECT version, applied_at FROM schema_version ORDER BY version",
+		"insertSchemaVersion": "INSERT INTO schema_version(version, name, applied_at) VALUES (?,?,?)",
+		"deleteSchemaVersion": "DELETE FROM schema_version where version = ?",
+		"insertHistory":       "INSERT INTO route_history(short_key, revision, action, url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, changed_by, changed_at) SELECT short_key, (SELECT COALESCE(MAX(revision), 0) + 1 FROM route_history WHERE short_key = ?), ?, url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, ?, ? FROM routes where short_key = ?",
+		"getHistory":          "SELECT h.revision, h.action, h.short_key, h.url, h.fallback_url, h.passthrough, h.targets, h.rotation, COALESCE(t.name, ''), h.locked, c.name, h.changed_at, m.name FROM route_history h LEFT JOIN users c ON c.id = h.creatorid LEFT JOIN users m ON m.id = h.changed_by LEFT JOIN teams t ON t.id = h.teamid where h.short_key = ? ORDER BY h.revision",
+		"getHistoryRevision":  "SELECT url, fallback_url, passthrough, targets, rotation, teamid, creatorid FROM route_history where short_key = ? AND revision = ?",
+		"restoreRouteSQL":     "UPDATE routes SET url=?, fallback_url=?, passthrough=?, targets=?, rotation=?, teamid=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"trashRouteSQL":       "UPDATE routes SET deleted_at=?, deleted_by=?, revision=revision+1 where short_key = ? AND deleted_at IS NULL",
+		"undeleteRouteSQL":    "UPDATE routes SET deleted_at=NULL, deleted_by=NULL, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NOT NULL",
+		"purgeTrashedKey":     "DELETE FROM routes where short_key = ? AND deleted_at IS NOT NULL",
+		"purgeTrash":          "DELETE FROM routes where deleted_at IS NOT NULL AND deleted_at < ?",
+		"getTrash":            "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, r.deleted_at, d.name FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users d ON d.id = r.deleted_by where r.deleted_at IS NOT NULL ORDER BY r.deleted_at",
+		"getRandomRoute":      "SELECT short_key, url, fallback_url, passthrough, targets, rotation FROM routes where deleted_at IS NULL AND (fallback_url <> '' OR (instr(url, '%s') = 0 AND instr(url, '{') = 0)) ORDER BY RANDOM() LIMIT 1",
+		"insertNamespace":     "INSERT INTO namespaces(name, teamid, creatorid, created_at) VALUES (?,?,?,?)",
+		"getNamespaces":       "SELECT n.name, COALESCE(t.name, ''), c.name, n.created_at FROM namespaces n LEFT JOIN teams t ON t.id = n.teamid LEFT JOIN users c ON c.id = n.creatorid ORDER BY n.name",
+		"deleteNamespace":     "DELETE FROM namespaces where name = ?",
+		"countNamespaceKeys":  "SELECT COUNT(*) FROM routes where deleted_at IS NULL AND substr(short_key, 1, ?) = ?",
+		"getAllKeys":          "SELECT short_key FROM routes UNION SELECT short_key FROM route_history UNION SELECT name FROM namespaces",
+		"getLiveKeys":         "SELECT short_key FROM routes WHERE deleted_at IS NULL",
+		"renameRouteKey":      "UPDATE routes SET short_key = ? where short_key = ?",
+		"renameHistoryKey":    "UPDATE route_history SET short_key = ? where short_key = ?",
+		"renameNamespace":     "UPDATE namespaces SET name = ? where name = ?",
+		"getURLRevision":      "SELECT revision FROM routes where short_key = ? AND deleted_at IS NULL",
+		"updateURLManaged":    "UPDATE routes SET managed=1, locked=1, locked_by=?, locked_at=?, lock_reason=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"setUserAdmin":        "UPDATE users SET isadmin = ?, modified_at=? where id = ?",
+		"insertAPIToken":      "INSERT INTO api_tokens(userid, name, token_hash, scopes, created_at, expires_at) VALUES(?,?,?,?,?,?)",
+		"getAPITokens":        "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.userid = ? ORDER BY t.id",
+		"getAPITokenByID":     "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.id = ?",
+		"getAPITokenByHash":   "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.token_hash = ? AND (t.expires_at IS NULL OR t.expires_at > ?)",
+		"touchAPIToken":       "UPDATE api_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		"deleteAPIToken":      "DELETE FROM api_tokens WHERE id = ?",
+		"getRouteAccess":      "SELECT r.id, c.name, COALESCE(t.name, ''), COALESCE(t.member_access, 0), COALESCE(t.default_access, 0), (SELECT COUNT(*) FROM link_editors e WHERE e.routeid = r.id AND e.userid = ?), (SELECT COUNT(*) FROM team_members m WHERE m.teamid = r.teamid AND m.userid = ?) FROM routes r LEFT JOIN users c ON c.id = r.creatorid LEFT JOIN teams t ON t.id = r.teamid WHERE r.short_key = ?",
+		"getEditors":          "SELECT u.name FROM link_editors e JOIN routes r ON r.id = e.routeid JOIN users u ON u.id = e.userid WHERE r.short_key = ? AND r.deleted_at IS NULL ORDER BY u.name",
+		"insertEditor":        "INSERT INTO link_editors(routeid, userid, granted_by, created_at) VALUES (?,?,?,?)",
+		"deleteEditor":        "DELETE FROM link_editors WHERE routeid = ? AND userid = ?",
+		"purgeOrphanEditors":  "DELETE FROM link_editors WHERE routeid NOT IN (SELECT id FROM routes)",
+		"getUserTeams":        "SELECT t.name FROM team_members m JOIN teams t ON t.id = m.teamid JOIN users u ON u.id = m.userid WHERE u.name = ? ORDER BY t.name",
+		"getUserName":         "SELECT name FROM users WHERE id = ?",
+		"insertTeam":          "INSERT INTO teams(name, member_access, default_access, creatorid, created_at) VALUES (?,?,?,?,?)",
+		"getTeams":            "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid ORDER BY t.name",
+		"getTeam":             "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.name = ?",
+		"getTeamByID":         "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.id = ?",
+		"updateTeam":          "UPDATE teams SET member_access = ?, default_access = ? WHERE id = ?",
+		"deleteTeam":          "DELETE FROM teams WHERE id = ?",
+		"countTeamOwned":      "SELECT (SELECT COUNT(*) FROM routes WHERE teamid = ?) + (SELECT COUNT(*) FROM namespaces WHERE teamid = ?)",
+		"getTeamMembers":      "SELECT u.name, m.manager FROM team_members m JOIN users u ON u.id = m.userid WHERE m.teamid = ? ORDER BY u.name",
+		"getTeamMember":       "SELECT manager FROM team_members WHERE teamid = ? AND userid = ?",
+		"getUserTeamIDs":      "SELECT teamid FROM team_members WHERE userid = ?",
+		"insertTeamMember":    "INSERT INTO team_members(teamid, userid, manager, created_at) VALUES (?,?,?,?)",
+		"updateTeamMember":    "UPDATE team_members SET manager = ? WHERE teamid = ? AND userid = ?",
+		"deleteTeamMember":    "DELETE FROM team_members WHERE teamid = ? AND userid = ?",
+		"deleteTeamMembers":   "DELETE FROM team_members WHERE teamid = ?",
+		"getTeamLinks":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND r.teamid IN (SELECT teamid FROM team_members WHERE userid = ?) ORDER BY r.short_key",
+		"setUserDeactivated":  "UPDATE users SET deactivated = ?, modified_at=?, last_modified_by=? where id = ?",
+		"getCreatorRoutes":    "SELECT short_key, creatorid, teamid FROM routes WHERE creatorid = ? AND deleted_at IS NULL ORDER BY short_key",
+		"transferRoute":       "UPDATE routes SET creatorid=?, teamid=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"getOrphanedRoutes":   "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND c.deactivated = 1 AND NOT EXISTS (SELECT 1 FROM team_members tm JOIN users u ON u.id = tm.userid WHERE tm.teamid = r.teamid AND t.member_access = 2 AND u.deactivated = 0) ORDER BY r.short_key",
+		"getUserByID":         "SELECT id, name, isadmin, deactivated FROM users where id = ?",
+		"updateURLUnlock":     "UPDATE routes SET locked=0, locked_by=NULL, locked_at=NULL, lock_reason=NULL, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
 	}
 
 	SQLDict["mysql"] = map[string]string{
-		"insertRoute":    "INSERT INTO routes(short_key, url, creatorid, team, created_at, modified_at, last_modified_by) VALUES (?,?,?,?,?,?,?)",
-		"insertUser":     "INSERT INTO users(name, created_at, isadmin) VALUES(?,?,?)",
-		"getUser":        "SELECT id, name, isadmin FROM users where name = ?",
-		"getAllUsers":    "SELECT id, name, isadmin FROM users",
-		"makeUserAdmin":  "UPDATE users SET isadmin = 1, modified_at=?, last_modified_by=? where id = ?",
-		"updateURLLock":  "UPDATE routes SET locked=1, last_modified_by=?, modified_at=? where short_key = ?",
-		"getRouteSQL":    "SELECT short_key, url, created_at, creatorid, team, modified_at, last_modified_by FROM routes where short_key = ?",
-		"getAllRoutes":   "SELECT short_key, url, creatorid, team, last_modified_by FROM routes",
-		"getURLSQL":      "SELECT  url FROM routes where short_key = ?",
-		"getURLIsLocked": "SELECT locked FROM routes where short_key = ?",
-		"updateURLSQL":   `UPDATE routes SET url=?, last_modified_by=?, modified_at=DATE_FORMAT(?, "%Y-%m-%d %H:%i:%s") where short_key = ?`,
-		"deleteRouteSQL": "DELETE FROM routes where short_key = ?",
+		"insertRoute":         "INSERT INTO routes(short_key, url, fallback_url, passthrough, targets, rotation, creatorid, teamid, created_at, modified_at, last_modified_by) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
+		"insertUser":          "INSERT INTO users(name, created_at, isadmin) VALUES(?,?,?)",
+		"getUser":             "SELECT id, name, isadmin, deactivated FROM users where name = ?",
+		"getAllUsers":         "SELECT id, name, isadmin, deactivated FROM users ORDER BY id",
+		"makeUserAdmin":       "UPDATE users SET isadmin = 1, modified_at=?, last_modified_by=? where id = ?",
+		"updateURLLock":       "UPDATE routes SET locked=1, locked_by=?, locked_at=?, lock_reason=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"getRouteSQL":         "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, ''), r.locked_at, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users l ON l.id = r.locked_by where r.short_key = ? AND r.deleted_at IS NULL",
+		"getAllRoutes":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL",
+		"getURLSQL":           "SELECT url, fallback_url, passthrough, targets, rotation FROM routes where short_key = ? AND deleted_at IS NULL",
+		"getURLIsLocked":      "SELECT r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, '') FROM routes r LEFT JOIN users l ON l.id = r.locked_by where r.short_key = ? AND r.deleted_at IS NULL",
+		"updateURLSQL":        `UPDATE routes SET url=?, fallback_url=?, passthrough=?, targets=?, rotation=?, revision=revision+1, last_modified_by=?, modified_at=DATE_FORMAT(?, "%Y-%m-%d %H:%i:%s") where short_key = ? AND deleted_at IS NULL AND (revision = ? OR ? = 0)`,
+		"createSchemaVersion": "CREATE TABLE IF NOT EXISTS schema_version (version int PRIMARY KEY, name VARCHAR(255), applied_at datetime)",
+		"getSchemaVersions":   "SELECT version, applied_at FROM schema_version ORDER BY version",
+		"insertSchemaVersion": "INSERT INTO schema_version(version, name, applied_at) VALUES (?,?,?)",
+		"deleteSchemaVersion": "DELETE FROM schema_version where version = ?",
+		"insertHistory":       "INSERT INTO route_history(short_key, revision, action, url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, changed_by, changed_at) SELECT short_key, (SELECT COALESCE(MAX(revision), 0) + 1 FROM route_history WHERE short_key = ?), ?, url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, ?, ? FROM routes where short_key = ?",
+		"getHistory":          "SELECT h.revision, h.action, h.short_key, h.url, h.fallback_url, h.passthrough, h.targets, h.rotation, COALESCE(t.name, ''), h.locked, c.name, h.changed_at, m.name FROM route_history h LEFT JOIN users c ON c.id = h.creatorid LEFT JOIN users m ON m.id = h.changed_by LEFT JOIN teams t ON t.id = h.teamid where h.short_key = ? ORDER BY h.revision",
+		"getHistoryRevision":  "SELECT url, fallback_url, passthrough, targets, rotation, teamid, creatorid FROM route_history where short_key = ? AND revision = ?",
+		"restoreRouteSQL":     "UPDATE routes SET url=?, fallback_url=?, passthrough=?, targets=?, rotation=?, teamid=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"trashRouteSQL":       "UPDATE routes SET deleted_at=?, deleted_by=?, revision=revision+1 where short_key = ? AND deleted_at IS NULL",
+		"undeleteRouteSQL":    "UPDATE routes SET deleted_at=NULL, deleted_by=NULL, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NOT NULL",
+		"purgeTrashedKey":     "DELETE FROM routes where short_key = ? AND deleted_at IS NOT NULL",
+		"purgeTrash":          "DELETE FROM routes where deleted_at IS NOT NULL AND deleted_at < ?",
+		"getTrash":            "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, r.deleted_at, d.name FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users d ON d.id = r.deleted_by where r.deleted_at IS NOT NULL ORDER BY r.deleted_at",
+		"getRandomRoute":      "SELECT short_key, url, fallback_url, passthrough, targets, rotation FROM routes where deleted_at IS NULL AND (fallback_url <> '' OR (POSITION('%s' IN url) = 0 AND POSITION('{' IN url) = 0)) ORDER BY RAND() LIMIT 1",
+		"insertNamespace":     "INSERT INTO namespaces(name, teamid, creatorid, created_at) VALUES (?,?,?,?)",
+		"getNamespaces":       "SELECT n.name, COALESCE(t.name, ''), c.name, n.created_at FROM namespaces n LEFT JOIN teams t ON t.id = n.teamid LEFT JOIN users c ON c.id = n.creatorid ORDER BY n.name",
+		"deleteNamespace":     "DELETE FROM namespaces where name = ?",
+		"countNamespaceKeys":  "SELECT COUNT(*) FROM routes where deleted_at IS NULL AND substr(short_key, 1, ?) = ?",
+		"getAllKeys":          "SELECT short_key FROM routes UNION SELECT short_key FROM route_history UNION SELECT name FROM namespaces",
+		"getLiveKeys":         "SELECT short_key FROM routes WHERE deleted_at IS NULL",
+		"renameRouteKey":      "UPDATE routes SET short_key = ? where short_key = ?",
+		"renameHistoryKey":    "UPDATE route_history SET short_key = ? where short_key = ?",
+		"renameNamespace":     "UPDATE namespaces SET name = ? where name = ?",
+		"getURLRevision":      "SELECT revision FROM routes where short_key = ? AND deleted_at IS NULL",
+		"updateURLManaged":    "UPDATE routes SET managed=1, locked=1, locked_by=?, locked_at=?, lock_reason=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"setUserAdmin":        "UPDATE users SET isadmin = ?, modified_at=? where id = ?",
+		"insertAPIToken":      "INSERT INTO api_tokens(userid, name, token_hash, scopes, created_at, expires_at) VALUES(?,?,?,?,?,?)",
+		"getAPITokens":        "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.userid = ? ORDER BY t.id",
+		"getAPITokenByID":     "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.id = ?",
+		"getAPITokenByHash":   "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.token_hash = ? AND (t.expires_at IS NULL OR t.expires_at > ?)",
+		"touchAPIToken":       "UPDATE api_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		"deleteAPIToken":      "DELETE FROM api_tokens WHERE id = ?",
+		"getRouteAccess":      "SELECT r.id, c.name, COALESCE(t.name, ''), COALESCE(t.member_access, 0), COALESCE(t.default_access, 0), (SELECT COUNT(*) FROM link_editors e WHERE e.routeid = r.id AND e.userid = ?), (SELECT COUNT(*) FROM team_members m WHERE m.teamid = r.teamid AND m.userid = ?) FROM routes r LEFT JOIN users c ON c.id = r.creatorid LEFT JOIN teams t ON t.id = r.teamid WHERE r.short_key = ?",
+		"getEditors":          "SELECT u.name FROM link_editors e JOIN routes r ON r.id = e.routeid JOIN users u ON u.id = e.userid WHERE r.short_key = ? AND r.deleted_at IS NULL ORDER BY u.name",
+		"insertEditor":        "INSERT INTO link_editors(routeid, userid, granted_by, created_at) VALUES (?,?,?,?)",
+		"deleteEditor":        "DELETE FROM link_editors WHERE routeid = ? AND userid = ?",
+		"purgeOrphanEditors":  "DELETE FROM link_editors WHERE routeid NOT IN (SELECT id FROM routes)",
+		"getUserTeams":        "SELECT t.name FROM team_members m JOIN teams t ON t.id = m.teamid JOIN users u ON u.id = m.userid WHERE u.name = ? ORDER BY t.name",
+		"getUserName":         "SELECT name FROM users WHERE id = ?",
+		"insertTeam":          "INSERT INTO teams(name, member_access, default_access, creatorid, created_at) VALUES (?,?,?,?,?)",
+		"getTeams":            "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid ORDER BY t.name",
+		"getTeam":             "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.name = ?",
+		"getTeamByID":         "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.id = ?",
+		"updateTeam":          "UPDATE teams SET member_access = ?, default_access = ? WHERE id = ?",
+		"deleteTeam":          "DELETE FROM teams WHERE id = ?",
+		"countTeamOwned":      "SELECT (SELECT COUNT(*) FROM routes WHERE teamid = ?) + (SELECT COUNT(*) FROM namespaces WHERE teamid = ?)",
+		"getTeamMembers":      "SELECT u.name, m.manager FROM team_members m JOIN users u ON u.id = m.userid WHERE m.teamid = ? ORDER BY u.name",
+		"getTeamMember":       "SELECT manager FROM team_members WHERE teamid = ? AND userid = ?",
+		"getUserTeamIDs":      "SELECT teamid FROM team_members WHERE userid = ?",
+		"insertTeamMember":    "INSERT INTO team_members(teamid, userid, manager, created_at) VALUES (?,?,?,?)",
+		"updateTeamMember":    "UPDATE team_members SET manager = ? WHERE teamid = ? AND userid = ?",
+		"deleteTeamMember":    "DELETE FROM team_members WHERE teamid = ? AND userid = ?",
+		"deleteTeamMembers":   "DELETE FROM team_members WHERE teamid = ?",
+		"getTeamLinks":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND r.teamid IN (SELECT teamid FROM team_members WHERE userid = ?) ORDER BY r.short_key",
+		"setUserDeactivated":  "UPDATE users SET deactivated = ?, modified_at=?, last_modified_by=? where id = ?",
+		"getCreatorRoutes":    "SELECT short_key, creatorid, teamid FROM routes WHERE creatorid = ? AND deleted_at IS NULL ORDER BY short_key",
+		"transferRoute":       "UPDATE routes SET creatorid=?, teamid=?, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+		"getOrphanedRoutes":   "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND c.deactivated = 1 AND NOT EXISTS (SELECT 1 FROM team_members tm JOIN users u ON u.id = tm.userid WHERE tm.teamid = r.teamid AND t.member_access = 2 AND u.deactivated = 0) ORDER BY r.short_key",
+		"getUserByID":         "SELECT id, name, isadmin, deactivated FROM users where id = ?",
+		"updateURLUnlock":     "UPDATE routes SET locked=0, locked_by=NULL, locked_at=NULL, lock_reason=NULL, revision=revision+1, last_modified_by=?, modified_at=? where short_key = ? AND deleted_at IS NULL",
+	}
+
+	// postgres uses numbered placeholders and hands back new ids with RETURNING
+	// as lib/pq does not support LastInsertId
+	SQLDict["postgres"] = map[string]string{
+		"insertRoute":         "INSERT INTO routes(short_key, url, fallback_url, passthrough, targets, rotation, creatorid, teamid, created_at, modified_at, last_modified_by) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)",
+		"insertUser":          "INSERT INTO users(name, created_at, isadmin) VALUES($1,$2,$3) RETURNING id",
+		"getUser":             "SELECT id, name, isadmin, deactivated FROM users where name = $1",
+		"getAllUsers":         "SELECT id, name, isadmin, deactivated FROM users ORDER BY id",
+		"makeUserAdmin":       "UPDATE users SET isadmin = 1, modified_at=$1, last_modified_by=$2 where id = $3",
+		"updateURLLock":       "UPDATE routes SET locked=1, locked_by=$1, locked_at=$2, lock_reason=$3, revision=revision+1, last_modified_by=$4, modified_at=$5 where short_key = $6 AND deleted_at IS NULL",
+		"getRouteSQL":         "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, ''), r.locked_at, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users l ON l.id = r.locked_by where r.short_key = $1 AND r.deleted_at IS NULL",
+		"getAllRoutes":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL",
+		"getURLSQL":           "SELECT url, fallback_url, passthrough, targets, rotation FROM routes where short_key = $1 AND deleted_at IS NULL",
+		"getURLIsLocked":      "SELECT r.locked, COALESCE(l.name, ''), COALESCE(r.lock_reason, '') FROM routes r LEFT JOIN users l ON l.id = r.locked_by where r.short_key = $1 AND r.deleted_at IS NULL",
+		"updateURLSQL":        "UPDATE routes SET url=$1, fallback_url=$2, passthrough=$3, targets=$4, rotation=$5, revision=revision+1, last_modified_by=$6, modified_at=$7 where short_key = $8 AND deleted_at IS NULL AND (revision = $9 OR $10 = 0)",
+		"createSchemaVersion": "CREATE TABLE IF NOT EXISTS schema_version (version int PRIMARY KEY, name VARCHAR(255), applied_at timestamp)",
+		"getSchemaVersions":   "SELECT version, applied_at FROM schema_version ORDER BY version",
+		"insertSchemaVersion": "INSERT INTO schema_version(version, name, applied_at) VALUES ($1,$2,$3)",
+		"deleteSchemaVersion": "DELETE FROM schema_version where version = $1",
+		"insertHistory":       "INSERT INTO route_history(short_key, revision, action, url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, changed_by, changed_at) SELECT short_key, (SELECT COALESCE(MAX(revision), 0) + 1 FROM route_history WHERE short_key = $1), CAST($2 AS VARCHAR), url, fallback_url, passthrough, targets, rotation, teamid, locked, creatorid, CAST($3 AS INTEGER), CAST($4 AS TIMESTAMP) FROM routes where short_key = $5",
+		"getHistory":          "SELECT h.revision, h.action, h.short_key, h.url, h.fallback_url, h.passthrough, h.targets, h.rotation, COALESCE(t.name, ''), h.locked, c.name, h.changed_at, m.name FROM route_history h LEFT JOIN users c ON c.id = h.creatorid LEFT JOIN users m ON m.id = h.changed_by LEFT JOIN teams t ON t.id = h.teamid where h.short_key = $1 ORDER BY h.revision",
+		"getHistoryRevision":  "SELECT url, fallback_url, passthrough, targets, rotation, teamid, creatorid FROM route_history where short_key = $1 AND revision = $2",
+		"restoreRouteSQL":     "UPDATE routes SET url=$1, fallback_url=$2, passthrough=$3, targets=$4, rotation=$5, teamid=$6, revision=revision+1, last_modified_by=$7, modified_at=$8 where short_key = $9 AND deleted_at IS NULL",
+		"trashRouteSQL":       "UPDATE routes SET deleted_at=$1, deleted_by=$2, revision=revision+1 where short_key = $3 AND deleted_at IS NULL",
+		"undeleteRouteSQL":    "UPDATE routes SET deleted_at=NULL, deleted_by=NULL, revision=revision+1, last_modified_by=$1, modified_at=$2 where short_key = $3 AND deleted_at IS NOT NULL",
+		"purgeTrashedKey":     "DELETE FROM routes where short_key = $1 AND deleted_at IS NOT NULL",
+		"purgeTrash":          "DELETE FROM routes where deleted_at IS NOT NULL AND deleted_at < $1",
+		"getTrash":            "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, r.created_at, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), r.modified_at, m.name, r.locked, r.deleted_at, d.name FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid LEFT JOIN users d ON d.id = r.deleted_by where r.deleted_at IS NOT NULL ORDER BY r.deleted_at",
+		"getRandomRoute":      "SELECT short_key, url, fallback_url, passthrough, targets, rotation FROM routes where deleted_at IS NULL AND (fallback_url <> '' OR (POSITION('%s' IN url) = 0 AND POSITION('{' IN url) = 0)) ORDER BY RANDOM() LIMIT 1",
+		"insertNamespace":     "INSERT INTO namespaces(name, teamid, creatorid, created_at) VALUES ($1,$2,$3,$4)",
+		"getNamespaces":       "SELECT n.name, COALESCE(t.name, ''), c.name, n.created_at FROM namespaces n LEFT JOIN teams t ON t.id = n.teamid LEFT JOIN users c ON c.id = n.creatorid ORDER BY n.name",
+		"deleteNamespace":     "DELETE FROM namespaces where name = $1",
+		"countNamespaceKeys":  "SELECT COUNT(*) FROM routes where deleted_at IS NULL AND substr(short_key, 1, CAST($1 AS INTEGER)) = $2",
+		"getAllKeys":          "SELECT short_key FROM routes UNION SELECT short_key FROM route_history UNION SELECT name FROM namespaces",
+		"getLiveKeys":         "SELECT short_key FROM routes WHERE deleted_at IS NULL",
+		"renameRouteKey":      "UPDATE routes SET short_key = $1 where short_key = $2",
+		"renameHistoryKey":    "UPDATE route_history SET short_key = $1 where short_key = $2",
+		"renameNamespace":     "UPDATE namespaces SET name = $1 where name = $2",
+		"getURLRevision":      "SELECT revision FROM routes where short_key = $1 AND deleted_at IS NULL",
+		"updateURLManaged":    "UPDATE routes SET managed=1, locked=1, locked_by=$1, locked_at=$2, lock_reason=$3, revision=revision+1, last_modified_by=$4, modified_at=$5 where short_key = $6 AND deleted_at IS NULL",
+		"setUserAdmin":        "UPDATE users SET isadmin = $1, modified_at=$2 where id = $3",
+		"insertAPIToken":      "INSERT INTO api_tokens(userid, name, token_hash, scopes, created_at, expires_at) VALUES($1,$2,$3,$4,$5,$6) RETURNING id",
+		"getAPITokens":        "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.userid = $1 ORDER BY t.id",
+		"getAPITokenByID":     "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.id = $1",
+		"getAPITokenByHash":   "SELECT t.id, t.name, u.name, t.scopes, t.created_at, t.expires_at, t.last_used_at FROM api_tokens t JOIN users u ON u.id = t.userid WHERE t.token_hash = $1 AND (t.expires_at IS NULL OR t.expires_at > $2)",
+		"touchAPIToken":       "UPDATE api_tokens SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)",
+		"deleteAPIToken":      "DELETE FROM api_tokens WHERE id = $1",
+		"getRouteAccess":      "SELECT r.id, c.name, COALESCE(t.name, ''), COALESCE(t.member_access, 0), COALESCE(t.default_access, 0), (SELECT COUNT(*) FROM link_editors e WHERE e.routeid = r.id AND e.userid = $1), (SELECT COUNT(*) FROM team_members m WHERE m.teamid = r.teamid AND m.userid = $2) FROM routes r LEFT JOIN users c ON c.id = r.creatorid LEFT JOIN teams t ON t.id = r.teamid WHERE r.short_key = $3",
+		"getEditors":          "SELECT u.name FROM link_editors e JOIN routes r ON r.id = e.routeid JOIN users u ON u.id = e.userid WHERE r.short_key = $1 AND r.deleted_at IS NULL ORDER BY u.name",
+		"insertEditor":        "INSERT INTO link_editors(routeid, userid, granted_by, created_at) VALUES ($1,$2,$3,$4)",
+		"deleteEditor":        "DELETE FROM link_editors WHERE routeid = $1 AND userid = $2",
+		"purgeOrphanEditors":  "DELETE FROM link_editors WHERE routeid NOT IN (SELECT id FROM routes)",
+		"getUserTeams":        "SELECT t.name FROM team_members m JOIN teams t ON t.id = m.teamid JOIN users u ON u.id = m.userid WHERE u.name = $1 ORDER BY t.name",
+		"getUserName":         "SELECT name FROM users WHERE id = $1",
+		"insertTeam":          "INSERT INTO teams(name, member_access, default_access, creatorid, created_at) VALUES ($1,$2,$3,$4,$5) RETURNING id",
+		"getTeams":            "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid ORDER BY t.name",
+		"getTeam":             "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.name = $1",
+		"getTeamByID":         "SELECT t.id, t.name, t.member_access, t.default_access, COALESCE(c.name, ''), t.created_at FROM teams t LEFT JOIN users c ON c.id = t.creatorid WHERE t.id = $1",
+		"updateTeam":          "UPDATE teams SET member_access = $1, default_access = $2 WHERE id = $3",
+		"deleteTeam":          "DELETE FROM teams WHERE id = $1",
+		"countTeamOwned":      "SELECT (SELECT COUNT(*) FROM routes WHERE teamid = $1) + (SELECT COUNT(*) FROM namespaces WHERE teamid = $2)",
+		"getTeamMembers":      "SELECT u.name, m.manager FROM team_members m JOIN users u ON u.id = m.userid WHERE m.teamid = $1 ORDER BY u.name",
+		"getTeamMember":       "SELECT manager FROM team_members WHERE teamid = $1 AND userid = $2",
+		"getUserTeamIDs":      "SELECT teamid FROM team_members WHERE userid = $1",
+		"insertTeamMember":    "INSERT INTO team_members(teamid, userid, manager, created_at) VALUES ($1,$2,$3,$4)",
+		"updateTeamMember":    "UPDATE team_members SET manager = $1 WHERE teamid = $2 AND userid = $3",
+		"deleteTeamMember":    "DELETE FROM team_members WHERE teamid = $1 AND userid = $2",
+		"deleteTeamMembers":   "DELETE FROM team_members WHERE teamid = $1",
+		"getTeamLinks":        "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND r.teamid IN (SELECT teamid FROM team_members WHERE userid = $1) ORDER BY r.short_key",
+		"setUserDeactivated":  "UPDATE users SET deactivated = $1, modified_at=$2, last_modified_by=$3 where id = $4",
+		"getCreatorRoutes":    "SELECT short_key, creatorid, teamid FROM routes WHERE creatorid = $1 AND deleted_at IS NULL ORDER BY short_key",
+		"transferRoute":       "UPDATE routes SET creatorid=$1, teamid=$2, revision=revision+1, last_modified_by=$3, modified_at=$4 where short_key = $5 AND deleted_at IS NULL",
+		"getOrphanedRoutes":   "SELECT r.short_key, r.url, r.fallback_url, r.passthrough, r.targets, r.rotation, c.name, COALESCE(t.name, ''), COALESCE(r.teamid, 0), m.name, r.locked, r.revision, r.managed FROM routes r JOIN users c ON c.id = r.creatorid JOIN users m ON m.id = r.last_modified_by LEFT JOIN teams t ON t.id = r.teamid where r.deleted_at IS NULL AND c.deactivated = 1 AND NOT EXISTS (SELECT 1 FROM team_members tm JOIN users u ON u.id = tm.userid WHERE tm.teamid = r.teamid AND t.member_access = 2 AND u.deactivated = 0) ORDER BY r.short_key",
+		"getUserByID":         "SELECT id, name, isadmin, deactivated FROM users where id = $1",
+		"updateURLUnlock":     "UPDATE routes SET locked=0, locked_by=NULL, locked_at=NULL, lock_reason=NULL, revision=revision+1, last_modified_by=$1, modified_at=$2 where short_key = $3 AND deleted_at IS NULL",
 	}
 }
 
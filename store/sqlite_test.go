@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/tcotav/golinks/store"
+	"github.com/tcotav/golinks/store/storetest"
+
+	// database driver for sql package
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLiteDB creates a fresh SQLite database file with every migration applied and the
+// storetest admin seeded.
+func newSQLiteDB(t *testing.T) *sql.DB {
+	db := openSQLiteDB(t)
+	if _, err := store.MigrateUp(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO users(name, isadmin) VALUES(?, 1)", storetest.Admin); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openSQLiteDB opens an empty SQLite database file that is removed when the test ends.
+func openSQLiteDB(t *testing.T) *sql.DB {
+	dir, err := ioutil.TempDir("", "golinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "testdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.RouteStore {
+		s, err := store.NewStore("sqlite", newSQLiteDB(t), nil, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteRedisConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.RouteStore {
+		redisServer, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(redisServer.Close)
+
+		redisClient := redis.NewClient(&redis.Options{
+			Addr: redisServer.Addr(),
+		})
+		s, err := store.NewStore("sqlite", newSQLiteDB(t), redisClient, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
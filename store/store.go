@@ -1,18 +1,86 @@
 package store
 
 import (
+	"errors"
+	"time"
+
 	"github.com/tcotav/golinks/routes"
 )
 
+// ErrNotFound is returned when a short key or user does not exist in the store.
+var ErrNotFound = errors.New("No match found")
+
+// ErrLocked is returned when someone other than an admin tries to change a locked route.
+var ErrLocked = errors.New("Link is locked")
+
+// ErrForbidden is returned when a user is not allowed to make a change at all.
+var ErrForbidden = errors.New("Not allowed")
+
+// ErrConflict is returned when a change is made against a revision of a route that is no
+// longer the current one, i.e. someone else changed it first.
+var ErrConflict = errors.New("Link was changed since that revision")
+
+// RouteStore is the contract between the server and a datastore backend.  Every backend
+// must pass the conformance suite in store/storetest.  Keys are accepted in any form and
+// stored and compared as routes.NormalizeKey has them.
 type RouteStore interface {
 	Add(routes.Route) (int, error)
+	AddAll([]routes.Route) (int, error)
 	Modify(routes.Route) (int, error)
-	Get(string) routes.Route
-	Delete(string) bool
-	GetUserID(username string) (int, error)
+	Get(string) (routes.Route, error)
+	Delete(k string, username string) error
+	GetUser(username string) (*User, error)
+	FindUser(username string) (*User, error)
+	UserByID(id int) (*User, error)
+	AllUsers() ([]User, error)
 	GetURL(string) (string, error)
-	Lock(routes.Route) (bool, error)
+	Lookup(string) (routes.Route, error)
+	LookupPrefix(path string) (routes.Route, []string, error)
+	Random() (routes.Route, error)
+	Keys() ([]string, error)
+	Lock(routes.Route) (int, error)
+	Unlock(routes.Route) (int, error)
+	Manage(routes.Route) (int, error)
+	MakeAdmin(username string, admin string) (int, error)
+	SetAdmin(username string, admin bool) (*User, error)
+	SetDeactivated(username string, deactivated bool, admin string) (*User, error)
+	TransferLinks(from string, toUser string, toTeam string, admin string) ([]string, error)
+	OrphanedLinks(admin string) ([]routes.Route, error)
+	DumpAllRoutes() ([]routes.Route, error)
+	IsSQLErrUniqueContraint(error) bool
+	IsSQLErrDuplicateContraint(error) bool
+	History(k string) ([]Revision, error)
+	Restore(k string, revision int, username string) (int, error)
+	Trash() ([]routes.Route, error)
+	Undelete(k string, username string) (int, error)
+	PurgeTrash(before time.Time) (int, error)
+	Namespaces() ([]routes.Namespace, error)
+	AddNamespace(routes.Namespace) (int, error)
+	DeleteNamespace(name string, username string) error
+	CreateToken(username string, name string, scopes []string, expires time.Time) (APIToken, error)
+	Tokens(username string) ([]APIToken, error)
+	RevokeToken(id int, username string) error
+	CheckToken(token string) (APIToken, error)
+	Access(k string, username string) (Access, error)
+	Editors(k string) ([]string, error)
+	AddEditor(k string, editor string, username string) error
+	RemoveEditor(k string, editor string, username string) error
+	Teams(username string) ([]string, error)
+	SetTeams(username string, teams []string) error
+	CreateTeam(t Team, username string) (Team, error)
+	Team(name string) (Team, error)
+	TeamByID(id int) (Team, error)
+	AllTeams() ([]Team, error)
+	UpdateTeam(t Team, username string) (Team, error)
+	DeleteTeam(name string, username string) error
+	AddTeamMember(team string, member string, manager bool, username string) error
+	RemoveTeamMember(team string, member string, username string) error
+	SetTeamMembers(t Team, users []string, admins func(team string) bool, username string) (Team, error)
+	TeamLinks(username string) ([]routes.Route, error)
 	//GetAllForUser(string) []routes.Route
 	//GetRecentlyAdded() []routes.Route
 	//GetRecentlyModified() []routes.Route
 }
+
+// DataStore is the SQL backed RouteStore.
+var _ RouteStore = (*DataStore)(nil)
@@ -0,0 +1,1595 @@
+// Package storetest is the conformance suite for store.RouteStore.  Every datastore backend
+// runs it from its own tests so that SQLite, MySQL and anything added later behave the same
+// way behind the server.
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+// Admin is a user that every store handed out by a Factory must already have marked as an
+// admin.  RouteStore has no way to bootstrap the first admin, so backends seed it themselves.
+const Admin = "admin@example.com"
+
+// Factory returns an empty store, apart from the Admin user, for a single test.
+type Factory func(t *testing.T) store.RouteStore
+
+// Run executes the full conformance suite against the backend built by newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, store.RouteStore)
+	}{
+		{"GetUser", testGetUser},
+		{"AddGet", testAddGet},
+		{"AddDuplicate", testAddDuplicate},
+		{"Missing", testMissing},
+		{"Modify", testModify},
+		{"Delete", testDelete},
+		{"Lock", testLock},
+		{"Manage", testManage},
+		{"MakeAdmin", testMakeAdmin},
+		{"DumpAllRoutes", testDumpAllRoutes},
+		{"CacheInvalidation", testCacheInvalidation},
+		{"History", testHistory},
+		{"Restore", testRestore},
+		{"Trash", testTrash},
+		{"Template", testTemplate},
+		{"Passthrough", testPassthrough},
+		{"Targets", testTargets},
+		{"Random", testRandom},
+		{"Namespaces", testNamespaces},
+		{"LookupPrefix", testLookupPrefix},
+		{"Normalization", testNormalization},
+		{"Revisions", testRevisions},
+		{"Tokens", testTokens},
+		{"Permissions", testPermissions},
+		{"Teams", testTeams},
+		{"TeamMembers", testTeamMembers},
+		{"Deactivation", testDeactivation},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// mustAdd creates the route k -> url owned by creator and team@example.com, which the first
+// creator to use it makes and later ones join, and fails the test on error.
+func mustAdd(t *testing.T, s store.RouteStore, k string, url string, creator string) routes.Route {
+	t.Helper()
+	mustTeam(t, s, "team@example.com", creator)
+	r, err := routes.NewRoute(k, url, creator, "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := s.Add(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 1 {
+		t.Fatalf("Add of %s affected %d rows, expected 1", k, i)
+	}
+	return r
+}
+
+// mustTeam makes creator a member of the team name, creating it with them as its manager
+// unless it exists already, and fails the test on error.
+func mustTeam(t *testing.T, s store.RouteStore, name string, creator string) {
+	t.Helper()
+	team, err := s.Team(name)
+	if errors.Is(err, store.ErrNotFound) {
+		if _, err := s.CreateTeam(store.Team{Name: name}, creator); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range team.Members {
+		if m.User == creator {
+			return
+		}
+	}
+	if err := s.AddTeamMember(name, creator, false, Admin); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGetUser(t *testing.T, s store.RouteStore) {
+	u, err := s.GetUser("t@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "t@example.com" || u.IsAdmin != 0 {
+		t.Errorf("Unexpected new user %+v", u)
+	}
+
+	// same username again, should get same id
+	u2, err := s.GetUser("t@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != u2.ID {
+		t.Errorf("User IDs don't match for GetUser, %d != %d", u.ID, u2.ID)
+	}
+
+	admin, err := s.GetUser(Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.IsAdmin != 1 {
+		t.Errorf("Expected seeded user %s to be admin", Admin)
+	}
+
+	// looking users up does not create them
+	if _, err := s.FindUser("nobody@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("FindUser of a missing user: expected ErrNotFound, got %v", err)
+	}
+	if found, err := s.FindUser("t@example.com"); err != nil || found.ID != u.ID {
+		t.Errorf("Unexpected user found %+v (err %v)", found, err)
+	}
+	if byID, err := s.UserByID(u.ID); err != nil || byID.Name != "t@example.com" {
+		t.Errorf("Unexpected user by id %+v (err %v)", byID, err)
+	}
+	if _, err := s.UserByID(-1); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UserByID of a missing user: expected ErrNotFound, got %v", err)
+	}
+	users, err := s.AllUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	if !reflect.DeepEqual(names, []string{Admin, "t@example.com"}) {
+		t.Errorf("Unexpected users %v", names)
+	}
+}
+
+func testAddGet(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "a", "http://www.google.com", "t@example.com")
+
+	r, err := s.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ShortKey != "a" || r.URL != "http://www.google.com" {
+		t.Errorf("Unexpected route %+v", r)
+	}
+	if r.Creator != "t@example.com" || r.LastModifiedBy != "t@example.com" {
+		t.Errorf("Expected creator and modifier t@example.com, got %s and %s", r.Creator, r.LastModifiedBy)
+	}
+	if r.Team != "team@example.com" {
+		t.Errorf("Expected team team@example.com, got %s", r.Team)
+	}
+	if r.Locked != 0 {
+		t.Error("New route should not be locked")
+	}
+
+	v, err := s.GetURL("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "http://www.google.com" {
+		t.Error("Expected: http://www.google.com, got: ", v)
+	}
+}
+
+func testAddDuplicate(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "d", "http://www.google.com", "t@example.com")
+
+	_, err := s.Add(r)
+	if err == nil {
+		t.Fatal("Expected error adding duplicate key")
+	}
+	if !s.IsSQLErrUniqueContraint(err) {
+		t.Errorf("Expected unique constraint error, got %v", err)
+	}
+	if !s.IsSQLErrDuplicateContraint(err) {
+		t.Errorf("Expected duplicate constraint error, got %v", err)
+	}
+	if s.IsSQLErrUniqueContraint(errors.New("some other error")) {
+		t.Error("Unrelated error reported as unique constraint")
+	}
+}
+
+func testMissing(t *testing.T, s store.RouteStore) {
+	if _, err := s.Get("nope"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of missing key: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetURL("nope"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetURL of missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testModify(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "m", "http://www.google.com", "t@example.com")
+	mustAddEditor(t, s, "m", "other@example.com", "t@example.com")
+
+	r.URL = "http://www.new.com"
+	r.LastModifiedBy = "other@example.com"
+	i, err := s.Modify(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 1 {
+		t.Errorf("Unexpected rows modified -- expected 1 and got %d", i)
+	}
+
+	got, err := s.Get("m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "http://www.new.com" {
+		t.Errorf("Expected modified url, got %s", got.URL)
+	}
+	if got.Creator != "t@example.com" || got.LastModifiedBy != "other@example.com" {
+		t.Errorf("Unexpected creator/modifier %s/%s", got.Creator, got.LastModifiedBy)
+	}
+
+	r.ShortKey = "nope"
+	if _, err := s.Modify(r); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Modify of missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testDelete(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "q", "http://www.google.com", "t@example.com")
+
+	if err := s.Delete("q", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("q"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get after delete: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete("q", "t@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Second delete: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testLock(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "l", "http://www.google.com", "t@example.com")
+
+	// only admins lock
+	if _, err := s.Lock(r); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden locking as non-admin, got %v", err)
+	}
+
+	r.LastModifiedBy = Admin
+	r.LockReason = "under incident review"
+	affected, err := s.Lock(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 1 {
+		t.Errorf("Expected rowcount to be one, was %d", affected)
+	}
+	got, err := s.Get("l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Locked != 1 || got.LockedBy != Admin || got.LockReason != "under incident review" || got.LockedAt == "" {
+		t.Errorf("Expected route to be locked by %s with its reason, got %+v", Admin, got)
+	}
+
+	// try modifying without being admin, this should fail and say who locked it and why
+	r.URL = "http://www.new.com"
+	r.LastModifiedBy = "t@example.com"
+	_, err = s.Modify(r)
+	if !errors.Is(err, store.ErrLocked) {
+		t.Errorf("Expected ErrLocked on modifying locked route if not admin, got %v", err)
+	} else if msg := err.Error(); !strings.Contains(msg, Admin) || !strings.Contains(msg, "under incident review") {
+		t.Errorf("Expected the locker and reason in %q", msg)
+	}
+	if err := s.Delete("l", "t@example.com"); !errors.Is(err, store.ErrLocked) {
+		t.Errorf("Expected ErrLocked on deleting locked route if not admin, got %v", err)
+	}
+
+	// try again now that we're an admin
+	r.LastModifiedBy = Admin
+	if _, err := s.Modify(r); err != nil {
+		t.Error(err)
+	}
+
+	// only admins unlock, after which the owners may change it again
+	r.LastModifiedBy = "t@example.com"
+	if _, err := s.Unlock(r); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden unlocking as non-admin, got %v", err)
+	}
+	r.LastModifiedBy = Admin
+	if _, err := s.Unlock(r); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Get("l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Locked != 0 || got.LockedBy != "" || got.LockReason != "" || got.LockedAt != "" {
+		t.Errorf("Expected route to be unlocked, got %+v", got)
+	}
+	r.URL = "http://www.newer.com"
+	r.LastModifiedBy = "t@example.com"
+	r.Revision = got.Revision
+	if _, err := s.Modify(r); err != nil {
+		t.Errorf("Modify by the owner once unlocked: %v", err)
+	}
+	revisions, err := s.History("l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, rev := range revisions {
+		actions = append(actions, rev.Action)
+	}
+	if !reflect.DeepEqual(actions, []string{"add", "lock", "modify", "unlock", "modify"}) {
+		t.Errorf("Unexpected history %v", actions)
+	}
+
+	r.ShortKey = "nope"
+	r.LastModifiedBy = Admin
+	if _, err := s.Lock(r); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Lock of missing key: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Unlock(r); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Unlock of missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testManage(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "managed", "https://example.com", "t@example.com")
+
+	if _, err := s.Manage(r); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden managing as non-admin, got %v", err)
+	}
+	r.LastModifiedBy = Admin
+	if _, err := s.Manage(r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("managed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Managed != 1 || got.Locked != 1 {
+		t.Errorf("Expected a managed link to be locked, got managed %d locked %d", got.Managed, got.Locked)
+	}
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Managed != 1 {
+		t.Errorf("Expected DumpAllRoutes to show the link managed, got %+v", all)
+	}
+
+	r.ShortKey = "nope"
+	if _, err := s.Manage(r); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Manage of missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testMakeAdmin(t *testing.T, s store.RouteStore) {
+	if _, err := s.MakeAdmin("u@example.com", "t@example.com"); err == nil {
+		t.Error("Expected error when non-admin grants admin")
+	}
+
+	if _, err := s.MakeAdmin("u@example.com", Admin); err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.GetUser("u@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsAdmin != 1 {
+		t.Error("User was not set as admin")
+	}
+
+	// an identity provider can take it away again, and give it to a user not seen before
+	if u, err := s.SetAdmin("u@example.com", false); err != nil || u.IsAdmin != 0 {
+		t.Errorf("Expected admin taken away, got %+v %v", u, err)
+	}
+	if u, _ := s.GetUser("u@example.com"); u.IsAdmin != 0 {
+		t.Error("User is still an admin")
+	}
+	if u, err := s.SetAdmin("new@example.com", true); err != nil || u.IsAdmin != 1 {
+		t.Errorf("Expected new user made admin, got %+v %v", u, err)
+	}
+	if u, _ := s.GetUser("new@example.com"); u.IsAdmin != 1 {
+		t.Error("New user was not set as admin")
+	}
+}
+
+func testDumpAllRoutes(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "one", "http://one.example.com", "t@example.com")
+	mustAdd(t, s, "two", "http://two.example.com", "t@example.com")
+
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for _, r := range all {
+		found[r.ShortKey] = r.URL
+		if r.Creator != "t@example.com" {
+			t.Errorf("Expected creator name in dump, got %s", r.Creator)
+		}
+	}
+	if len(all) != 2 || found["one"] != "http://one.example.com" || found["two"] != "http://two.example.com" {
+		t.Errorf("Unexpected dump %+v", all)
+	}
+
+	// the keys alone, kept up to date as links come and go
+	keys := func(want ...string) {
+		t.Helper()
+		got, err := s.Keys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sorted := append([]string(nil), got...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, want) {
+			t.Errorf("Expected keys %v, got %v", want, sorted)
+		}
+	}
+	keys("one", "two")
+	mustAdd(t, s, "three", "http://three.example.com", "t@example.com")
+	keys("one", "three", "two")
+	if err := s.Delete("one", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	keys("three", "two")
+	if _, err := s.Undelete("one", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	keys("one", "three", "two")
+}
+
+func testCacheInvalidation(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "c", "http://www.google.com", "t@example.com")
+
+	// prime whatever cache the store has
+	if _, err := s.GetURL("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	r.URL = "http://www.new.com"
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.GetURL("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "http://www.new.com" {
+		t.Errorf("Stale url after modify, got %s", v)
+	}
+
+	if err := s.Delete("c", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.GetURL("c"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Deleted key still resolves to %q (err %v)", v, err)
+	}
+}
+
+func testHistory(t *testing.T, s store.RouteStore) {
+	if _, err := s.History("h"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("History of missing key: expected ErrNotFound, got %v", err)
+	}
+
+	r := mustAdd(t, s, "h", "http://www.google.com", "t@example.com")
+	mustAddEditor(t, s, "h", "other@example.com", "t@example.com")
+	r.URL = "http://www.new.com"
+	r.LastModifiedBy = "other@example.com"
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	r.LastModifiedBy = Admin
+	if _, err := s.Lock(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("h", Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := s.History("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		action, url, by string
+		locked          int
+	}{
+		{"add", "http://www.google.com", "t@example.com", 0},
+		{"modify", "http://www.new.com", "other@example.com", 0},
+		{"lock", "http://www.new.com", Admin, 1},
+		{"delete", "http://www.new.com", Admin, 1},
+	}
+	if len(revs) != len(expected) {
+		t.Fatalf("Expected %d revisions, got %+v", len(expected), revs)
+	}
+	for i, e := range expected {
+		rev := revs[i]
+		if rev.Revision != i+1 || rev.Action != e.action || rev.Route.URL != e.url ||
+			rev.ChangedBy != e.by || rev.Route.Locked != e.locked {
+			t.Errorf("Revision %d: expected %+v, got %+v", i+1, e, rev)
+		}
+		if rev.Route.Creator != "t@example.com" || rev.Route.Team != "team@example.com" {
+			t.Errorf("Revision %d: unexpected creator/team %s/%s", i+1, rev.Route.Creator, rev.Route.Team)
+		}
+	}
+}
+
+func testRestore(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "rs", "http://www.google.com", "t@example.com")
+	mustAddEditor(t, s, "rs", "other@example.com", "t@example.com")
+	r.URL = "http://www.new.com"
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	// prime the cache with the new url
+	if _, err := s.GetURL("rs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Restore("rs", 1, "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.GetURL("rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "http://www.google.com" {
+		t.Errorf("Expected restored url, got %s", v)
+	}
+
+	// resurrect a deleted key, which like undeleting takes an owner
+	if err := s.Delete("rs", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("rs", 2, "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Resurrect by an editor: expected ErrForbidden, got %v", err)
+	}
+	if err := s.SetTeams("other@example.com", []string{"team@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("rs", 2, "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "http://www.new.com" || got.Creator != "t@example.com" || got.LastModifiedBy != "other@example.com" {
+		t.Errorf("Unexpected resurrected route %+v", got)
+	}
+
+	revs, err := s.History("rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := revs[len(revs)-1]; last.Action != "restore" || last.Revision != 5 {
+		t.Errorf("Expected restore recorded as revision 5, got %+v", last)
+	}
+
+	if _, err := s.Restore("rs", 99, "other@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Restore of missing revision: expected ErrNotFound, got %v", err)
+	}
+
+	// locked keys can only be restored by an admin
+	got.LastModifiedBy = Admin
+	if _, err := s.Lock(got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("rs", 1, "t@example.com"); err == nil {
+		t.Error("Expected error restoring locked route as non-admin")
+	}
+	if _, err := s.Restore("rs", 1, Admin); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Unlock(got); err != nil {
+		t.Fatal(err)
+	}
+
+	// handing the link back to the team it had takes an owner, which editors are not
+	if err := s.SetTeams("other@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	mustTeam(t, s, "ops@example.com", Admin)
+	if _, err := s.TransferLinks("t@example.com", "", "ops@example.com", Admin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("rs", 1, "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Restore of another team by an editor: expected ErrForbidden, got %v", err)
+	}
+	if got, err := s.Get("rs"); err != nil || got.Team != "ops@example.com" {
+		t.Errorf("Expected rs to stay with ops@example.com, got %+v (err %v)", got, err)
+	}
+	if _, err := s.Restore("rs", 1, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("rs"); err != nil || got.Team != "team@example.com" {
+		t.Errorf("Expected rs back with team@example.com, got %+v (err %v)", got, err)
+	}
+}
+
+func testTrash(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "tr", "http://www.google.com", "t@example.com")
+	if _, err := s.GetURL("tr"); err != nil {
+		t.Fatal(err)
+	}
+	// deleting takes an owner, and other is one as a member of the link's team
+	if err := s.SetTeams("other@example.com", []string{"team@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("tr", "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// trashed keys are gone as far as lookups go
+	if _, err := s.GetURL("tr"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetURL of trashed key: expected ErrNotFound, got %v", err)
+	}
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Errorf("Trashed route still in dump %+v", all)
+	}
+
+	trash, err := s.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ShortKey != "tr" || trash[0].DeletedBy != "other@example.com" || trash[0].DeletedAt == "" {
+		t.Fatalf("Unexpected trash %+v", trash)
+	}
+
+	if _, err := s.Undelete("tr", "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.GetURL("tr"); err != nil || v != "http://www.google.com" {
+		t.Errorf("Undeleted key resolves to %q (err %v)", v, err)
+	}
+	if _, err := s.Undelete("tr", "other@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Undelete of live key: expected ErrNotFound, got %v", err)
+	}
+
+	// a new link can take over a trashed key
+	if err := s.Delete("tr", "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, s, "tr", "http://www.new.com", "u@example.com")
+	if trash, _ := s.Trash(); len(trash) != 0 {
+		t.Errorf("Expected empty trash after key was reused, got %+v", trash)
+	}
+
+	// restoring a trashed key takes it out of the trash
+	if err := s.Delete("tr", "u@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := s.History("tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("tr", revs[len(revs)-1].Revision, "u@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.GetURL("tr"); err != nil || v != "http://www.new.com" {
+		t.Errorf("Restored key resolves to %q (err %v)", v, err)
+	}
+
+	// purging only takes what is old enough
+	mustAdd(t, s, "old", "http://www.google.com", "t@example.com")
+	if err := s.Delete("old", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.PurgeTrash(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("Purged %d routes that were not old enough", n)
+	}
+	n, err = s.PurgeTrash(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 route purged, got %d", n)
+	}
+	if _, err := s.Undelete("old", "t@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Undelete of purged key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testTemplate(t *testing.T, s store.RouteStore) {
+	mustTeam(t, s, "team@example.com", "t@example.com")
+	r, err := routes.NewRoute("jira", "https://jira.example.com/browse/%s", "t@example.com", "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.FallbackURL = "https://jira.example.com"
+	if _, err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Lookup("jira")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != r.URL || got.FallbackURL != r.FallbackURL {
+		t.Errorf("Unexpected lookup %+v", got)
+	}
+
+	r.FallbackURL = "https://jira.example.com/projects"
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("jira"); got.FallbackURL != r.FallbackURL {
+		t.Errorf("Stale fallback url after modify, got %s", got.FallbackURL)
+	}
+	if got, _ := s.Get("jira"); got.FallbackURL != r.FallbackURL {
+		t.Errorf("Get returned fallback url %s", got.FallbackURL)
+	}
+
+	if _, err := s.Restore("jira", 1, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("jira"); got.FallbackURL != "https://jira.example.com" {
+		t.Errorf("Fallback url not restored, got %s", got.FallbackURL)
+	}
+}
+
+func testPassthrough(t *testing.T, s store.RouteStore) {
+	mustTeam(t, s, "team@example.com", "t@example.com")
+	r, err := routes.NewRoute("docs", "https://docs.example.com", "t@example.com", "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Passthrough = routes.PassthroughStrict
+	if _, err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("docs"); got.Passthrough != routes.PassthroughStrict {
+		t.Errorf("Lookup returned passthrough %q", got.Passthrough)
+	}
+
+	r.Passthrough = routes.PassthroughIgnore
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("docs"); got.Passthrough != routes.PassthroughIgnore {
+		t.Errorf("Stale passthrough after modify, got %q", got.Passthrough)
+	}
+	if got, _ := s.Get("docs"); got.Passthrough != routes.PassthroughIgnore {
+		t.Errorf("Get returned passthrough %q", got.Passthrough)
+	}
+
+	if _, err := s.Restore("docs", 1, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("docs"); got.Passthrough != routes.PassthroughStrict {
+		t.Errorf("Passthrough not restored, got %q", got.Passthrough)
+	}
+}
+
+func testTargets(t *testing.T, s store.RouteStore) {
+	mustTeam(t, s, "team@example.com", "t@example.com")
+	r, err := routes.NewRoute("oncall", "https://dash.example.com/a", "t@example.com", "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Targets = routes.Targets{{URL: "https://dash.example.com/a", Weight: 3}, {URL: "https://dash.example.com/b"}}
+	r.Rotation = routes.RotationWeighted
+	if _, err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	// the second Lookup is served from the cache
+	for _, get := range []func(string) (routes.Route, error){s.Lookup, s.Lookup, s.Get} {
+		got, err := get("oncall")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Targets, r.Targets) || got.Rotation != r.Rotation {
+			t.Errorf("Unexpected targets %+v %s", got.Targets, got.Rotation)
+		}
+	}
+
+	r.Targets = r.Targets[1:]
+	r.Rotation = ""
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("oncall"); len(got.Targets) != 1 || got.Rotation != "" {
+		t.Errorf("Stale targets after modify, got %+v %s", got.Targets, got.Rotation)
+	}
+
+	r.Targets = nil
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("oncall"); got.Targets != nil {
+		t.Errorf("Targets not cleared, got %+v", got.Targets)
+	}
+}
+
+func testRandom(t *testing.T, s store.RouteStore) {
+	if _, err := s.Random(); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Random from an empty store returned %v", err)
+	}
+
+	mustAdd(t, s, "jira", "https://jira.example.com/browse/%s", "t@example.com")
+	mustAdd(t, s, "gone", "https://gone.example.com", "t@example.com")
+	if err := s.Delete("gone", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Random(); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Random picked a template or deleted route, %v", err)
+	}
+
+	mustAdd(t, s, "wiki", "https://wiki.example.com", "t@example.com")
+	for i := 0; i < 5; i++ {
+		r, err := s.Random()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ShortKey != "wiki" || r.URL != "https://wiki.example.com" {
+			t.Errorf("Unexpected random route %+v", r)
+		}
+	}
+}
+
+// mustAddNamespace has the Admin hand the namespace name to team.
+// mustAddEditor has owner make editor an editor of the link k.
+func mustAddEditor(t *testing.T, s store.RouteStore, k string, editor string, owner string) {
+	t.Helper()
+	if err := s.AddEditor(k, editor, owner); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustAddNamespace(t *testing.T, s store.RouteStore, name string, team string) {
+	t.Helper()
+	mustTeam(t, s, team, Admin)
+	ns, err := routes.NewNamespace(name, team, Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddNamespace(ns); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testNamespaces(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "oncall", "https://oncall.example.com", "t@example.com")
+
+	ns, err := routes.NewNamespace("payments", "payments@example.com", "t@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddNamespace(ns); err == nil {
+		t.Error("Non admin was able to create a namespace")
+	}
+	ns, _ = routes.NewNamespace("oncall", "payments@example.com", Admin)
+	if _, err := s.AddNamespace(ns); err == nil {
+		t.Error("Created a namespace shadowed by an existing key")
+	}
+	ns, _ = routes.NewNamespace("payments", "payments@example.com", Admin)
+	if _, err := s.AddNamespace(ns); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Namespace for a team that does not exist: expected ErrNotFound, got %v", err)
+	}
+	mustAddNamespace(t, s, "payments", "payments@example.com")
+	mustTeam(t, s, "payments@example.com", "p@example.com")
+
+	got, err := s.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "payments" || got[0].Team != "payments@example.com" || got[0].Creator != Admin {
+		t.Errorf("Unexpected namespaces %+v", got)
+	}
+
+	add := func(k string, team string, creator string) error {
+		r, err := routes.NewRoute(k, "https://example.com", creator, team)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Add(r)
+		return err
+	}
+	if err := add("payments", "payments@example.com", "p@example.com"); err == nil {
+		t.Error("Created a key that shadows a namespace")
+	}
+	if err := add("billing/oncall", "payments@example.com", "p@example.com"); err == nil {
+		t.Error("Created a key in a namespace that does not exist")
+	}
+	if err := add("payments/oncall", "team@example.com", "t@example.com"); err == nil {
+		t.Error("Created a key in another team's namespace")
+	}
+	if err := add("payments/oncall", "payments@example.com", "p@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := add("payments/admin", "team@example.com", Admin); err != nil {
+		t.Errorf("Admin should be able to use any namespace, %v", err)
+	}
+	ok, _ := routes.NewRoute("payments/ok", "https://example.com", "p@example.com", "payments@example.com")
+	refused, _ := routes.NewRoute("payments/refused", "https://example.com", "t@example.com", "team@example.com")
+	if n, err := s.AddAll([]routes.Route{ok, refused}); n != 1 || !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("AddAll with the second route refused: expected 1 and ErrForbidden, got %d and %v", n, err)
+	}
+	if _, err := s.Get("payments/ok"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected AddAll to add nothing when a route is refused, got %v", err)
+	}
+
+	if err := s.DeleteNamespace("payments", Admin); err == nil {
+		t.Error("Deleted a namespace that still has keys")
+	}
+	for _, k := range []string{"payments/oncall", "payments/admin"} {
+		if err := s.Delete(k, Admin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.DeleteNamespace("payments", "p@example.com"); err == nil {
+		t.Error("Non admin was able to delete a namespace")
+	}
+	if err := s.DeleteNamespace("payments", Admin); err != nil {
+		t.Error(err)
+	}
+	if err := s.DeleteNamespace("payments", Admin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Deleting a missing namespace returned %v", err)
+	}
+
+	// payments now belongs to another team, so its old keys can not come back
+	mustAddNamespace(t, s, "payments", "team@example.com")
+	if _, err := s.Undelete("payments/oncall", "p@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Undelete into another team's namespace: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.Restore("payments/oncall", 1, "p@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Restore from the trash into another team's namespace: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.PurgeTrash(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore("payments/oncall", 1, "p@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Restore after the purge into another team's namespace: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.Restore("payments/admin", 1, Admin); err != nil {
+		t.Errorf("Admin should be able to restore into any namespace, %v", err)
+	}
+}
+
+func testLookupPrefix(t *testing.T, s store.RouteStore) {
+	mustAddNamespace(t, s, "payments", "team@example.com")
+	mustAdd(t, s, "jira", "https://jira.example.com/browse/%s", "t@example.com")
+	mustAdd(t, s, "payments/oncall", "https://pay.example.com/oncall", "t@example.com")
+	mustAdd(t, s, "payments/oncall/eu", "https://pay.example.com/oncall-eu", "t@example.com")
+
+	tests := []struct {
+		path string
+		key  string
+		args []string
+	}{
+		{"jira", "jira", nil},
+		{"jira/PROJ-1", "jira", []string{"PROJ-1"}},
+		{"payments/oncall", "payments/oncall", nil},
+		{"payments/oncall/us", "payments/oncall", []string{"us"}},
+		{"payments/oncall/eu/today", "payments/oncall/eu", []string{"today"}},
+	}
+	for _, tc := range tests {
+		r, args, err := s.LookupPrefix(tc.path)
+		if err != nil {
+			t.Errorf("%s: %v", tc.path, err)
+			continue
+		}
+		if r.ShortKey != tc.key || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s resolved to %s %v, expected %s %v", tc.path, r.ShortKey, args, tc.key, tc.args)
+		}
+	}
+
+	if _, _, err := s.LookupPrefix("payments/unknown"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown key, got %v", err)
+	}
+}
+
+func testNormalization(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "On-Call", "https://oncall.example.com", "t@example.com")
+
+	for _, k := range []string{"oncall", "ONCALL", "on_call", "on.call"} {
+		r, err := s.Lookup(k)
+		if err != nil {
+			t.Errorf("Lookup of %s: %v", k, err)
+			continue
+		}
+		if r.URL != "https://oncall.example.com" {
+			t.Errorf("Lookup of %s returned %s", k, r.URL)
+		}
+	}
+	if r, err := s.Get("on-CALL"); err != nil || r.ShortKey != "oncall" {
+		t.Errorf("Get returned %+v, %v", r, err)
+	}
+
+	// the unique check has to see through the spelling too
+	r, err := routes.NewRoute("on_call", "https://other.example.com", "t@example.com", "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(r); !s.IsSQLErrDuplicateContraint(err) {
+		t.Errorf("Expected a duplicate error, got %v", err)
+	}
+
+	r.ShortKey = "ON-CALL"
+	if _, err := s.Modify(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Lookup("on-call"); got.URL != "https://other.example.com" {
+		t.Errorf("Stale url after modify, got %s", got.URL)
+	}
+	if err := s.Delete("On.Call", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lookup("oncall"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func testRevisions(t *testing.T, s store.RouteStore) {
+	mustAdd(t, s, "rev", "https://one.example.com", "t@example.com")
+
+	r, err := s.Get("rev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Revision != 1 {
+		t.Fatalf("Expected a new route at revision 1, got %d", r.Revision)
+	}
+
+	// two editors start from revision 1, the second loses
+	first, second := r, r
+	first.URL = "https://two.example.com"
+	if _, err := s.Modify(first); err != nil {
+		t.Fatal(err)
+	}
+	second.URL = "https://three.example.com"
+	if _, err := s.Modify(second); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Expected ErrConflict for a stale revision, got %v", err)
+	}
+	got, err := s.Get("rev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "https://two.example.com" || got.Revision != 2 {
+		t.Errorf("Expected the first edit at revision 2, got %s at %d", got.URL, got.Revision)
+	}
+
+	second.Revision = got.Revision
+	if _, err := s.Modify(second); err != nil {
+		t.Errorf("Modify at the current revision: %v", err)
+	}
+
+	// no revision means no check
+	second.Revision = 0
+	second.URL = "https://four.example.com"
+	if _, err := s.Modify(second); err != nil {
+		t.Errorf("Modify without a revision: %v", err)
+	}
+
+	r.LastModifiedBy = Admin
+	if _, err := s.Lock(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("rev"); got.Revision != 5 {
+		t.Errorf("Expected every change to bump the revision to 5, got %d", got.Revision)
+	}
+}
+
+func testTokens(t *testing.T, s store.RouteStore) {
+	ci, err := s.CreateToken("t@example.com", "ci", []string{store.ScopeLinksRead, store.ScopeLinksWrite}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ci.Token) < 40 || ci.Token[:len(store.TokenPrefix)] != store.TokenPrefix {
+		t.Errorf("Unexpected token %q", ci.Token)
+	}
+	if _, err := s.CreateToken("t@example.com", "ci", []string{store.ScopeLinksRead}, time.Time{}); err == nil {
+		t.Error("Expected an error for a second token with the same name")
+	}
+	for _, scopes := range [][]string{nil, {"links:everything"}} {
+		if _, err := s.CreateToken("t@example.com", "bad", scopes, time.Time{}); err == nil {
+			t.Errorf("Expected an error for scopes %v", scopes)
+		}
+	}
+	if _, err := s.CreateToken("t@example.com", "root", []string{store.ScopeAdmin}, time.Time{}); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a non-admin's admin token, got %v", err)
+	}
+	if _, err := s.CreateToken(Admin, "root", []string{store.ScopeAdmin}, time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("Expected an admin to get an admin token, got %v", err)
+	}
+
+	got, err := s.CheckToken(ci.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != ci.ID || got.User != "t@example.com" || !got.HasScope(store.ScopeLinksWrite) || got.HasScope(store.ScopeAdmin) || got.Token != "" {
+		t.Errorf("Unexpected token %+v", got)
+	}
+	for _, bad := range []string{ci.Token + "x", "not-a-token", ""} {
+		if _, err := s.CheckToken(bad); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound checking %q, got %v", bad, err)
+		}
+	}
+
+	tokens, err := s.Tokens("t@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "ci" || tokens[0].LastUsedAt == "" || tokens[0].Token != "" {
+		t.Errorf("Expected the ci token, used and without its secret, got %+v", tokens)
+	}
+
+	if err := s.RevokeToken(ci.ID, "u@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden revoking someone else's token, got %v", err)
+	}
+	if err := s.RevokeToken(ci.ID, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CheckToken(ci.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected a revoked token to be ErrNotFound, got %v", err)
+	}
+	if err := s.RevokeToken(ci.ID, "t@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound revoking twice, got %v", err)
+	}
+
+	// an admin may revoke anyone's
+	other, err := s.CreateToken("u@example.com", "script", []string{store.ScopeLinksRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeToken(other.ID, Admin); err != nil {
+		t.Errorf("Expected an admin to revoke any token, got %v", err)
+	}
+}
+
+func testPermissions(t *testing.T, s store.RouteStore) {
+	r := mustAdd(t, s, "p", "http://www.google.com", "t@example.com")
+	access := func(user string, want store.Access) {
+		t.Helper()
+		got, err := s.Access("p", user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Expected %s to be %s of p, got %s", user, want, got)
+		}
+	}
+	access("t@example.com", store.AccessOwner)
+	access("other@example.com", store.AccessNone)
+	access(Admin, store.AccessAdmin)
+
+	// strangers may not change or delete the link, and are told who may
+	r.URL = "http://www.new.com"
+	r.LastModifiedBy = "other@example.com"
+	_, err := s.Modify(r)
+	if !errors.Is(err, store.ErrForbidden) {
+		t.Fatalf("Modify by a stranger: expected ErrForbidden, got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "t@example.com") || !strings.Contains(msg, "team@example.com") {
+		t.Errorf("Expected the owners named in %q", msg)
+	}
+	if err := s.Delete("p", "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Delete by a stranger: expected ErrForbidden, got %v", err)
+	}
+
+	// editors may change the link but not delete it or choose other editors
+	if err := s.AddEditor("p", "e@example.com", "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("AddEditor by a stranger: expected ErrForbidden, got %v", err)
+	}
+	mustAddEditor(t, s, "p", "other@example.com", "t@example.com")
+	mustAddEditor(t, s, "p", "other@example.com", "t@example.com")
+	if editors, err := s.Editors("p"); err != nil || !reflect.DeepEqual(editors, []string{"other@example.com"}) {
+		t.Errorf("Unexpected editors %v (err %v)", editors, err)
+	}
+	access("other@example.com", store.AccessEditor)
+	if _, err := s.Modify(r); err != nil {
+		t.Errorf("Modify by an editor: %v", err)
+	}
+	if err := s.Delete("p", "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Delete by an editor: expected ErrForbidden, got %v", err)
+	}
+	if err := s.AddEditor("p", "e@example.com", "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("AddEditor by an editor: expected ErrForbidden, got %v", err)
+	}
+	if err := s.RemoveEditor("p", "other@example.com", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveEditor("p", "other@example.com", "t@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("RemoveEditor of a non-editor: expected ErrNotFound, got %v", err)
+	}
+	access("other@example.com", store.AccessNone)
+
+	// members of the link's team own it
+	if err := s.SetTeams("other@example.com", []string{"team@example.com", "team@example.com", " "}); err != nil {
+		t.Fatal(err)
+	}
+	if teams, err := s.Teams("other@example.com"); err != nil || !reflect.DeepEqual(teams, []string{"team@example.com"}) {
+		t.Errorf("Unexpected teams %v (err %v)", teams, err)
+	}
+	access("other@example.com", store.AccessOwner)
+	if err := s.SetTeams("other@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	access("other@example.com", store.AccessNone)
+
+	// admins may do anything
+	mustAddEditor(t, s, "p", "other@example.com", Admin)
+	if err := s.Delete("p", Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// editors of a link do not carry over to a new one with the same key
+	mustAdd(t, s, "p", "http://www.google.com", "u@example.com")
+	if editors, err := s.Editors("p"); err != nil || len(editors) != 0 {
+		t.Errorf("Expected no editors of the new p, got %v (err %v)", editors, err)
+	}
+	access("other@example.com", store.AccessNone)
+}
+
+func testTeams(t *testing.T, s store.RouteStore) {
+	// links may only go to teams that exist, and that their creator is in
+	r, err := routes.NewRoute("solo", "http://www.google.com", "t@example.com", "team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(r); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Add for a team that does not exist: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Team("team@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected no team made by adding a link, got %v", err)
+	}
+	mustAdd(t, s, "p", "http://www.google.com", "t@example.com")
+	r.Creator, r.LastModifiedBy = "other@example.com", "other@example.com"
+	if _, err := s.Add(r); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Add for a team the creator is not in: expected ErrForbidden, got %v", err)
+	}
+	r.Team = ""
+	if _, err := s.Add(r); err != nil {
+		t.Errorf("Add with no team: %v", err)
+	}
+	if solo, err := s.Get("solo"); err != nil || solo.Team != "" || solo.Creator != "other@example.com" {
+		t.Errorf("Expected solo owned by its creator alone, got %+v (err %v)", solo, err)
+	}
+
+	team, err := s.Team("team@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.MemberAccess != store.AccessOwner || team.DefaultAccess != store.AccessNone {
+		t.Errorf("Unexpected access of a new team %+v", team)
+	}
+	if !reflect.DeepEqual(team.Members, []store.TeamMember{{User: "t@example.com", Manager: true}}) {
+		t.Errorf("Unexpected members of a new team %v", team.Members)
+	}
+	if _, err := s.CreateTeam(store.Team{Name: "team@example.com"}, "other@example.com"); err == nil {
+		t.Error("Expected an error creating a team twice")
+	}
+	if _, err := s.CreateTeam(store.Team{Name: "ops", DefaultAccess: store.AccessOwner}, "other@example.com"); err == nil {
+		t.Error("Expected an error letting everyone own a team's links")
+	}
+	if _, err := s.Team("nobody@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Team of a missing team: expected ErrNotFound, got %v", err)
+	}
+	if byID, err := s.TeamByID(team.ID); err != nil || !reflect.DeepEqual(byID, team) {
+		t.Errorf("Expected team by id %+v, got %+v (err %v)", team, byID, err)
+	}
+
+	// provisioned teams start out with nobody in them
+	ops, err := s.CreateTeam(store.Team{Name: "ops@example.com"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops.Creator != "" || len(ops.Members) != 0 {
+		t.Errorf("Unexpected provisioned team %+v", ops)
+	}
+
+	// only managers and admins change a team
+	if err := s.AddTeamMember("team@example.com", "m@example.com", false, "other@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("AddTeamMember by a stranger: expected ErrForbidden, got %v", err)
+	}
+	if err := s.AddTeamMember("team@example.com", "m@example.com", false, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.Access("p", "m@example.com"); a != store.AccessOwner {
+		t.Errorf("Expected a member to own p, got %s", a)
+	}
+	if _, err := s.UpdateTeam(store.Team{Name: "team@example.com", MemberAccess: store.AccessEditor}, "m@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("UpdateTeam by a member: expected ErrForbidden, got %v", err)
+	}
+
+	// the team decides what its members and everyone else may do to its links
+	team, err = s.UpdateTeam(store.Team{Name: "team@example.com", MemberAccess: store.AccessEditor, DefaultAccess: store.AccessEditor}, "t@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.MemberAccess != store.AccessEditor || team.DefaultAccess != store.AccessEditor {
+		t.Errorf("Unexpected access of the changed team %+v", team)
+	}
+	if a, _ := s.Access("p", "m@example.com"); a != store.AccessEditor {
+		t.Errorf("Expected a member to be an editor of p, got %s", a)
+	}
+	if a, _ := s.Access("p", "other@example.com"); a != store.AccessEditor {
+		t.Errorf("Expected everyone to be an editor of p, got %s", a)
+	}
+	if err := s.Delete("p", "m@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Delete by an editing member: expected ErrForbidden, got %v", err)
+	}
+
+	// members see their teams' links
+	mustAdd(t, s, "q", "http://www.google.com", "u@example.com")
+	links, err := s.TeamLinks("m@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, l := range links {
+		if l.Team != "team@example.com" || l.TeamID != team.ID {
+			t.Errorf("Unexpected team of %s: %s (%d)", l.ShortKey, l.Team, l.TeamID)
+		}
+		keys = append(keys, l.ShortKey)
+	}
+	if !reflect.DeepEqual(keys, []string{"p", "q"}) {
+		t.Errorf("Unexpected team links %v", keys)
+	}
+
+	// anyone may leave, and a team that owns links cannot be deleted
+	if err := s.RemoveTeamMember("team@example.com", "m@example.com", "m@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveTeamMember("team@example.com", "m@example.com", "t@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("RemoveTeamMember of a non-member: expected ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteTeam("team@example.com", Admin); err == nil {
+		t.Error("Expected an error deleting a team that owns links")
+	}
+	for _, k := range []string{"p", "q"} {
+		if err := s.Delete(k, Admin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.PurgeTrash(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTeam("team@example.com", "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	teams, err := s.AllTeams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, team := range teams {
+		if team.Name == "team@example.com" {
+			t.Error("Expected team@example.com to be gone")
+		}
+	}
+}
+
+func testTeamMembers(t *testing.T, s store.RouteStore) {
+	admins := func(team string) bool { return team == "admins@example.com" || team == "ops@example.com" }
+	isAdmin := func(user string) bool {
+		t.Helper()
+		u, err := s.FindUser(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.IsAdmin == 1
+	}
+	members := func(team store.Team) []string {
+		names := make([]string, 0)
+		for _, m := range team.Members {
+			names = append(names, m.User)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if _, err := s.SetTeamMembers(store.Team{Name: "admins@example.com"}, []string{"a@example.com"}, admins, "t@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Creating a team without managers as a non-admin: expected ErrForbidden, got %v", err)
+	}
+	team, err := s.SetTeamMembers(store.Team{Name: "admins@example.com"}, []string{"a@example.com", "b@example.com", "a@example.com"}, admins, Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := members(team); !reflect.DeepEqual(got, []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("Expected a and b in the new team, got %v", got)
+	}
+	if !isAdmin("a@example.com") || !isAdmin("b@example.com") {
+		t.Error("Expected joining an admin team to make a and b admins")
+	}
+	if _, err := s.SetTeamMembers(store.Team{Name: "admins@example.com"}, nil, admins, Admin); err == nil {
+		t.Error("Expected an error creating a team that exists")
+	}
+	if _, err := s.SetTeamMembers(store.Team{Name: "ops@example.com"}, []string{"b@example.com"}, admins, Admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// a leaves and stops being an admin, b stays one through ops
+	if team, err = s.SetTeamMembers(team, []string{"b@example.com", "c@example.com"}, admins, Admin); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(team); !reflect.DeepEqual(got, []string{"b@example.com", "c@example.com"}) {
+		t.Errorf("Expected b and c in the team, got %v", got)
+	}
+	if isAdmin("a@example.com") || !isAdmin("c@example.com") {
+		t.Error("Expected a no longer an admin and c made one")
+	}
+	if _, err = s.SetTeamMembers(team, []string{"c@example.com"}, admins, Admin); err != nil {
+		t.Fatal(err)
+	}
+	if !isAdmin("b@example.com") {
+		t.Error("Expected b still an admin through ops@example.com")
+	}
+
+	// managers who stay keep managing, and only managers and admins may change members
+	mustTeam(t, s, "dev@example.com", "t@example.com")
+	dev, err := s.Team("dev@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetTeamMembers(dev, []string{"x@example.com"}, nil, "x@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("SetTeamMembers by a stranger: expected ErrForbidden, got %v", err)
+	}
+	if dev, err = s.SetTeamMembers(dev, []string{"t@example.com", "x@example.com"}, nil, "t@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []store.TeamMember{{User: "t@example.com", Manager: true}, {User: "x@example.com"}}
+	sort.Slice(dev.Members, func(i, j int) bool { return dev.Members[i].User < dev.Members[j].User })
+	if !reflect.DeepEqual(dev.Members, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, dev.Members)
+	}
+	if isAdmin("x@example.com") {
+		t.Error("Expected joining a team that makes nobody admin to leave x as they were")
+	}
+}
+
+func testDeactivation(t *testing.T, s store.RouteStore) {
+	// team@example.com is created by t@example.com, who stays, and solo@example.com by
+	// gone@example.com, who leaves
+	mustAdd(t, s, "d", "http://www.google.com", "t@example.com")
+	mustAdd(t, s, "a", "http://www.google.com", "gone@example.com")
+	mustAdd(t, s, "b", "http://www.google.com", "gone@example.com")
+	mustTeam(t, s, "solo@example.com", "gone@example.com")
+	r, err := routes.NewRoute("c", "http://www.google.com", "gone@example.com", "solo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SetDeactivated("gone@example.com", true, "t@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("SetDeactivated by a non-admin: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.SetDeactivated(Admin, true, Admin); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("SetDeactivated of oneself: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.SetDeactivated("typo@example.com", true, Admin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetDeactivated of an unknown user: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindUser("typo@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected SetDeactivated not to create typo@example.com, got %v", err)
+	}
+	u, err := s.SetDeactivated("gone@example.com", true, Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Deactivated != 1 {
+		t.Errorf("Expected gone@example.com to be deactivated, got %+v", u)
+	}
+	if u, err := s.GetUser("gone@example.com"); err != nil || u.Deactivated != 1 {
+		t.Errorf("Expected gone@example.com to stay deactivated, got %+v (err %v)", u, err)
+	}
+
+	// the team still has an active member who owns a and b, c has nobody left
+	orphans := func(want ...string) {
+		t.Helper()
+		links, err := s.OrphanedLinks(Admin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, 0)
+		for _, l := range links {
+			keys = append(keys, l.ShortKey)
+		}
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("Expected orphaned links %v, got %v", want, keys)
+		}
+	}
+	orphans("c")
+	if _, err := s.OrphanedLinks("t@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("OrphanedLinks for a non-admin: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.UpdateTeam(store.Team{Name: "team@example.com", MemberAccess: store.AccessEditor}, Admin); err != nil {
+		t.Fatal(err)
+	}
+	orphans("a", "b", "c")
+
+	// only admins transfer links, and only between users and to teams that exist
+	if _, err := s.TransferLinks("gone@example.com", "t@example.com", "", "t@example.com"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("TransferLinks by a non-admin: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.TransferLinks("gone@example.com", "", "nobody@example.com", Admin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("TransferLinks to a missing team: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.TransferLinks("gone@example.com", "", "", Admin); err == nil {
+		t.Error("Expected an error transferring links to nobody")
+	}
+	if _, err := s.TransferLinks("gone@example.com", "new@example.con", "", Admin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("TransferLinks to a missing user: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindUser("new@example.con"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected no user made by a transfer, got %v", err)
+	}
+	if _, err := s.TransferLinks("nobody@example.com", "t@example.com", "", Admin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("TransferLinks from a missing user: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetUser("new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.TransferLinks("gone@example.com", "new@example.com", "", Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected transferred links %v", keys)
+	}
+	orphans()
+	a, err := s.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Creator != "new@example.com" || a.Team != "team@example.com" || a.Revision != 2 {
+		t.Errorf("Unexpected transferred link %+v", a)
+	}
+	if got, _ := s.Access("c", "new@example.com"); got != store.AccessOwner {
+		t.Errorf("Expected new@example.com to own c, got %s", got)
+	}
+	revisions, err := s.History("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := revisions[len(revisions)-1]; last.Action != "transfer" || last.ChangedBy != Admin {
+		t.Errorf("Unexpected last revision of c %+v", last)
+	}
+
+	// links can go to a team, keeping their creator
+	if _, err := s.CreateTeam(store.Team{Name: "ops@example.com"}, Admin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TransferLinks("new@example.com", "", "ops@example.com", Admin); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.Get("c"); err != nil || c.Creator != "new@example.com" || c.Team != "ops@example.com" {
+		t.Errorf("Unexpected link transferred to a team %+v (err %v)", c, err)
+	}
+	if d, err := s.Get("d"); err != nil || d.Team != "team@example.com" {
+		t.Errorf("Expected d to stay with its team, got %+v (err %v)", d, err)
+	}
+
+	if u, err := s.SetDeactivated("gone@example.com", false, Admin); err != nil || u.Deactivated != 0 {
+		t.Errorf("Expected gone@example.com to be reactivated, got %+v (err %v)", u, err)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// A synced directory declares links in YAML files, each a list of routes as written by
+// `goservice export -format yaml`, so that they can be reviewed like code.  Sync makes the
+// store match it: links in the files are added or changed and marked managed, which locks
+// them, and managed links that are no longer in any file are deleted.  Links made in the UI
+// are left alone unless a file declares them, in which case they are adopted.
+
+// What Sync did, or in a dry run would do, to a link.
+const (
+	SyncAdded    = "add"
+	SyncModified = "modify"
+	SyncAdopted  = "adopt"
+	SyncDeleted  = "delete"
+)
+
+// SyncChange is one change Sync made to the store, or tried to make when Error is set.
+// Source is the file declaring the link, empty for deletes.
+type SyncChange struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SyncLink is a link declared in a synced directory, along with the file declaring it.
+type SyncLink struct {
+	Route  routes.Route
+	Source string
+}
+
+// ReadSyncDir reads every .yaml and .yml file under dir, giving links without a creator to
+// creator.  Any file or link that cannot be read, or a key declared twice, fails the whole
+// read: syncing part of a directory would delete the links in the rest.
+func ReadSyncDir(dir string, creator string) ([]SyncLink, error) {
+	var links []SyncLink
+	var problems []string
+	seen := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				// .git and the like
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		records, err := routes.ReadRoutes(f, routes.FormatYAML, creator)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		for _, rec := range records {
+			if rec.Err != nil {
+				problems = append(problems, fmt.Sprintf("%s entry %d: %v", rel, rec.Row, rec.Err))
+				continue
+			}
+			if other, ok := seen[rec.Route.ShortKey]; ok {
+				problems = append(problems, fmt.Sprintf("%s entry %d: %s is also declared in %s", rel, rec.Row, rec.Route.ShortKey, other))
+				continue
+			}
+			seen[rec.Route.ShortKey] = rel
+			links = append(links, SyncLink{Route: rec.Route, Source: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("Could not read %s:\n%s", dir, strings.Join(problems, "\n"))
+	}
+	if len(links) == 0 {
+		// more likely a bad checkout than a wish to delete every managed link
+		return nil, fmt.Errorf("No links found in %s", dir)
+	}
+	return links, nil
+}
+
+// Sync makes the links in s match links, as user, who must be an admin to lock them.  With
+// dryRun nothing is changed and the changes that would be made are returned.  A change that
+// fails is reported and the rest carry on.
+func Sync(s RouteStore, links []SyncLink, user string, dryRun bool) ([]SyncChange, error) {
+	u, err := s.GetUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsAdmin != 1 {
+		return nil, fmt.Errorf("%w, sync user %s is not admin", ErrForbidden, user)
+	}
+	all, err := s.DumpAllRoutes()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]routes.Route, len(all))
+	for _, r := range all {
+		current[r.ShortKey] = r
+	}
+
+	var changes []SyncChange
+	declared := make(map[string]bool, len(links))
+	for _, link := range links {
+		route := link.Route
+		declared[route.ShortKey] = true
+		existing, ok := current[route.ShortKey]
+
+		change := SyncChange{Key: route.ShortKey, Source: link.Source}
+		modify := ok && !sameLink(existing, route)
+		switch {
+		case !ok:
+			change.Action = SyncAdded
+		case existing.Managed != 1:
+			change.Action = SyncAdopted
+		case modify:
+			change.Action = SyncModified
+		default:
+			continue
+		}
+		changes = append(changes, change)
+		if dryRun {
+			continue
+		}
+
+		var err error
+		switch {
+		case !ok:
+			_, err = s.Add(route)
+		case modify:
+			route.LastModifiedBy = user
+			route.Revision = existing.Revision
+			_, err = s.Modify(route)
+		}
+		if err == nil && existing.Managed != 1 {
+			_, err = s.Manage(routes.Route{ShortKey: route.ShortKey, LastModifiedBy: user})
+		}
+		if err != nil {
+			changes[len(changes)-1].Error = err.Error()
+		}
+	}
+
+	// managed links whose declaration has gone
+	var gone []string
+	for k, r := range current {
+		if r.Managed == 1 && !declared[k] {
+			gone = append(gone, k)
+		}
+	}
+	sort.Strings(gone)
+	for _, k := range gone {
+		change := SyncChange{Key: k, Action: SyncDeleted}
+		if !dryRun {
+			if err := s.Delete(k, user); err != nil && !errors.Is(err, ErrNotFound) {
+				change.Error = err.Error()
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
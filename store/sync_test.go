@@ -0,0 +1,148 @@
+package store_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+	"github.com/tcotav/golinks/store/storetest"
+)
+
+// writeSyncDir lays files out in a fresh directory, removed when the test ends.
+func writeSyncDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "golinks-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSync(t *testing.T) {
+	s, err := store.NewStore("sqlite", newSQLiteDB(t), nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"wiki", "jira"} {
+		r, _ := routes.NewRoute(k, "https://"+k+".example.com", "t@example.com", "")
+		if _, err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := writeSyncDir(t, map[string]string{
+		"platform/links.yaml": "- shortkey: oncall\n  url: https://oncall.example.com\n- shortkey: wiki\n  url: https://new-wiki.example.com\n",
+		"docs.yml":            "- shortkey: docs\n  url: https://docs.example.com\n  creator: docs@example.com\n",
+		"README.md":           "not links",
+		".git/config.yaml":    "not: links",
+	})
+	links, err := store.ReadSyncDir(dir, storetest.Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := store.Sync(s, links, storetest.Admin, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []store.SyncChange{
+		{Key: "docs", Action: store.SyncAdded, Source: "docs.yml"},
+		{Key: "oncall", Action: store.SyncAdded, Source: filepath.Join("platform", "links.yaml")},
+		{Key: "wiki", Action: store.SyncAdopted, Source: filepath.Join("platform", "links.yaml")},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+	if _, err := s.Get("oncall"); !errors.Is(err, store.ErrNotFound) {
+		t.Error("A dry run added links")
+	}
+
+	if _, err := store.Sync(s, links, "t@example.com", false); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden syncing as a non-admin, got %v", err)
+	}
+	changes, err = store.Sync(s, links, storetest.Admin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Error != "" {
+			t.Errorf("Unexpected error syncing %s: %s", c.Key, c.Error)
+		}
+	}
+	wiki, _ := s.Get("wiki")
+	if wiki.URL != "https://new-wiki.example.com" || wiki.Managed != 1 || wiki.Locked != 1 {
+		t.Errorf("Expected wiki adopted, changed and locked, got %+v", wiki)
+	}
+	if docs, _ := s.Get("docs"); docs.Creator != "docs@example.com" || docs.Managed != 1 {
+		t.Errorf("Unexpected docs %+v", docs)
+	}
+
+	// a second run has nothing to do
+	if changes, err := store.Sync(s, links, storetest.Admin, false); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v %v", changes, err)
+	}
+
+	// drift made in the UI is put back, and links taken out of the files go
+	drifted := wiki
+	drifted.URL = "https://drift.example.com"
+	drifted.LastModifiedBy = storetest.Admin
+	if _, err := s.Modify(drifted); err != nil {
+		t.Fatal(err)
+	}
+	dir = writeSyncDir(t, map[string]string{
+		"links.yaml": "- shortkey: wiki\n  url: https://new-wiki.example.com\n",
+	})
+	links, err = store.ReadSyncDir(dir, storetest.Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err = store.Sync(s, links, storetest.Admin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []store.SyncChange{
+		{Key: "wiki", Action: store.SyncModified, Source: "links.yaml"},
+		{Key: "docs", Action: store.SyncDeleted},
+		{Key: "oncall", Action: store.SyncDeleted},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+	if _, err := s.Get("jira"); err != nil {
+		t.Errorf("A link made in the UI was touched, %v", err)
+	}
+	if _, err := s.Get("oncall"); !errors.Is(err, store.ErrNotFound) {
+		t.Error("Expected oncall deleted")
+	}
+}
+
+func TestReadSyncDirErrors(t *testing.T) {
+	tests := map[string]map[string]string{
+		"invalid link": {"a.yaml": "- shortkey: bad key\n  url: https://example.com\n"},
+		"declared twice": {
+			"a.yaml": "- shortkey: wiki\n  url: https://example.com\n",
+			"b.yaml": "- shortkey: Wiki\n  url: https://example.com\n",
+		},
+		"not a list": {"a.yaml": "shortkey: wiki\n"},
+		"empty":      {"README.md": "nothing here"},
+	}
+	for name, files := range tests {
+		if _, err := store.ReadSyncDir(writeSyncDir(t, files), storetest.Admin); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Team is a group of users that owns links and namespaces together.  MemberAccess is what
+// its members may do to its links and DefaultAccess what everyone else may.
+type Team struct {
+	ID            int          `json:"id"`
+	Name          string       `json:"name"`
+	MemberAccess  Access       `json:"member_access"`
+	DefaultAccess Access       `json:"default_access"`
+	Creator       string       `json:"creator,omitempty"`
+	CreatedAt     string       `json:"created_at,omitempty"`
+	Members       []TeamMember `json:"members,omitempty"`
+}
+
+// TeamMember is a user in a team.  Managers may change the team's members and settings.
+type TeamMember struct {
+	User    string `json:"user"`
+	Manager bool   `json:"manager"`
+}
+
+// checkAccess makes sure t's members may at least change its links, and everyone else at
+// most change them.  An unset MemberAccess makes the members owners.
+func (t *Team) checkAccess() error {
+	if t.MemberAccess == AccessNone {
+		t.MemberAccess = AccessOwner
+	}
+	if t.MemberAccess != AccessEditor && t.MemberAccess != AccessOwner {
+		return fmt.Errorf("Members of a team may be editors or owners of its links, not %s", t.MemberAccess)
+	}
+	if t.DefaultAccess != AccessNone && t.DefaultAccess != AccessEditor {
+		return fmt.Errorf("Everyone may be nothing or editors of a team's links, not %s", t.DefaultAccess)
+	}
+	return nil
+}
+
+// CreateTeam creates the team t on behalf of username, who becomes its first manager.  With
+// no username, as when provisioning, the team starts out with no members.
+func (s *DataStore) CreateTeam(t Team, username string) (Team, error) {
+	var user *User
+	if username != "" {
+		var err error
+		if user, err = s.GetUser(username); err != nil {
+			return Team{}, err
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Team{}, err
+	}
+	defer tx.Rollback()
+
+	t, err = s.insertTeam(tx, t, user)
+	if err != nil {
+		if s.IsSQLErrUniqueContraint(err) || s.IsSQLErrDuplicateContraint(err) {
+			return Team{}, fmt.Errorf("Team %s already exists", t.Name)
+		}
+		return Team{}, err
+	}
+	return t, tx.Commit()
+}
+
+// insertTeam adds the team t with manager, if there is one, as its only member.
+func (s *DataStore) insertTeam(q execer, t Team, manager *User) (Team, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if err := routes.IsValidTeam(t.Name); err != nil {
+		return t, err
+	}
+	if err := t.checkAccess(); err != nil {
+		return t, err
+	}
+	t.CreatedAt = time.Now().Format(routes.TimeFormat)
+	var creatorID interface{}
+	if manager != nil {
+		t.Creator, creatorID = manager.Name, manager.ID
+	}
+	id, err := s.insertReturningID(q, GetSQL(s.dbtype, "insertTeam"), t.Name, t.MemberAccess, t.DefaultAccess, creatorID, t.CreatedAt)
+	if err != nil {
+		return t, err
+	}
+	t.ID = int(id)
+	t.Members = make([]TeamMember, 0)
+	if manager != nil {
+		if _, err := q.Exec(GetSQL(s.dbtype, "insertTeamMember"), t.ID, manager.ID, 1, t.CreatedAt); err != nil {
+			return t, err
+		}
+		t.Members = append(t.Members, TeamMember{User: manager.Name, Manager: true})
+	}
+	return t, nil
+}
+
+// Team returns the team name along with its members.
+func (s *DataStore) Team(name string) (Team, error) {
+	t, err := scanTeam(s.db.QueryRow(GetSQL(s.dbtype, "getTeam"), name))
+	if err == sql.ErrNoRows {
+		return Team{}, fmt.Errorf("%w, no team %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Team{}, err
+	}
+	return s.withMembers(t)
+}
+
+// TeamByID returns the team with the id along with its members.
+func (s *DataStore) TeamByID(id int) (Team, error) {
+	t, err := s.teamByID(s.db, id)
+	if err == ErrNotFound {
+		return Team{}, fmt.Errorf("%w, no team %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return Team{}, err
+	}
+	return s.withMembers(t)
+}
+
+// withMembers fills in the members of t.
+func (s *DataStore) withMembers(t Team) (Team, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getTeamMembers"), t.ID)
+	if err != nil {
+		return Team{}, err
+	}
+	defer rows.Close()
+
+	t.Members = make([]TeamMember, 0)
+	for rows.Next() {
+		var m TeamMember
+		var manager int
+		if err := rows.Scan(&m.User, &manager); err != nil {
+			return Team{}, err
+		}
+		m.Manager = manager == 1
+		t.Members = append(t.Members, m)
+	}
+	return t, rows.Err()
+}
+
+// AllTeams lists every team ordered by name, without their members.
+func (s *DataStore) AllTeams() ([]Team, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getTeams"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := make([]Team, 0)
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// UpdateTeam changes what the members of the team t.Name and everyone else may do to its
+// links, on behalf of username, one of its managers or an admin.
+func (s *DataStore) UpdateTeam(t Team, username string) (Team, error) {
+	current, _, err := s.managedTeam(t.Name, username, "change")
+	if err != nil {
+		return Team{}, err
+	}
+	if err := t.checkAccess(); err != nil {
+		return Team{}, err
+	}
+	if _, err := s.db.Exec(GetSQL(s.dbtype, "updateTeam"), t.MemberAccess, t.DefaultAccess, current.ID); err != nil {
+		return Team{}, err
+	}
+	return s.Team(current.Name)
+}
+
+// DeleteTeam removes the team name, which must no longer own any links or namespaces, on
+// behalf of username, one of its managers or an admin.
+func (s *DataStore) DeleteTeam(name string, username string) error {
+	t, _, err := s.managedTeam(name, username, "delete")
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned int
+	if err := tx.QueryRow(GetSQL(s.dbtype, "countTeamOwned"), t.ID, t.ID).Scan(&owned); err != nil {
+		return err
+	}
+	if owned > 0 {
+		return fmt.Errorf("Team %s still owns %d links or namespaces", t.Name, owned)
+	}
+	if _, err := tx.Exec(GetSQL(s.dbtype, "deleteTeamMembers"), t.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(GetSQL(s.dbtype, "deleteTeam"), t.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddTeamMember puts member in the team, or changes whether they manage it, on behalf of
+// username, one of its managers or an admin.
+func (s *DataStore) AddTeamMember(team string, member string, manager bool, username string) error {
+	t, _, err := s.managedTeam(team, username, "change the members of")
+	if err != nil {
+		return err
+	}
+	m, err := s.GetUser(member)
+	if err != nil {
+		return err
+	}
+	isManager := 0
+	if manager {
+		isManager = 1
+	}
+	var current int
+	err = s.db.QueryRow(GetSQL(s.dbtype, "getTeamMember"), t.ID, m.ID).Scan(&current)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = s.db.Exec(GetSQL(s.dbtype, "insertTeamMember"), t.ID, m.ID, isManager, time.Now().Format(routes.TimeFormat))
+	case err == nil && current != isManager:
+		_, err = s.db.Exec(GetSQL(s.dbtype, "updateTeamMember"), isManager, t.ID, m.ID)
+	}
+	return err
+}
+
+// SetTeamMembers makes users exactly the members of the team t on behalf of username, one
+// of its managers or an admin, in one transaction, first creating t without managers if it
+// has no ID yet, which only admins may do.  Members who stay keep whether they manage it.
+// When admins says t makes its members admins, those joining become admins and those
+// leaving stop being admins unless admins says another of their teams keeps them one.
+func (s *DataStore) SetTeamMembers(t Team, users []string, admins func(team string) bool, username string) (Team, error) {
+	current := Team{Name: t.Name, Members: make([]TeamMember, 0)}
+	if t.ID != 0 {
+		var err error
+		if current, _, err = s.managedTeam(t.Name, username, "change the members of"); err != nil {
+			return Team{}, err
+		}
+	} else {
+		user, err := s.GetUser(username)
+		if err != nil {
+			return Team{}, err
+		}
+		if user.IsAdmin != 1 {
+			return Team{}, fmt.Errorf("%w, %s may not create team %s without managers, only admins may", ErrForbidden, user.Name, t.Name)
+		}
+	}
+	makesAdmins := admins != nil && admins(current.Name)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Team{}, err
+	}
+	defer tx.Rollback()
+
+	if t.ID == 0 {
+		created, err := s.insertTeam(tx, t, nil)
+		if err != nil {
+			if s.IsSQLErrUniqueContraint(err) || s.IsSQLErrDuplicateContraint(err) {
+				return Team{}, fmt.Errorf("Team %s already exists", created.Name)
+			}
+			return Team{}, err
+		}
+		current.ID, current.Name = created.ID, created.Name
+	}
+	now := time.Now().Format(routes.TimeFormat)
+	want := make(map[string]bool, len(users))
+	for _, name := range users {
+		if want[name] {
+			continue
+		}
+		want[name] = true
+		if isMemberOf(current, name) {
+			continue
+		}
+		u, err := s.getUser(tx, name)
+		if err != nil {
+			return Team{}, err
+		}
+		if _, err := tx.Exec(GetSQL(s.dbtype, "insertTeamMember"), current.ID, u.ID, 0, now); err != nil {
+			return Team{}, err
+		}
+		if makesAdmins && u.IsAdmin != 1 {
+			if _, err := tx.Exec(GetSQL(s.dbtype, "setUserAdmin"), 1, now, u.ID); err != nil {
+				return Team{}, err
+			}
+		}
+	}
+	for _, m := range current.Members {
+		if want[m.User] {
+			continue
+		}
+		u, err := s.getUser(tx, m.User)
+		if err != nil {
+			return Team{}, err
+		}
+		if _, err := tx.Exec(GetSQL(s.dbtype, "deleteTeamMember"), current.ID, u.ID); err != nil {
+			return Team{}, err
+		}
+		if makesAdmins && u.IsAdmin == 1 {
+			still, err := s.inAdminTeam(tx, u.Name, admins)
+			if err != nil {
+				return Team{}, err
+			}
+			if !still {
+				if _, err := tx.Exec(GetSQL(s.dbtype, "setUserAdmin"), 0, now, u.ID); err != nil {
+					return Team{}, err
+				}
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Team{}, err
+	}
+	return s.Team(current.Name)
+}
+
+// inAdminTeam is whether username is still in a team that admins says makes them an admin.
+func (s *DataStore) inAdminTeam(tx *sql.Tx, username string, admins func(team string) bool) (bool, error) {
+	rows, err := tx.Query(GetSQL(s.dbtype, "getUserTeams"), username)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var team string
+		if err := rows.Scan(&team); err != nil {
+			return false, err
+		}
+		if admins(team) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// isMemberOf is whether user is one of t's members.
+func isMemberOf(t Team, user string) bool {
+	for _, m := range t.Members {
+		if m.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveTeamMember takes member out of the team on behalf of username, one of its managers
+// or an admin.  Anyone may leave a team.
+func (s *DataStore) RemoveTeamMember(team string, member string, username string) error {
+	t, err := s.Team(team)
+	if err != nil {
+		return err
+	}
+	if member != username {
+		if _, _, err := s.managedTeam(team, username, "change the members of"); err != nil {
+			return err
+		}
+	}
+	m, err := s.GetUser(member)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(GetSQL(s.dbtype, "deleteTeamMember"), t.ID, m.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("%w, %s is not a member of team %s", ErrNotFound, m.Name, t.Name)
+	}
+	return nil
+}
+
+// TeamLinks lists the live links owned by the teams username is in, ordered by key.
+func (s *DataStore) TeamLinks(username string) ([]routes.Route, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getTeamLinks"), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRouteList(rows)
+}
+
+// managedTeam returns the team name and username, making sure they are one of its managers
+// or an admin, who may do action to it.
+func (s *DataStore) managedTeam(name string, username string, action string) (Team, *User, error) {
+	t, err := s.Team(name)
+	if err != nil {
+		return Team{}, nil, err
+	}
+	user, err := s.GetUser(username)
+	if err != nil {
+		return Team{}, nil, err
+	}
+	if user.IsAdmin == 1 {
+		return t, user, nil
+	}
+	for _, m := range t.Members {
+		if m.User == user.Name && m.Manager {
+			return t, user, nil
+		}
+	}
+	return Team{}, nil, fmt.Errorf("%w, %s may not %s team %s, only its managers and admins may", ErrForbidden, user.Name, action, t.Name)
+}
+
+// teamID returns the id of the team name for a route or namespace to be owned by, or nil
+// for no team.  The team has to exist and user has to be in it or an admin, as handing
+// a link to a team hands it to all of its members.
+func (s *DataStore) teamID(q querier, name string, user *User) (interface{}, error) {
+	if name == "" {
+		return nil, nil
+	}
+	t, err := scanTeam(q.QueryRow(GetSQL(s.dbtype, "getTeam"), name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w, no team %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAdmin == 1 {
+		return t.ID, nil
+	}
+	var manager int
+	err = q.QueryRow(GetSQL(s.dbtype, "getTeamMember"), t.ID, user.ID).Scan(&manager)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w, %s is not in team %s, only its members and admins may give it links", ErrForbidden, user.Name, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.ID, nil
+}
+
+// teamByID returns the team id, which may have been deleted since it was recorded.
+func (s *DataStore) teamByID(q querier, id int) (Team, error) {
+	t, err := scanTeam(q.QueryRow(GetSQL(s.dbtype, "getTeamByID"), id))
+	if err == sql.ErrNoRows {
+		return Team{}, ErrNotFound
+	}
+	return t, err
+}
+
+// ensureTeam returns the team name, creating it with no creator if there is none yet.
+func (s *DataStore) ensureTeam(name string) (Team, error) {
+	t, err := scanTeam(s.db.QueryRow(GetSQL(s.dbtype, "getTeam"), name))
+	if err != sql.ErrNoRows {
+		return t, err
+	}
+	t, err = s.insertTeam(s.db, Team{Name: name}, nil)
+	if err != nil && (s.IsSQLErrUniqueContraint(err) || s.IsSQLErrDuplicateContraint(err)) {
+		// created by someone else in the meantime
+		return scanTeam(s.db.QueryRow(GetSQL(s.dbtype, "getTeam"), name))
+	}
+	return t, err
+}
+
+// scanTeam reads a team from a getTeam query.
+func scanTeam(row interface{ Scan(...interface{}) error }) (Team, error) {
+	var t Team
+	var createdAt sql.NullString
+	if err := row.Scan(&t.ID, &t.Name, &t.MemberAccess, &t.DefaultAccess, &t.Creator, &createdAt); err != nil {
+		return Team{}, err
+	}
+	t.CreatedAt = createdAt.String
+	return t, nil
+}
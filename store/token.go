@@ -0,0 +1,192 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// The scopes an API token may be limited to.  ScopeAdmin takes in the others.
+const (
+	ScopeLinksRead  = "links:read"
+	ScopeLinksWrite = "links:write"
+	ScopeAdmin      = "admin"
+)
+
+// Scopes lists every scope a token can have.
+var Scopes = []string{ScopeLinksRead, ScopeLinksWrite, ScopeAdmin}
+
+// TokenPrefix starts every API token, so they can be told from other bearer tokens and
+// spotted when they leak.
+const TokenPrefix = "glk_"
+
+// touchEvery is how stale a token's last use may get before using it again is recorded.
+const touchEvery = time.Minute
+
+// APIToken is a personal API token.  Only a hash of the token itself is kept, so it is
+// seen once, when it is created.
+type APIToken struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	User       string   `json:"user"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	Token      string   `json:"token,omitempty"`
+}
+
+// HasScope is whether the token allows scope.
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateToken mints a token named name for username, limited to scopes and, unless
+// expires is zero, good until then.  Only admins may have admin tokens.
+func (s *DataStore) CreateToken(username string, name string, scopes []string, expires time.Time) (APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return APIToken{}, fmt.Errorf("A token needs a name of at most 100 characters")
+	}
+	if len(scopes) == 0 {
+		return APIToken{}, fmt.Errorf("A token needs at least one of the scopes %s", strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return APIToken{}, fmt.Errorf("Unknown scope %s, expected one of %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	if !expires.IsZero() && expires.Before(time.Now()) {
+		return APIToken{}, fmt.Errorf("Token would expire at %s, in the past", expires.Format(routes.TimeFormat))
+	}
+	user, err := s.GetUser(username)
+	if err != nil {
+		return APIToken{}, err
+	}
+	t := APIToken{Name: name, User: user.Name, Scopes: scopes, CreatedAt: time.Now().Format(routes.TimeFormat)}
+	if t.HasScope(ScopeAdmin) && user.IsAdmin != 1 {
+		return APIToken{}, fmt.Errorf("%w, user %s is not admin", ErrForbidden, user.Name)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIToken{}, err
+	}
+	t.Token = TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	var expiresAt interface{}
+	if !expires.IsZero() {
+		// stored in server time, as CheckToken compares it
+		t.ExpiresAt = expires.Local().Format(routes.TimeFormat)
+		expiresAt = t.ExpiresAt
+	}
+	id, err := s.insertReturningID(s.db, GetSQL(s.dbtype, "insertAPIToken"), user.ID, t.Name, hashToken(t.Token), strings.Join(scopes, " "), t.CreatedAt, expiresAt)
+	if err != nil {
+		if s.IsSQLErrUniqueContraint(err) || s.IsSQLErrDuplicateContraint(err) {
+			return APIToken{}, fmt.Errorf("%s already has a token named %s", user.Name, t.Name)
+		}
+		return APIToken{}, err
+	}
+	t.ID = int(id)
+	return t, nil
+}
+
+// Tokens lists username's tokens, oldest first, without the tokens themselves.
+func (s *DataStore) Tokens(username string) ([]APIToken, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getAPITokens"), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]APIToken, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken deletes the token id on behalf of username, who must own it or be an admin.
+func (s *DataStore) RevokeToken(id int, username string) error {
+	t, err := scanToken(s.db.QueryRow(GetSQL(s.dbtype, "getAPITokenByID"), id))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w, no token %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if t.User != user.Name && user.IsAdmin != 1 {
+		return fmt.Errorf("%w, token %d belongs to %s", ErrForbidden, id, t.User)
+	}
+	_, err = s.db.Exec(GetSQL(s.dbtype, "deleteAPIToken"), id)
+	return err
+}
+
+// CheckToken returns the token token, noting that it has been used.  Unknown, revoked and
+// expired tokens are all ErrNotFound.
+func (s *DataStore) CheckToken(token string) (APIToken, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return APIToken{}, ErrNotFound
+	}
+	now := time.Now()
+	t, err := scanToken(s.db.QueryRow(GetSQL(s.dbtype, "getAPITokenByHash"), hashToken(token), now.Format(routes.TimeFormat)))
+	if err == sql.ErrNoRows {
+		return APIToken{}, ErrNotFound
+	}
+	if err != nil {
+		return APIToken{}, err
+	}
+	// at most once every touchEvery, so a busy CI job is not a write per request
+	_, err = s.db.Exec(GetSQL(s.dbtype, "touchAPIToken"), now.Format(routes.TimeFormat), t.ID, now.Add(-touchEvery).Format(routes.TimeFormat))
+	return t, err
+}
+
+// scanToken reads a token from a getAPIToken query.
+func scanToken(row interface{ Scan(...interface{}) error }) (APIToken, error) {
+	var t APIToken
+	var scopes string
+	var expires, lastUsed sql.NullString
+	if err := row.Scan(&t.ID, &t.Name, &t.User, &scopes, &t.CreatedAt, &expires, &lastUsed); err != nil {
+		return APIToken{}, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	t.ExpiresAt, t.LastUsedAt = expires.String, lastUsed.String
+	return t, nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+	"github.com/tcotav/golinks/store"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	db := newSQLiteDB(t)
+	s, err := store.NewStore("sqlite", db, nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := s.CreateToken("t@example.com", "ci", []string{store.ScopeLinksRead}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CheckToken(tok.Token); err != nil {
+		t.Fatalf("Expected the token good for an hour, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute).Format(routes.TimeFormat)
+	if _, err := db.Exec("UPDATE api_tokens SET expires_at = ? WHERE id = ?", past, tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CheckToken(tok.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected an expired token to be ErrNotFound, got %v", err)
+	}
+	if _, err := s.CreateToken("t@example.com", "old", []string{store.ScopeLinksRead}, time.Now().Add(-time.Hour)); err == nil {
+		t.Error("Expected an error creating a token that has already expired")
+	}
+
+	// an hour from now, given ten hours behind server time
+	_, offset := time.Now().Zone()
+	behind := time.Now().Add(time.Hour).In(time.FixedZone("behind", offset-10*60*60))
+	tok, err = s.CreateToken("t@example.com", "elsewhere", []string{store.ScopeLinksRead}, behind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := behind.Local().Format(routes.TimeFormat); tok.ExpiresAt != want {
+		t.Errorf("Expected the expiry in server time %s, got %s", want, tok.ExpiresAt)
+	}
+	if _, err := s.CheckToken(tok.Token); err != nil {
+		t.Errorf("Expected a token good for an hour in another zone, got %v", err)
+	}
+}
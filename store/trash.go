@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
+// Trash lists the deleted routes that have not been purged yet, oldest deletion first.
+func (s *DataStore) Trash() ([]routes.Route, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getTrash"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routeList := make([]routes.Route, 0)
+	for rows.Next() {
+		var r routes.Route
+		var deletedBy sql.NullString
+		err := rows.Scan(&r.ShortKey, &r.URL, &r.FallbackURL, &r.Passthrough, &r.Targets, &r.Rotation, &r.CreatedAt, &r.Creator, &r.Team, &r.TeamID, &r.ModifiedAt, &r.LastModifiedBy,
+			&r.Locked, &r.DeletedAt, &deletedBy)
+		if err != nil {
+			return nil, err
+		}
+		r.DeletedBy = deletedBy.String
+		routeList = append(routeList, r)
+	}
+	return routeList, rows.Err()
+}
+
+// Undelete takes the route k back out of the trash on behalf of username, one of its owners,
+// as long as k still fits the namespaces.
+func (s *DataStore) Undelete(k string, username string) (int, error) {
+	k = routes.NormalizeKey(k)
+	now := time.Now().Format(routes.TimeFormat)
+	user, err := s.GetUser(username)
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	a, err := s.authorize(tx, k, user, AccessOwner, "undelete")
+	if err != nil {
+		return -1, err
+	}
+	// a namespace may have been handed to another team since k was deleted
+	if err := s.checkNamespace(routes.Route{ShortKey: k, Team: a.team}, user); err != nil {
+		return -1, err
+	}
+	res, err := s.undelete(tx, k, user.ID, now)
+	if err != nil {
+		return -1, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	if err := s.recordHistory(tx, k, "undelete", user.ID, now); err != nil {
+		return -1, err
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+
+	s.uncache(k)
+	s.keys.drop()
+	return int(affect), nil
+}
+
+// undelete clears the deleted flag on k inside tx, returning ErrNotFound if k is not in the trash.
+func (s *DataStore) undelete(tx *sql.Tx, k string, userID int, now string) (sql.Result, error) {
+	res, err := tx.Exec(GetSQL(s.dbtype, "undeleteRouteSQL"), userID, now, k)
+	if err != nil {
+		return nil, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affect == 0 {
+		return nil, ErrNotFound
+	}
+	return res, nil
+}
+
+// PurgeTrash permanently removes every route deleted before the given time and returns how
+// many went.  Their history is kept, so Restore can still bring them back.
+func (s *DataStore) PurgeTrash(before time.Time) (int, error) {
+	res, err := s.db.Exec(GetSQL(s.dbtype, "purgeTrash"), before.Format(routes.TimeFormat))
+	if err != nil {
+		return -1, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	// the editors of purged routes go with them
+	if _, err := s.db.Exec(GetSQL(s.dbtype, "purgeOrphanEditors")); err != nil {
+		return -1, err
+	}
+	return int(affect), nil
+}
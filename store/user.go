@@ -1,7 +1,197 @@
 package store
 
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tcotav/golinks/routes"
+)
+
 type User struct {
-	ID      int    `json:"id"`
-	Name    string `json:"name"`
-	IsAdmin int    `json:"isadmin,omitempty"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	IsAdmin     int    `json:"isadmin,omitempty"`
+	Deactivated int    `json:"deactivated,omitempty"`
+}
+
+// FindUser returns username, unlike GetUser without creating it when there is no such user.
+func (s *DataStore) FindUser(username string) (*User, error) {
+	return scanUser(s.db.QueryRow(GetSQL(s.dbtype, "getUser"), username), username)
+}
+
+// UserByID returns the user with the id.
+func (s *DataStore) UserByID(id int) (*User, error) {
+	return scanUser(s.db.QueryRow(GetSQL(s.dbtype, "getUserByID"), id), id)
+}
+
+// AllUsers lists every user in the order they were created.
+func (s *DataStore) AllUsers() ([]User, error) {
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getAllUsers"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.IsAdmin, &u.Deactivated); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// scanUser reads a user from a getUser query, ErrNotFound naming who when there is none.
+func scanUser(row *sql.Row, who interface{}) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.IsAdmin, &u.Deactivated)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w, no user %v", ErrNotFound, who)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetDeactivated marks username as having left, or as back again, which only admins may
+// do.  The user has to exist already.  Deactivated users may not sign in, and links nobody
+// active owns any more show up in OrphanedLinks.
+func (s *DataStore) SetDeactivated(username string, deactivated bool, admin string) (*User, error) {
+	adminUser, err := s.GetUser(admin)
+	if err != nil {
+		return nil, err
+	}
+	if adminUser.IsAdmin != 1 {
+		return nil, fmt.Errorf("%w, %s is not an admin", ErrForbidden, admin)
+	}
+	if username == adminUser.Name && deactivated {
+		return nil, fmt.Errorf("%w, admins may not deactivate themselves", ErrForbidden)
+	}
+	u, err := s.FindUser(username)
+	if err != nil {
+		return nil, err
+	}
+	flag := 0
+	if deactivated {
+		flag = 1
+	}
+	if u.Deactivated == flag {
+		return u, nil
+	}
+	now := time.Now().Format(routes.TimeFormat)
+	if _, err := s.db.Exec(GetSQL(s.dbtype, "setUserDeactivated"), flag, now, adminUser.ID, u.ID); err != nil {
+		return nil, err
+	}
+	u.Deactivated = flag
+	return u, nil
+}
+
+// TransferLinks hands every live link created by from over to the user toUser, the team
+// toTeam, or both, on behalf of admin, and returns the keys of the links it moved.  The
+// users and the team have to exist already.
+func (s *DataStore) TransferLinks(from string, toUser string, toTeam string, admin string) ([]string, error) {
+	adminUser, err := s.GetUser(admin)
+	if err != nil {
+		return nil, err
+	}
+	if adminUser.IsAdmin != 1 {
+		return nil, fmt.Errorf("%w, %s is not an admin", ErrForbidden, admin)
+	}
+	if toUser == "" && toTeam == "" {
+		return nil, fmt.Errorf("Links have to be transferred to a user, a team or both")
+	}
+	fromUser, err := s.FindUser(from)
+	if err != nil {
+		return nil, err
+	}
+	var creatorID, teamID interface{}
+	if toUser != "" {
+		u, err := s.FindUser(toUser)
+		if err != nil {
+			return nil, err
+		}
+		creatorID = u.ID
+	}
+	if toTeam != "" {
+		t, err := s.Team(toTeam)
+		if err != nil {
+			return nil, err
+		}
+		teamID = t.ID
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(GetSQL(s.dbtype, "getCreatorRoutes"), fromUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	type owners struct {
+		key     string
+		creator int
+		team    sql.NullInt64
+	}
+	var links []owners
+	for rows.Next() {
+		var o owners
+		if err := rows.Scan(&o.key, &o.creator, &o.team); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		links = append(links, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format(routes.TimeFormat)
+	keys := make([]string, 0, len(links))
+	for _, o := range links {
+		creator, team := interface{}(o.creator), interface{}(nil)
+		if o.team.Valid {
+			team = o.team.Int64
+		}
+		if creatorID != nil {
+			creator = creatorID
+		}
+		if teamID != nil {
+			team = teamID
+		}
+		if _, err := tx.Exec(GetSQL(s.dbtype, "transferRoute"), creator, team, adminUser.ID, now, o.key); err != nil {
+			return nil, err
+		}
+		if err := s.recordHistory(tx, o.key, "transfer", adminUser.ID, now); err != nil {
+			return nil, err
+		}
+		keys = append(keys, o.key)
+	}
+	return keys, tx.Commit()
+}
+
+// OrphanedLinks lists, for admin, the live links whose owners have all been deactivated:
+// their creator, and the members of their team when those own its links.  They are waiting
+// to be transferred to someone still around.
+func (s *DataStore) OrphanedLinks(admin string) ([]routes.Route, error) {
+	adminUser, err := s.GetUser(admin)
+	if err != nil {
+		return nil, err
+	}
+	if adminUser.IsAdmin != 1 {
+		return nil, fmt.Errorf("%w, %s is not an admin", ErrForbidden, admin)
+	}
+	rows, err := s.db.Query(GetSQL(s.dbtype, "getOrphanedRoutes"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRouteList(rows)
 }